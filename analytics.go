@@ -0,0 +1,509 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backToBackGap is the longest break between two meetings that are still
+// back to back.
+const backToBackGap = 5 * time.Minute
+
+// maxAnalyticsDays limits the period of a report, which is fetched at once.
+const maxAnalyticsDays = 92
+
+// timeSpan is a period of time.
+type timeSpan struct {
+	Start, End time.Time
+}
+
+func (s timeSpan) duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// timeAnalytics is where the time of [Start, End) went.
+type timeAnalytics struct {
+	Start, End time.Time
+	// AsOf is set when the events come from an offline snapshot
+	AsOf       time.Time
+	Categories []categoryTime
+	// Meetings counts each meeting once, even one on several days
+	Meetings    int
+	MeetingTime time.Duration
+	// WorkingTime is the total of the working hours, and MeetingShare the
+	// part of it spent in meetings
+	WorkingTime  time.Duration
+	MeetingShare float64
+	Days         []dayAnalytics
+}
+
+// categoryTime is the time spent in events of a category. Overlapping
+// events count in full.
+type categoryTime struct {
+	Name   string
+	Emoji  string
+	Class  string
+	Events int
+	Time   time.Duration
+}
+
+// dayAnalytics sums up one day.
+type dayAnalytics struct {
+	Day         time.Time
+	Workday     bool
+	Meetings    int
+	MeetingTime time.Duration
+	// LongestFree is the longest time without events within working hours
+	LongestFree timeSpan
+	// LongestStreak is the longest run of back-to-back meetings
+	LongestStreak meetingStreak
+}
+
+// meetingStreak is a run of meetings with at most backToBackGap between
+// them.
+type meetingStreak struct {
+	timeSpan
+	Meetings int
+}
+
+// isMeeting reports whether an event is a meeting: an event of a meeting
+// category, or with guests when its category has no class. Declined and
+// all-day events are not.
+func isMeeting(event CalendarEvent) bool {
+	if !countsAsBusy(event) {
+		return false
+	}
+	switch event.EventType {
+	case "focusTime", "outOfOffice":
+		return false
+	}
+	if event.CategoryClass != "" {
+		return event.CategoryClass == classMeeting
+	}
+	return event.attendeeCount() > 1
+}
+
+// countsAsBusy reports whether an event takes up the user's time: timed
+// events they haven't declined, except working locations.
+func countsAsBusy(event CalendarEvent) bool {
+	return !event.IsAllDay && event.EventType != "workingLocation" && !event.declined()
+}
+
+// timeAnalytics totals the events of [start, end).
+func (cs *CalendarService) timeAnalytics(ctx context.Context, start, end time.Time) (*timeAnalytics, error) {
+	events, asOf, err := cs.getEvents(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return analyzeTime(events, start, end, asOf, cs.config), nil
+}
+
+func analyzeTime(events []CalendarEvent, start, end, asOf time.Time, cfg *Config) *timeAnalytics {
+	report := &timeAnalytics{Start: start, End: end, AsOf: asOf}
+
+	categories := make(map[string]*categoryTime)
+	for _, event := range events {
+		if !countsAsBusy(event) {
+			continue
+		}
+		span := clip(timeSpan{event.Start, event.End}, timeSpan{start, end})
+		category, ok := categories[event.Category]
+		if !ok {
+			category = &categoryTime{Name: event.Category, Emoji: event.CategoryEmoji, Class: event.CategoryClass}
+			categories[event.Category] = category
+		}
+		category.Events++
+		category.Time += span.duration()
+		if isMeeting(event) {
+			report.Meetings++
+		}
+	}
+	for _, category := range categories {
+		report.Categories = append(report.Categories, *category)
+	}
+	sort.Slice(report.Categories, func(i, j int) bool {
+		if report.Categories[i].Time != report.Categories[j].Time {
+			return report.Categories[i].Time > report.Categories[j].Time
+		}
+		return report.Categories[i].Name < report.Categories[j].Name
+	})
+
+	var meetingTimeAtWork time.Duration
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		dayEvents := eventsOnDay(events, day)
+		var busy, meetings []timeSpan
+		for _, event := range dayEvents {
+			if !countsAsBusy(event) {
+				continue
+			}
+			span := clip(timeSpan{event.Start, event.End}, timeSpan{day, day.AddDate(0, 0, 1)})
+			busy = append(busy, span)
+			if isMeeting(event) {
+				meetings = append(meetings, span)
+			}
+		}
+
+		stats := dayAnalytics{Day: day, Meetings: len(meetings), MeetingTime: unionTime(meetings)}
+		stats.LongestStreak = longestStreak(meetings)
+		if workStart, workEnd, ok := cfg.workingHours(day); ok {
+			work := timeSpan{workStart, workEnd}
+			stats.Workday = true
+			report.WorkingTime += work.duration()
+			for _, free := range freeBlocks(busy, work) {
+				if free.duration() > stats.LongestFree.duration() {
+					stats.LongestFree = free
+				}
+			}
+			var atWork []timeSpan
+			for _, meeting := range meetings {
+				atWork = append(atWork, clip(meeting, work))
+			}
+			meetingTimeAtWork += unionTime(atWork)
+		}
+		report.MeetingTime += stats.MeetingTime
+		report.Days = append(report.Days, stats)
+	}
+	if report.WorkingTime > 0 {
+		report.MeetingShare = 100 * float64(meetingTimeAtWork) / float64(report.WorkingTime)
+	}
+	return report
+}
+
+// clip returns the part of span within bounds, empty if none.
+func clip(span, bounds timeSpan) timeSpan {
+	clamp := func(t time.Time) time.Time {
+		switch {
+		case t.Before(bounds.Start):
+			return bounds.Start
+		case t.After(bounds.End):
+			return bounds.End
+		}
+		return t
+	}
+	span.Start, span.End = clamp(span.Start), clamp(span.End)
+	if span.End.Before(span.Start) {
+		span.End = span.Start
+	}
+	return span
+}
+
+// mergeSpans sorts spans and merges the overlapping ones.
+func mergeSpans(spans []timeSpan) []timeSpan {
+	sorted := append([]timeSpan(nil), spans...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+	var merged []timeSpan
+	for _, span := range sorted {
+		if span.duration() <= 0 {
+			continue
+		}
+		if last := len(merged) - 1; last >= 0 && !span.Start.After(merged[last].End) {
+			if span.End.After(merged[last].End) {
+				merged[last].End = span.End
+			}
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+// unionTime returns the time covered by spans, counting overlaps once.
+func unionTime(spans []timeSpan) time.Duration {
+	var total time.Duration
+	for _, span := range mergeSpans(spans) {
+		total += span.duration()
+	}
+	return total
+}
+
+// freeBlocks returns the times within bounds not covered by busy.
+func freeBlocks(busy []timeSpan, bounds timeSpan) []timeSpan {
+	var free []timeSpan
+	cursor := bounds.Start
+	for _, span := range mergeSpans(busy) {
+		span = clip(span, bounds)
+		if span.Start.After(cursor) {
+			free = append(free, timeSpan{cursor, span.Start})
+		}
+		if span.End.After(cursor) {
+			cursor = span.End
+		}
+	}
+	if bounds.End.After(cursor) {
+		free = append(free, timeSpan{cursor, bounds.End})
+	}
+	return free
+}
+
+// longestStreak returns the longest run of back-to-back meetings, of at
+// least two meetings.
+func longestStreak(meetings []timeSpan) meetingStreak {
+	sorted := append([]timeSpan(nil), meetings...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+	var longest, current meetingStreak
+	for _, meeting := range sorted {
+		if current.Meetings > 0 && !meeting.Start.After(current.End.Add(backToBackGap)) {
+			current.Meetings++
+			if meeting.End.After(current.End) {
+				current.End = meeting.End
+			}
+		} else {
+			current = meetingStreak{timeSpan: meeting, Meetings: 1}
+		}
+		if current.Meetings >= 2 && (current.Meetings > longest.Meetings ||
+			current.Meetings == longest.Meetings && current.duration() > longest.duration()) {
+			longest = current
+		}
+	}
+	return longest
+}
+
+// formatTimeAnalytics renders the report as text, markdown or JSON.
+func formatTimeAnalytics(report *timeAnalytics, format string, cfg *Config) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", formatText:
+		return withOfflineNotice(timeAnalyticsText(report, cfg), report.AsOf, cfg), nil
+	case formatMarkdown:
+		return withOfflineNotice(timeAnalyticsMarkdown(report, cfg), report.AsOf, cfg), nil
+	case formatJSON:
+		out, err := json.MarshalIndent(timeAnalyticsJSON(report, cfg), "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+	return "", fmt.Errorf("unknown format %q: use one of %s", format, strings.Join(reportFormats, ", "))
+}
+
+// clockRange formats a span as "13:00-17:00".
+func clockRange(span timeSpan, cfg *Config) string {
+	return span.Start.In(cfg.location).Format(cfg.Formatting.TimeFormat) + "-" + span.End.In(cfg.location).Format(cfg.Formatting.TimeFormat)
+}
+
+// plural returns "1 meeting" or "2 meetings".
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func meetingSummary(report *timeAnalytics) string {
+	text := fmt.Sprintf("%s (%s)", plural(report.Meetings, "meeting"), formatDuration(report.MeetingTime))
+	if report.WorkingTime > 0 {
+		text += fmt.Sprintf(", %.0f%% of %s working hours", report.MeetingShare, formatDuration(report.WorkingTime))
+	}
+	return text
+}
+
+func timeAnalyticsText(report *timeAnalytics, cfg *Config) string {
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("📊 Time analytics for %s\n", periodTitle(report.Start, report.End)))
+	output.WriteString(strings.Repeat("=", 50) + "\n\n")
+	output.WriteString(fmt.Sprintf("🤝 Meetings: %s\n\n", meetingSummary(report)))
+
+	output.WriteString("🏷️  Time per category:\n")
+	if len(report.Categories) == 0 {
+		output.WriteString("   No events in this period.\n")
+	}
+	for _, category := range report.Categories {
+		output.WriteString(fmt.Sprintf("   %s %-16s %8s  (%s)\n", category.Emoji, category.Name, formatDuration(category.Time), plural(category.Events, "event")))
+	}
+
+	output.WriteString("\n📅 Per day:\n")
+	for _, day := range report.Days {
+		output.WriteString(fmt.Sprintf("   %s: %s (%s)", day.Day.Format("Mon Jan 2"), plural(day.Meetings, "meeting"), formatDuration(day.MeetingTime)))
+		if day.Workday {
+			output.WriteString(fmt.Sprintf(", longest free block %s", formatDuration(day.LongestFree.duration())))
+			if day.LongestFree.duration() > 0 {
+				output.WriteString(" (" + clockRange(day.LongestFree, cfg) + ")")
+			}
+		} else {
+			output.WriteString(", day off")
+		}
+		if streak := day.LongestStreak; streak.Meetings > 0 {
+			output.WriteString(fmt.Sprintf(", %d back-to-back %s", streak.Meetings, clockRange(streak.timeSpan, cfg)))
+		}
+		output.WriteString("\n")
+	}
+	return output.String()
+}
+
+func timeAnalyticsMarkdown(report *timeAnalytics, cfg *Config) string {
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("# Time analytics for %s\n\n", periodTitle(report.Start, report.End)))
+	output.WriteString(fmt.Sprintf("**Meetings:** %s\n\n", meetingSummary(report)))
+
+	output.WriteString("## Time per category\n\n")
+	output.WriteString("| Category | Hours | Events |\n|----------|------:|-------:|\n")
+	for _, category := range report.Categories {
+		output.WriteString(fmt.Sprintf("| %s %s | %.1f | %d |\n", category.Emoji, category.Name, category.Time.Hours(), category.Events))
+	}
+
+	output.WriteString("\n## Per day\n\n")
+	output.WriteString("| Day | Meetings | Meeting hours | Longest free block | Back-to-back |\n|-----|---------:|--------------:|--------------------|--------------|\n")
+	for _, day := range report.Days {
+		free := "day off"
+		if day.Workday {
+			free = formatDuration(day.LongestFree.duration())
+			if day.LongestFree.duration() > 0 {
+				free += " (" + clockRange(day.LongestFree, cfg) + ")"
+			}
+		}
+		streak := ""
+		if day.LongestStreak.Meetings > 0 {
+			streak = fmt.Sprintf("%d meetings %s", day.LongestStreak.Meetings, clockRange(day.LongestStreak.timeSpan, cfg))
+		}
+		output.WriteString(fmt.Sprintf("| %s | %d | %.1f | %s | %s |\n", day.Day.Format("Mon Jan 2"), day.Meetings, day.MeetingTime.Hours(), free, streak))
+	}
+	return output.String()
+}
+
+// analyticsJSON is the JSON form of the time analytics. Times are in
+// hours.
+type analyticsJSON struct {
+	From         string             `json:"from"`
+	To           string             `json:"to"`
+	Timezone     string             `json:"timezone"`
+	OfflineAsOf  *time.Time         `json:"offline_as_of,omitempty"`
+	Meetings     int                `json:"meetings"`
+	MeetingHours float64            `json:"meeting_hours"`
+	WorkingHours float64            `json:"working_hours"`
+	MeetingShare float64            `json:"meeting_percent"`
+	Categories   []categoryTimeJSON `json:"categories"`
+	Days         []dayAnalyticsJSON `json:"days"`
+}
+
+type categoryTimeJSON struct {
+	Name   string  `json:"name"`
+	Emoji  string  `json:"emoji,omitempty"`
+	Class  string  `json:"class,omitempty"`
+	Events int     `json:"events"`
+	Hours  float64 `json:"hours"`
+}
+
+type dayAnalyticsJSON struct {
+	Date             string      `json:"date"`
+	Workday          bool        `json:"workday"`
+	Meetings         int         `json:"meetings"`
+	MeetingHours     float64     `json:"meeting_hours"`
+	LongestFreeHours float64     `json:"longest_free_hours"`
+	LongestFree      *spanJSON   `json:"longest_free,omitempty"`
+	BackToBack       *streakJSON `json:"back_to_back,omitempty"`
+}
+
+type spanJSON struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type streakJSON struct {
+	spanJSON
+	Meetings int `json:"meetings"`
+}
+
+func timeAnalyticsJSON(report *timeAnalytics, cfg *Config) analyticsJSON {
+	data := analyticsJSON{
+		From:         report.Start.Format("2006-01-02"),
+		To:           report.End.AddDate(0, 0, -1).Format("2006-01-02"),
+		Timezone:     cfg.location.String(),
+		Meetings:     report.Meetings,
+		MeetingHours: hours(report.MeetingTime),
+		WorkingHours: hours(report.WorkingTime),
+		MeetingShare: math.Round(report.MeetingShare*10) / 10,
+		Categories:   []categoryTimeJSON{},
+	}
+	if !report.AsOf.IsZero() {
+		data.OfflineAsOf = &report.AsOf
+	}
+	for _, category := range report.Categories {
+		data.Categories = append(data.Categories, categoryTimeJSON{
+			Name:   category.Name,
+			Emoji:  category.Emoji,
+			Class:  category.Class,
+			Events: category.Events,
+			Hours:  hours(category.Time),
+		})
+	}
+	for _, day := range report.Days {
+		dayData := dayAnalyticsJSON{
+			Date:             day.Day.Format("2006-01-02"),
+			Workday:          day.Workday,
+			Meetings:         day.Meetings,
+			MeetingHours:     hours(day.MeetingTime),
+			LongestFreeHours: hours(day.LongestFree.duration()),
+		}
+		if day.LongestFree.duration() > 0 {
+			dayData.LongestFree = &spanJSON{day.LongestFree.Start, day.LongestFree.End}
+		}
+		if streak := day.LongestStreak; streak.Meetings > 0 {
+			dayData.BackToBack = &streakJSON{spanJSON{streak.Start, streak.End}, streak.Meetings}
+		}
+		data.Days = append(data.Days, dayData)
+	}
+	return data
+}
+
+// reportPeriod returns the days from and to, both included, as [start,
+// end). They default to the current week. Errors name the argument at
+// fault.
+func (cs *CalendarService) reportPeriod(from, to string) (start, end time.Time, err error) {
+	start = startOfWeek(cs.today())
+	if from != "" {
+		if start, err = cs.parseDate(from); err != nil {
+			return time.Time{}, time.Time{}, invalidArgument("from", "%v", err)
+		}
+	}
+	end = start.AddDate(0, 0, 7)
+	if to != "" {
+		last, err := cs.parseDate(to)
+		if err != nil {
+			return time.Time{}, time.Time{}, invalidArgument("to", "%v", err)
+		}
+		end = last.AddDate(0, 0, 1)
+	}
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, invalidArgument("to", "the period ends before it starts")
+	}
+	if daysBetween(start, end, cs.config.location) > maxAnalyticsDays {
+		return time.Time{}, time.Time{}, invalidArgument("to", "the period can't be longer than %d days", maxAnalyticsDays)
+	}
+	return start, end, nil
+}
+
+// Run stats mode - show where the time of a period went
+func runStatsMode(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	from := fs.String("from", "", "First day in YYYY-MM-DD format (default: Monday of this week)")
+	to := fs.String("to", "", "Last day in YYYY-MM-DD format (default: a week after --from)")
+	format := fs.String("format", formatText, "Output format: "+strings.Join(reportFormats, ", "))
+	parseFlags(fs, args)
+	if !containsFold(reportFormats, *format) {
+		log.Fatalf("Unknown format %q: use one of %s", *format, strings.Join(reportFormats, ", "))
+	}
+
+	cs, err := initCalendarService(cfg)
+	if err != nil {
+		log.Fatalf("Authentication failed: %v", err)
+	}
+	start, end, err := cs.reportPeriod(*from, *to)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	report, err := cs.timeAnalytics(context.Background(), start, end)
+	if err != nil {
+		log.Fatalf("Failed to get calendar events: %v", err)
+	}
+	output, err := formatTimeAnalytics(report, *format, cfg)
+	if err != nil {
+		log.Fatalf("Failed to format report: %v", err)
+	}
+	fmt.Println(strings.TrimRight(output, "\n"))
+}
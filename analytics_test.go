@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReportPeriodArguments(t *testing.T) {
+	cs := newFakeService(t, http.NotFoundHandler())
+	tests := []struct {
+		from, to string
+		argument string
+	}{
+		{"2024-13-01", "2024-12-31", "from"},
+		{"yesterday", "", "from"},
+		{"2024-12-01", "2024-12-32", "to"},
+		{"2024-12-10", "2024-12-01", "to"},
+		{"2024-01-01", "2024-12-31", "to"},
+		{"2024-12-01", "2024-12-07", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		_, _, err := cs.reportPeriod(tt.from, tt.to)
+		var te *toolError
+		switch {
+		case tt.argument == "" && err != nil:
+			t.Errorf("reportPeriod(%q, %q) failed: %v", tt.from, tt.to, err)
+		case tt.argument != "" && (!errors.As(err, &te) || te.Argument != tt.argument):
+			t.Errorf("reportPeriod(%q, %q) = %v, want an invalid %s", tt.from, tt.to, err, tt.argument)
+		}
+	}
+}
+
+func TestAnalyzeTime(t *testing.T) {
+	declined := testMeeting("declined", clockAt(2, "10:00"), clockAt(2, "11:00"))
+	declined.Attendees = []EventAttendee{{Email: "me@example.com", Self: true, ResponseStatus: "declined"}, {Email: "bob@example.com"}}
+	allDay := testMeeting("all-day", clockAt(2, "00:00"), clockAt(3, "00:00"))
+	allDay.IsAllDay = true
+
+	tests := []struct {
+		name               string
+		days               int
+		workStart, workEnd string
+		events             []CalendarEvent
+		meetings           int
+		dayMeetings        []int
+		meetingTime        time.Duration
+		share              float64
+		longestFree        []time.Duration
+		streak             int
+	}{
+		{
+			name: "overlapping", days: 1, workStart: "09:00", workEnd: "18:00",
+			events: []CalendarEvent{
+				testMeeting("standup", clockAt(2, "09:00"), clockAt(2, "09:30")),
+				testMeeting("review", clockAt(2, "09:30"), clockAt(2, "10:30")),
+				testMeeting("sync", clockAt(2, "10:00"), clockAt(2, "11:00")),
+			},
+			meetings: 3, dayMeetings: []int{3}, meetingTime: 2 * time.Hour, share: 100 * 2.0 / 9,
+			longestFree: []time.Duration{7 * time.Hour}, streak: 3,
+		},
+		{
+			name: "crossing midnight", days: 2, workStart: "09:00", workEnd: "18:00",
+			events: []CalendarEvent{
+				testMeeting("overnight", clockAt(2, "23:00"), clockAt(3, "01:00")),
+			},
+			meetings: 1, dayMeetings: []int{1, 1}, meetingTime: 2 * time.Hour,
+			longestFree: []time.Duration{9 * time.Hour, 9 * time.Hour},
+		},
+		{
+			name: "declined and all-day", days: 1, workStart: "09:00", workEnd: "18:00",
+			events:   []CalendarEvent{declined, allDay},
+			meetings: 0, dayMeetings: []int{0}, longestFree: []time.Duration{9 * time.Hour},
+		},
+		{
+			name: "working hours after noon", days: 1, workStart: "13:00", workEnd: "21:00",
+			events: []CalendarEvent{
+				testMeeting("morning", clockAt(2, "10:00"), clockAt(2, "11:00")),
+				testMeeting("afternoon", clockAt(2, "15:00"), clockAt(2, "16:00")),
+			},
+			meetings: 2, dayMeetings: []int{2}, meetingTime: 2 * time.Hour, share: 100 * 1.0 / 8,
+			longestFree: []time.Duration{5 * time.Hour},
+		},
+		{
+			name: "fully booked", days: 1, workStart: "09:00", workEnd: "18:00",
+			events: []CalendarEvent{
+				testMeeting("morning", clockAt(2, "08:00"), clockAt(2, "13:00")),
+				testMeeting("afternoon", clockAt(2, "13:00"), clockAt(2, "19:00")),
+			},
+			meetings: 2, dayMeetings: []int{2}, meetingTime: 11 * time.Hour, share: 100,
+			longestFree: []time.Duration{0}, streak: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := clockAt(2, "00:00")
+			report := analyzeTime(tt.events, start, start.AddDate(0, 0, tt.days), time.Time{}, testConfig(tt.workStart, tt.workEnd))
+			if report.Meetings != tt.meetings || report.MeetingTime != tt.meetingTime {
+				t.Errorf("%d meetings in %v, want %d in %v", report.Meetings, report.MeetingTime, tt.meetings, tt.meetingTime)
+			}
+			if math.Abs(report.MeetingShare-tt.share) > 0.01 {
+				t.Errorf("meeting share %.2f%%, want %.2f%%", report.MeetingShare, tt.share)
+			}
+			if len(report.Days) != tt.days {
+				t.Fatalf("%d days, want %d", len(report.Days), tt.days)
+			}
+			for i, day := range report.Days {
+				if day.Meetings != tt.dayMeetings[i] || day.LongestFree.duration() != tt.longestFree[i] {
+					t.Errorf("day %d: %d meetings, longest free %v; want %d, %v",
+						i, day.Meetings, day.LongestFree.duration(), tt.dayMeetings[i], tt.longestFree[i])
+				}
+			}
+			if streak := report.Days[0].LongestStreak.Meetings; streak != tt.streak {
+				t.Errorf("longest streak of %d meetings, want %d", streak, tt.streak)
+			}
+		})
+	}
+}
+
+func TestFreeBlocks(t *testing.T) {
+	span := func(from, to string) timeSpan { return timeSpan{clockAt(2, from), clockAt(2, to)} }
+	work := span("09:00", "18:00")
+	tests := []struct {
+		name string
+		busy []timeSpan
+		want []timeSpan
+	}{
+		{"free day", nil, []timeSpan{work}},
+		{"overlapping", []timeSpan{span("10:00", "11:00"), span("10:30", "12:00")}, []timeSpan{span("09:00", "10:00"), span("12:00", "18:00")}},
+		{"unsorted", []timeSpan{span("15:00", "16:00"), span("10:00", "11:00")}, []timeSpan{span("09:00", "10:00"), span("11:00", "15:00"), span("16:00", "18:00")}},
+		{"outside working hours", []timeSpan{span("07:00", "08:00"), span("19:00", "20:00")}, []timeSpan{work}},
+		{"across the start", []timeSpan{{clockAt(1, "23:00"), clockAt(2, "10:00")}}, []timeSpan{span("10:00", "18:00")}},
+		{"fully booked", []timeSpan{span("08:00", "13:00"), span("13:00", "19:00")}, nil},
+	}
+	for _, tt := range tests {
+		if got := freeBlocks(tt.busy, work); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: freeBlocks = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLongestStreak(t *testing.T) {
+	span := func(from, to string) timeSpan { return timeSpan{clockAt(2, from), clockAt(2, to)} }
+	tests := []struct {
+		name     string
+		meetings []timeSpan
+		want     meetingStreak
+	}{
+		{"none", nil, meetingStreak{}},
+		{"single", []timeSpan{span("09:00", "10:00")}, meetingStreak{}},
+		{"short break", []timeSpan{span("09:00", "10:00"), span("10:05", "11:00")}, meetingStreak{span("09:00", "11:00"), 2}},
+		{"long break", []timeSpan{span("09:00", "10:00"), span("10:06", "11:00")}, meetingStreak{}},
+		{"overlapping", []timeSpan{span("09:00", "11:00"), span("09:30", "10:00"), span("11:00", "12:00")}, meetingStreak{span("09:00", "12:00"), 3}},
+		{"most meetings", []timeSpan{span("09:00", "12:00"), span("12:00", "13:00"), span("14:00", "14:30"), span("14:30", "15:00"), span("15:00", "15:30")}, meetingStreak{span("14:00", "15:30"), 3}},
+		{"longest tie", []timeSpan{span("14:00", "14:30"), span("14:30", "15:00"), span("09:00", "10:00"), span("10:00", "11:00")}, meetingStreak{span("09:00", "11:00"), 2}},
+	}
+	for _, tt := range tests {
+		if got := longestStreak(tt.meetings); got != tt.want {
+			t.Errorf("%s: longestStreak = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -16,24 +16,35 @@ import (
 )
 
 // Retrieve a token, saves the token, then returns the generated client.
-func getClient(config *oauth2.Config) *http.Client {
-	// The file token.json stores the user's access and refresh tokens.
-	tokFile := "token.json"
-	tok, err := tokenFromFile(tokFile)
+func getClient(config *oauth2.Config, cfg *Config) *http.Client {
+	// The token file stores the user's access and refresh tokens.
+	tokFile := cfg.tokenPath()
+	if tokFile == "" {
+		tokFile = defaultTokenFile
+	}
+	store, err := newTokenStore(tokFile)
+	if err != nil {
+		log.Fatalf("Unable to open token store: %v", err)
+	}
+	tok, err := store.Load()
 	if err != nil {
-		tok = getTokenFromWeb(config)
-		saveToken(tokFile, tok)
+		var decryptErr *tokenDecryptError
+		if errors.As(err, &decryptErr) {
+			log.Fatal(err)
+		}
+		tok = getTokenFromWeb(config, cfg.Auth.OAuthPort)
+		saveToken(store, tok)
 	}
 	return config.Client(context.Background(), tok)
 }
 
 // Request a token from the web, then returns the retrieved token.
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
+func getTokenFromWeb(config *oauth2.Config, port int) *oauth2.Token {
 	// Start a local HTTP server to handle the callback
 	codeCh := make(chan string)
 	errCh := make(chan error)
 
-	server := &http.Server{Addr: ":8080"}
+	server := &http.Server{Addr: fmt.Sprintf(":%d", port)}
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		code := r.URL.Query().Get("code")
@@ -63,7 +74,7 @@ func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
 	}()
 
 	// Update the redirect URI to match our local server
-	config.RedirectURL = "http://localhost:8080"
+	config.RedirectURL = fmt.Sprintf("http://localhost:%d", port)
 
 	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
 	fmt.Printf("Opening browser for authorization...\n")
@@ -112,37 +123,37 @@ func openBrowser(url string) {
 	}
 }
 
-// Retrieves a token from a local file.
-func tokenFromFile(file string) (*oauth2.Token, error) {
-	f, err := os.Open(file)
-	if err != nil {
-		return nil, err
+// Saves a token to the token store.
+func saveToken(store *tokenStore, token *oauth2.Token) {
+	if store.encrypted() {
+		fmt.Printf("Saving encrypted credential file to: %s\n", store.path)
+	} else {
+		fmt.Printf("Saving credential file to: %s\n", store.path)
 	}
-	defer f.Close()
-	tok := &oauth2.Token{}
-	err = json.NewDecoder(f).Decode(tok)
-	return tok, err
-}
-
-// Saves a token to a file path.
-func saveToken(path string, token *oauth2.Token) {
-	fmt.Printf("Saving credential file to: %s\n", path)
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
+	if err := store.Save(token); err != nil {
 		log.Fatalf("Unable to cache oauth token: %v", err)
 	}
-	defer f.Close()
-	json.NewEncoder(f).Encode(token)
 }
 
-func getClientFromExistingToken(config *oauth2.Config) (*http.Client, error) {
-	execPath, err := os.Executable()
+func getClientFromExistingToken(config *oauth2.Config, tokenPath string) (*http.Client, error) {
+	if tokenPath == "" {
+		// Default to the token next to the executable
+		execPath, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("unable to determine executable path: %v", err)
+		}
+		tokenPath = filepath.Join(filepath.Dir(execPath), defaultTokenFile)
+	}
+	store, err := newTokenStore(tokenPath)
 	if err != nil {
-		return nil, fmt.Errorf("unable to determine executable path: %v", err)
+		return nil, err
 	}
-	tokenPath := filepath.Join(filepath.Dir(execPath), "token.json")
-	tok, err := tokenFromFile(tokenPath)
+	tok, err := store.Load()
 	if err != nil {
+		var decryptErr *tokenDecryptError
+		if errors.As(err, &decryptErr) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("unable to load existing token from %s: %v. Please run 'agenda-mcp text' first", tokenPath, err)
 	}
 	// Use the config passed as parameter to create the client with the loaded token
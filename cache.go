@@ -0,0 +1,590 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// CacheConfig controls the local event cache, which is off by default as
+// it stores events unencrypted. Events from past_days ago to future_days
+// ahead are kept, and synced again once older than max_age.
+type CacheConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	Path       string        `yaml:"path,omitempty"`
+	MaxAge     time.Duration `yaml:"max_age"`
+	PastDays   int           `yaml:"past_days"`
+	FutureDays int           `yaml:"future_days"`
+	// How long superseded snapshots are kept for "changes --since"
+	HistoryDays int `yaml:"history_days"`
+}
+
+// path returns the cache file, by default in the user's cache directory.
+func (cc CacheConfig) path() string {
+	if cc.Path != "" {
+		return expandHome(cc.Path)
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "agenda-mcp", "cache.db")
+}
+
+// cacheLockTimeout is how long to wait for another agenda-mcp process
+// using the cache file.
+var cacheLockTimeout = 2 * time.Second
+
+var stateKey = []byte("state")
+var eventsBucket = []byte("events")
+
+// errCacheLocked is returned when another agenda-mcp process, usually a
+// running MCP server, holds the cache file.
+var errCacheLocked = errors.New("the cache is locked by another agenda-mcp process")
+
+// eventCache stores the events of each user's calendars in a bbolt file.
+// An MCP server keeps the file open for its lifetime; short CLI runs open
+// it for each operation, and read from Google while a server holds it.
+//
+// Layout: one bucket per owner, holding one bucket per calendar with its
+// sync state and an events bucket of API events keyed by ID.
+type eventCache struct {
+	path string
+	mu   sync.Mutex
+	// db is set while the file is kept open, and locked once another
+	// process was found holding it
+	db     *bolt.DB
+	locked bool
+	// decoded holds the events of each calendar, by owner and calendar,
+	// while the file is kept open and no other process can change it.
+	// generation counts the writes, so a read that raced with one isn't
+	// kept.
+	decoded    map[string][]*calendar.Event
+	generation uint64
+}
+
+var (
+	cachesMu sync.Mutex
+	caches   = make(map[string]*eventCache)
+)
+
+// cache returns the event cache, or nil if it is disabled. Every user of
+// the same file shares one instance.
+func (c *Config) cache() *eventCache {
+	if !c.Cache.Enabled {
+		return nil
+	}
+	path := c.Cache.path()
+	if path == "" {
+		return nil
+	}
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+	if cache, ok := caches[path]; ok {
+		return cache
+	}
+	cache := &eventCache{path: path}
+	caches[path] = cache
+	return cache
+}
+
+func (c *eventCache) open() (*bolt.DB, error) {
+	if c.locked {
+		return nil, fmt.Errorf("%w: %s", errCacheLocked, c.path)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return nil, fmt.Errorf("unable to create cache directory: %v", err)
+	}
+	db, err := bolt.Open(c.path, 0600, &bolt.Options{Timeout: cacheLockTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		// Don't wait for the lock again on every operation
+		c.locked = true
+		return nil, fmt.Errorf("%w: %s", errCacheLocked, c.path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open cache %s: %v", c.path, err)
+	}
+	return db, nil
+}
+
+// keepOpen opens the file until close, for a long-running server. bbolt
+// then handles concurrent readers itself.
+func (c *eventCache) keepOpen() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db != nil {
+		return nil
+	}
+	db, err := c.open()
+	if err != nil {
+		return err
+	}
+	c.db = db
+	c.decoded = make(map[string][]*calendar.Event)
+	return nil
+}
+
+// close closes a file kept open.
+func (c *eventCache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == nil {
+		return nil
+	}
+	err := c.db.Close()
+	c.db, c.decoded = nil, nil
+	return err
+}
+
+// run runs fn in a transaction, opening the file unless it is kept open.
+func (c *eventCache) run(writable bool, fn func(tx *bolt.Tx) error) error {
+	c.mu.Lock()
+	if db := c.db; db != nil {
+		c.mu.Unlock()
+		if writable {
+			return db.Update(fn)
+		}
+		return db.View(fn)
+	}
+	defer c.mu.Unlock()
+	db, err := c.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if writable {
+		return db.Update(fn)
+	}
+	return db.View(fn)
+}
+
+func (c *eventCache) view(fn func(tx *bolt.Tx) error) error {
+	return c.run(false, fn)
+}
+
+func (c *eventCache) update(fn func(tx *bolt.Tx) error) error {
+	return c.run(true, fn)
+}
+
+// remembered returns the decoded events of a calendar, if kept, and the
+// generation to remember them at otherwise.
+func (c *eventCache) remembered(owner, calendarID string) ([]*calendar.Event, bool, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	items, ok := c.decoded[owner+"\x00"+calendarID]
+	return items, ok, c.generation
+}
+
+// remember keeps the decoded events of a calendar read at generation,
+// while the file is open and unless it was written since.
+func (c *eventCache) remember(owner, calendarID string, items []*calendar.Event, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.decoded != nil && c.generation == generation {
+		c.decoded[owner+"\x00"+calendarID] = items
+	}
+}
+
+// forget drops the decoded events of an owner's calendar, or of all of
+// them when calendarID is empty.
+func (c *eventCache) forget(owner, calendarID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for key := range c.decoded {
+		if key == owner+"\x00"+calendarID || calendarID == "" && strings.HasPrefix(key, owner+"\x00") {
+			delete(c.decoded, key)
+		}
+	}
+}
+
+// calendarState is the sync state of a cached calendar. Events are cached
+// for [From, To).
+type calendarState struct {
+	SyncToken string    `json:"sync_token,omitempty"`
+	SyncedAt  time.Time `json:"synced_at"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+}
+
+// covers reports whether the cached window contains [start, end).
+func (s calendarState) covers(start, end time.Time) bool {
+	return !s.SyncedAt.IsZero() && !start.Before(s.From) && !end.After(s.To)
+}
+
+func calendarBucket(tx *bolt.Tx, owner, calendarID string) *bolt.Bucket {
+	if ownerBucket := tx.Bucket([]byte(owner)); ownerBucket != nil {
+		return ownerBucket.Bucket([]byte(calendarID))
+	}
+	return nil
+}
+
+// state returns the sync state of a calendar, zero if it was never synced.
+func (c *eventCache) state(owner, calendarID string) (calendarState, error) {
+	var state calendarState
+	err := c.view(func(tx *bolt.Tx) error {
+		if b := calendarBucket(tx, owner, calendarID); b != nil {
+			return json.Unmarshal(b.Get(stateKey), &state)
+		}
+		return nil
+	})
+	return state, err
+}
+
+// store saves the result of a sync. A full sync replaces the cached
+// events; an incremental one updates them, dropping cancelled events.
+func (c *eventCache) store(owner, calendarID string, state calendarState, items []*calendar.Event, full bool) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	defer c.forget(owner, calendarID)
+	return c.update(func(tx *bolt.Tx) error {
+		ownerBucket, err := tx.CreateBucketIfNotExists([]byte(owner))
+		if err != nil {
+			return err
+		}
+		if full && ownerBucket.Bucket([]byte(calendarID)) != nil {
+			if err := ownerBucket.DeleteBucket([]byte(calendarID)); err != nil {
+				return err
+			}
+		}
+		b, err := ownerBucket.CreateBucketIfNotExists([]byte(calendarID))
+		if err != nil {
+			return err
+		}
+		events, err := b.CreateBucketIfNotExists(eventsBucket)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if item.Status == "cancelled" {
+				if err := events.Delete([]byte(item.Id)); err != nil {
+					return err
+				}
+				continue
+			}
+			value, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if err := events.Put([]byte(item.Id), value); err != nil {
+				return err
+			}
+		}
+		return b.Put(stateKey, data)
+	})
+}
+
+// items returns every cached event of a calendar. The events are shared
+// and must not be changed.
+func (c *eventCache) items(owner, calendarID string) ([]*calendar.Event, error) {
+	items, ok, generation := c.remembered(owner, calendarID)
+	if ok {
+		return items, nil
+	}
+	err := c.view(func(tx *bolt.Tx) error {
+		b := calendarBucket(tx, owner, calendarID)
+		if b == nil || b.Bucket(eventsBucket) == nil {
+			return nil
+		}
+		return b.Bucket(eventsBucket).ForEach(func(k, v []byte) error {
+			var item calendar.Event
+			if err := json.Unmarshal(v, &item); err != nil {
+				return err
+			}
+			items = append(items, &item)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.remember(owner, calendarID, items, generation)
+	return items, nil
+}
+
+// item returns one cached event.
+func (c *eventCache) item(owner, calendarID, eventID string) (*calendar.Event, bool, error) {
+	var item *calendar.Event
+	err := c.view(func(tx *bolt.Tx) error {
+		b := calendarBucket(tx, owner, calendarID)
+		if b == nil || b.Bucket(eventsBucket) == nil {
+			return nil
+		}
+		if v := b.Bucket(eventsBucket).Get([]byte(eventID)); v != nil {
+			item = &calendar.Event{}
+			return json.Unmarshal(v, item)
+		}
+		return nil
+	})
+	return item, item != nil, err
+}
+
+// clear removes the cached calendars of an owner.
+func (c *eventCache) clear(owner string) error {
+	defer c.forget(owner, "")
+	return c.update(func(tx *bolt.Tx) error {
+		if snapshots := tx.Bucket(snapshotsBucket); snapshots != nil && snapshots.Bucket([]byte(owner)) != nil {
+			if err := snapshots.DeleteBucket([]byte(owner)); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket([]byte(owner)) == nil {
+			return nil
+		}
+		return tx.DeleteBucket([]byte(owner))
+	})
+}
+
+// cachedCalendar describes a cached calendar for "cache status".
+type cachedCalendar struct {
+	ID     string
+	State  calendarState
+	Events int
+}
+
+func (c *eventCache) status(owner string) ([]cachedCalendar, error) {
+	var calendars []cachedCalendar
+	err := c.view(func(tx *bolt.Tx) error {
+		ownerBucket := tx.Bucket([]byte(owner))
+		if ownerBucket == nil {
+			return nil
+		}
+		return ownerBucket.ForEachBucket(func(k []byte) error {
+			b := ownerBucket.Bucket(k)
+			entry := cachedCalendar{ID: string(k)}
+			if err := json.Unmarshal(b.Get(stateKey), &entry.State); err != nil {
+				return err
+			}
+			if events := b.Bucket(eventsBucket); events != nil {
+				entry.Events = events.Stats().KeyN
+			}
+			calendars = append(calendars, entry)
+			return nil
+		})
+	})
+	return calendars, err
+}
+
+// cacheWindow is the period kept in the cache as of now.
+func (cs *CalendarService) cacheWindow() (from, to time.Time) {
+	today, _ := cs.parseDate(time.Now().In(cs.config.location).Format("2006-01-02"))
+	return today.AddDate(0, 0, -cs.config.Cache.PastDays), today.AddDate(0, 0, cs.config.Cache.FutureDays+1)
+}
+
+// cachedEvents returns the cached events of a calendar overlapping
+// [start, end), syncing the calendar first if the cache is older than
+// max_age. ok is false if the cache is disabled, locked by another
+// process or doesn't cover the window, in which case the caller should
+// ask Google.
+func (cs *CalendarService) cachedEvents(ctx context.Context, calendarID string, start, end time.Time) (items []*calendar.Event, ok bool, err error) {
+	if cs.cache == nil {
+		return nil, false, nil
+	}
+	if from, to := cs.cacheWindow(); start.Before(from) || end.After(to) {
+		return nil, false, nil
+	}
+	state, err := cs.syncCalendar(ctx, calendarID, false)
+	if errors.Is(err, errCacheLocked) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !state.covers(start, end) {
+		return nil, false, nil
+	}
+
+	items, err = cs.cachedItems(calendarID, start, end)
+	if err != nil {
+		return nil, false, err
+	}
+	return items, true, nil
+}
+
+// cachedItems returns the cached events of a calendar overlapping
+// [start, end) in chronological order, however old the cache is.
+func (cs *CalendarService) cachedItems(calendarID string, start, end time.Time) ([]*calendar.Event, error) {
+	all, err := cs.cache.items(cs.owner, calendarID)
+	if err != nil {
+		return nil, err
+	}
+	var items []*calendar.Event
+	for _, item := range all {
+		if eventStart, eventEnd, ok := cs.eventTimes(item); ok && eventStart.Before(end) && eventEnd.After(start) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, _, _ := cs.eventTimes(items[i])
+		b, _, _ := cs.eventTimes(items[j])
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return items[i].Id < items[j].Id
+	})
+	return items, nil
+}
+
+// syncCalendar brings the cached events of a calendar up to date unless
+// they were synced less than max_age ago (or force is set). Changes are
+// fetched with the sync token of the previous sync. A full sync is done
+// the first time, when Google expires the token, and once a day as the
+// cached window moves forward.
+//
+// Google rejects timeMin and timeMax along with a sync token, as the
+// token already carries the window of the full sync. Changes still come
+// for the whole calendar, so those outside the window are dropped.
+func (cs *CalendarService) syncCalendar(ctx context.Context, calendarID string, force bool) (calendarState, error) {
+	cs.syncMu.Lock()
+	defer cs.syncMu.Unlock()
+
+	state, err := cs.cache.state(cs.owner, calendarID)
+	if err != nil {
+		return calendarState{}, err
+	}
+	if !force && !state.SyncedAt.IsZero() && time.Since(state.SyncedAt) < cs.config.Cache.MaxAge {
+		return state, nil
+	}
+
+	from, to := cs.cacheWindow()
+	full := state.SyncToken == "" || to.Sub(state.To) >= 24*time.Hour
+	var items []*calendar.Event
+	next := calendarState{From: state.From, To: state.To}
+	if !full {
+		items, next.SyncToken, err = cs.listEvents(ctx, calendarID, func(call *calendar.EventsListCall) *calendar.EventsListCall {
+			return call.SyncToken(state.SyncToken)
+		})
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusGone {
+			// The sync token expired: start over
+			full = true
+		} else if err != nil {
+			return calendarState{}, fmt.Errorf("unable to sync %s: %w", calendarID, err)
+		}
+		for i, item := range items {
+			if start, end, ok := cs.eventTimes(item); item.Status != "cancelled" && (!ok || !start.Before(next.To) || !end.After(next.From)) {
+				// Also removes an event moved out of the window
+				items[i] = &calendar.Event{Id: item.Id, Status: "cancelled"}
+			}
+		}
+	}
+	if full {
+		next = calendarState{From: from, To: to}
+		items, next.SyncToken, err = cs.listEvents(ctx, calendarID, func(call *calendar.EventsListCall) *calendar.EventsListCall {
+			return call.TimeMin(from.Format(time.RFC3339)).TimeMax(to.Format(time.RFC3339))
+		})
+		if err != nil {
+			return calendarState{}, fmt.Errorf("unable to sync %s: %w", calendarID, err)
+		}
+	}
+
+	next.SyncedAt = time.Now()
+	if err := cs.cache.store(cs.owner, calendarID, next, items, full); err != nil {
+		return calendarState{}, err
+	}
+	return next, nil
+}
+
+// listEvents fetches every page of an events list with expanded recurring
+// events, returning the items and the token for the next incremental sync.
+// Full and incremental syncs share these parameters, as Google requires.
+func (cs *CalendarService) listEvents(ctx context.Context, calendarID string, configure func(*calendar.EventsListCall) *calendar.EventsListCall) ([]*calendar.Event, string, error) {
+	var items []*calendar.Event
+	pageToken := ""
+	for {
+		call := configure(cs.service.Events.List(calendarID).SingleEvents(true).MaxResults(2500))
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+		callCtx, cancel := cs.callContext(ctx)
+		events, err := call.Context(callCtx).Do()
+		cancel()
+		if err != nil {
+			return nil, "", err
+		}
+		items = append(items, events.Items...)
+		if events.NextPageToken == "" {
+			return items, events.NextSyncToken, nil
+		}
+		pageToken = events.NextPageToken
+	}
+}
+
+// runCacheMode handles the "cache" subcommands.
+func runCacheMode(cfg *Config, args []string) {
+	if len(args) == 0 {
+		printCacheUsage()
+	}
+	cache := cfg.cache()
+	if cache == nil {
+		fmt.Println("The event cache is disabled (cache.enabled: false).")
+		return
+	}
+	owner := accountCacheOwner(cfg)
+
+	switch args[0] {
+	case "status":
+		calendars, err := cache.status(owner)
+		if err != nil {
+			log.Fatalf("Failed to read the cache: %v", err)
+		}
+		fmt.Printf("🗄️ Cache: %s (max age %s)\n", cache.path, cfg.Cache.MaxAge)
+		if len(calendars) == 0 {
+			fmt.Printf("No calendars of account %s are cached yet.\n", cfg.account.Name)
+			return
+		}
+		for _, entry := range calendars {
+			fmt.Printf("📅 %s: %d events from %s to %s, synced %s ago\n", entry.ID, entry.Events,
+				entry.State.From.Format("2006-01-02"), entry.State.To.AddDate(0, 0, -1).Format("2006-01-02"),
+				time.Since(entry.State.SyncedAt).Round(time.Second))
+		}
+	case "clear":
+		if err := cache.clear(owner); err != nil {
+			log.Fatalf("Failed to clear the cache: %v", err)
+		}
+		fmt.Printf("✅ Cleared the cached events of account %s.\n", cfg.account.Name)
+	case "sync":
+		cs, err := initCalendarService(cfg)
+		if err != nil {
+			log.Fatalf("Authentication failed: %v", err)
+		}
+		for _, calendarID := range cfg.calendars() {
+			state, err := cs.syncCalendar(context.Background(), calendarID, true)
+			if err != nil {
+				log.Fatalf("Failed to sync %s: %v", calendarID, err)
+			}
+			fmt.Printf("✅ Synced %s (%s to %s)\n", calendarID,
+				state.From.Format("2006-01-02"), state.To.AddDate(0, 0, -1).Format("2006-01-02"))
+		}
+	default:
+		printCacheUsage()
+	}
+}
+
+func printCacheUsage() {
+	fmt.Println("Usage: agenda-mcp cache status|clear|sync")
+	fmt.Println("  status - Show the cached calendars and when they were synced")
+	fmt.Println("  clear  - Delete the cached events of the account")
+	fmt.Println("  sync   - Sync the account's calendars now")
+	os.Exit(1)
+}
+
+// accountCacheOwner is the cache owner of the configured account.
+func accountCacheOwner(cfg *Config) string {
+	return "account:" + cfg.account.Name
+}
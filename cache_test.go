@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/api/calendar/v3"
+)
+
+// syncAPI is a Google calendar supporting incremental sync: its sync
+// tokens are the version of the calendar they were handed out at.
+type syncAPI struct {
+	mu      sync.Mutex
+	version int
+	events  map[string]*calendar.Event
+	changed map[string]int
+	queries []string
+}
+
+func newSyncAPI() *syncAPI {
+	return &syncAPI{events: make(map[string]*calendar.Event), changed: make(map[string]int)}
+}
+
+// put adds or changes an event, as another client of the calendar would.
+func (api *syncAPI) put(event *calendar.Event) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.version++
+	api.events[event.Id] = event
+	api.changed[event.Id] = api.version
+}
+
+func (api *syncAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	query := r.URL.Query()
+	api.queries = append(api.queries, r.URL.RawQuery)
+
+	since := -1
+	if token := query.Get("syncToken"); token != "" {
+		if query.Has("timeMin") || query.Has("timeMax") {
+			http.Error(w, `{"error":{"code":400,"message":"Sync token with a time range"}}`, http.StatusBadRequest)
+			return
+		}
+		since, _ = strconv.Atoi(strings.TrimPrefix(token, "v"))
+	}
+	events := &calendar.Events{Items: []*calendar.Event{}, NextSyncToken: fmt.Sprintf("v%d", api.version)}
+	for id, event := range api.events {
+		if api.changed[id] > since {
+			events.Items = append(events.Items, event)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// syncQueries returns the queries of the cache's syncs, which expand
+// recurring events unlike the watcher's.
+func (api *syncAPI) syncQueries() []string {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	var queries []string
+	for _, query := range api.queries {
+		if strings.Contains(query, "singleEvents=true") {
+			queries = append(queries, query)
+		}
+	}
+	return queries
+}
+
+func timedEvent(id string, start time.Time) *calendar.Event {
+	return &calendar.Event{
+		Id:      id,
+		Summary: id,
+		Start:   &calendar.EventDateTime{DateTime: start.Format(time.RFC3339)},
+		End:     &calendar.EventDateTime{DateTime: start.Add(time.Hour).Format(time.RFC3339)},
+	}
+}
+
+// newCachedFakeService returns a fake service with an event cache of its own.
+func newCachedFakeService(t *testing.T, handler http.Handler) *CalendarService {
+	cs := newFakeService(t, handler)
+	cs.config.Cache.Enabled = true
+	cs.config.Cache.Path = filepath.Join(t.TempDir(), "cache.db")
+	cs.cache = cs.config.cache()
+	cs.owner = "test"
+	return cs
+}
+
+func cachedIDs(t *testing.T, cs *CalendarService, start, end time.Time) []string {
+	t.Helper()
+	items, ok, err := cs.cachedEvents(context.Background(), "primary", start, end)
+	if err != nil || !ok {
+		t.Fatalf("reading the cache: %v, %v", ok, err)
+	}
+	var ids []string
+	for _, item := range items {
+		ids = append(ids, item.Id)
+	}
+	return ids
+}
+
+func TestWatcherChangesSyncCache(t *testing.T) {
+	api := newSyncAPI()
+	cs := newCachedFakeService(t, api)
+	from, to := cs.cacheWindow()
+	tomorrow := from.AddDate(0, 0, cs.config.Cache.PastDays+1).Add(9 * time.Hour)
+	api.put(timedEvent("standup", tomorrow))
+
+	if ids := cachedIDs(t, cs, from, to); fmt.Sprint(ids) != "[standup]" {
+		t.Fatalf("first read: %v", ids)
+	}
+	watcher := newCalendarWatcher(cs)
+	if _, _, err := watcher.changes(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	api.put(timedEvent("review", tomorrow.Add(2*time.Hour)))
+	api.put(timedEvent("far-away", to.AddDate(1, 0, 0)))
+	changed, _, err := watcher.changes(context.Background())
+	if err != nil || len(changed) != 2 {
+		t.Fatalf("watcher changes: %d, %v", len(changed), err)
+	}
+	// Well within max_age, the cache must not hide what the watcher saw
+	if ids := cachedIDs(t, cs, from, to); fmt.Sprint(ids) != "[standup review]" {
+		t.Errorf("read after the watcher's changes: %v, want [standup review]", ids)
+	}
+	if stored, _ := cs.cache.items(cs.owner, "primary"); len(stored) != 2 {
+		t.Errorf("cache holds %d events, want the 2 in its window", len(stored))
+	}
+}
+
+func TestSyncParameters(t *testing.T) {
+	api := newSyncAPI()
+	cs := newCachedFakeService(t, api)
+	from, _ := cs.cacheWindow()
+	api.put(timedEvent("standup", from.Add(9*time.Hour)))
+
+	for i := 0; i < 2; i++ {
+		if _, err := cs.syncCalendar(context.Background(), "primary", true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	queries := api.syncQueries()
+	if len(queries) != 2 {
+		t.Fatalf("got %d syncs, want 2", len(queries))
+	}
+	// Google rejects a time range with a sync token, and expects every
+	// other parameter to stay the same
+	strip := func(query string, names ...string) string {
+		values, _ := url.ParseQuery(query)
+		for _, name := range names {
+			values.Del(name)
+		}
+		return values.Encode()
+	}
+	full := strip(queries[0], "timeMin", "timeMax")
+	incremental := strip(queries[1], "syncToken")
+	if full != incremental {
+		t.Errorf("incremental sync %q doesn't match full sync %q", incremental, full)
+	}
+	if !strings.Contains(queries[0], "timeMin=") || !strings.Contains(queries[0], "timeMax=") {
+		t.Errorf("full sync without its window: %q", queries[0])
+	}
+}
+
+func TestCacheKeptOpen(t *testing.T) {
+	api := newSyncAPI()
+	cs := newCachedFakeService(t, api)
+	if err := cs.cache.keepOpen(); err != nil {
+		t.Fatal(err)
+	}
+	defer cs.cache.close()
+	from, to := cs.cacheWindow()
+	api.put(timedEvent("standup", from.AddDate(0, 0, 1).Add(9*time.Hour)))
+
+	if ids := cachedIDs(t, cs, from, to); fmt.Sprint(ids) != "[standup]" {
+		t.Fatalf("first read: %v", ids)
+	}
+	first, _ := cs.cache.items(cs.owner, "primary")
+	second, _ := cs.cache.items(cs.owner, "primary")
+	if len(first) != 1 || first[0] != second[0] {
+		t.Error("events decoded again while the cache is kept open")
+	}
+
+	// A sync replaces the decoded events
+	api.put(timedEvent("review", from.AddDate(0, 0, 1).Add(11*time.Hour)))
+	if _, err := cs.syncCalendar(context.Background(), "primary", true); err != nil {
+		t.Fatal(err)
+	}
+	if ids := cachedIDs(t, cs, from, to); fmt.Sprint(ids) != "[standup review]" {
+		t.Errorf("read after a sync: %v, want [standup review]", ids)
+	}
+	if err := cs.cache.clear(cs.owner); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := cs.cache.items(cs.owner, "primary"); len(stored) != 0 {
+		t.Errorf("%d events left after clearing the cache", len(stored))
+	}
+}
+
+func TestLockedCacheReadsFromGoogle(t *testing.T) {
+	defer func(timeout time.Duration) { cacheLockTimeout = timeout }(cacheLockTimeout)
+	cacheLockTimeout = 50 * time.Millisecond
+
+	api := newSyncAPI()
+	cs := newCachedFakeService(t, api)
+	from, to := cs.cacheWindow()
+	api.put(timedEvent("standup", from.AddDate(0, 0, 1).Add(9*time.Hour)))
+
+	// Another process, such as a running server, holds the file
+	server, err := bolt.Open(cs.config.Cache.Path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	events, _, err := cs.getAgenda(context.Background(), from, to)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("agenda with a locked cache: %d events, %v", len(events), err)
+	}
+	if _, err := cs.cache.status(cs.owner); !errors.Is(err, errCacheLocked) {
+		t.Errorf("status of a locked cache: %v", err)
+	}
+}
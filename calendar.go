@@ -3,153 +3,154 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
-// Custom color mapping based on your actual Google Calendar categories
-var customColorMap = map[string]map[string]string{
-	"1":  {"name": "Lavender", "emoji": "🟣"},                // Default fallback
-	"2":  {"name": "Focus Time", "emoji": "🟢"},              // Green
-	"3":  {"name": "Internal Group Meetings", "emoji": "🟣"}, // Purple
-	"4":  {"name": "External Meetings", "emoji": "🔴"},       // Red
-	"5":  {"name": "1:1", "emoji": "🟡"},                     // Yellow/Orange
-	"6":  {"name": "Estaff", "emoji": "🔴"},                  // Light red/orange
-	"7":  {"name": "Personal", "emoji": "🔵"},                // Blue
-	"8":  {"name": "Reminders", "emoji": "⚫"},               // Gray
-	"9":  {"name": "Travel", "emoji": "🟠"},                  // Orange/Red
-	"10": {"name": "NotWorking", "emoji": "🟢"},              // Green
-	"11": {"name": "External Meetings", "emoji": "🔴"},       // Red
-}
-
 type CalendarService struct {
 	service          *calendar.Service
 	colorDefinitions map[string]calendar.ColorDefinition
+	config           *Config
+	// Cached events are stored under owner, the account or user
+	cache  *eventCache
+	owner  string
+	syncMu sync.Mutex
+	// Recurring series looked up for their rule, by calendar and ID
+	seriesMu sync.Mutex
+	series   map[string]recurringSeries
 }
 
 // CalendarEvent represents a simplified calendar event
 type CalendarEvent struct {
-	Summary     string
-	StartTime   string
-	EndTime     string
-	Location    string
-	Description string
-	ColorName   string
-	ColorEmoji  string
-	IsAllDay    bool
+	ID            string    `json:"id"`
+	CalendarID    string    `json:"calendar_id"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	Summary       string    `json:"summary"`
+	StartTime     string    `json:"start_time"`
+	EndTime       string    `json:"end_time,omitempty"`
+	Location      string    `json:"location,omitempty"`
+	Description   string    `json:"description,omitempty"`
+	ColorID       string    `json:"color_id,omitempty"`
+	ColorName     string    `json:"color_name"`
+	ColorEmoji    string    `json:"color_emoji"`
+	ColorClass    string    `json:"color_class,omitempty"`
+	Category      string    `json:"category"`
+	CategoryEmoji string    `json:"category_emoji"`
+	CategoryClass string    `json:"category_class,omitempty"`
+	EventType     string    `json:"event_type,omitempty"`
+	// Out-of-office and focus time settings
+	AutoDeclineMode string `json:"auto_decline_mode,omitempty"`
+	DeclineMessage  string `json:"decline_message,omitempty"`
+	ChatStatus      string `json:"chat_status,omitempty"`
+	// Where the user works from, for workingLocation events
+	WorkingLocation string          `json:"working_location,omitempty"`
+	Organizer       string          `json:"organizer,omitempty"`
+	OrganizerSelf   bool            `json:"organizer_self,omitempty"`
+	Attendees       []EventAttendee `json:"attendees,omitempty"`
+	IsAllDay        bool            `json:"all_day"`
+	// The series and original start of an instance of a recurring event
+	RecurringEventID  string `json:"recurring_event_id,omitempty"`
+	OriginalStartTime string `json:"original_start_time,omitempty"`
+	// The rule of the series in words, and whether this instance was
+	// changed from it
+	RecurrenceText string `json:"recurrence_text,omitempty"`
+	Exception      bool   `json:"exception,omitempty"`
+	// The last day of all-day events, whose end is the day after
+	EndDate string `json:"end_date,omitempty"`
+	// Video call link of Google Meet or another conferencing solution
+	ConferenceURL string `json:"conference_url,omitempty"`
+	// Links found in the description, which is converted from HTML to text
+	Links []string `json:"links,omitempty"`
 }
 
-func formatTime(timeStr string) string {
-	if timeStr == "" {
-		return "All day"
-	}
-
-	t, err := time.Parse(time.RFC3339, timeStr)
-	if err != nil {
-		return timeStr
-	}
-
-	return t.Format("15:04")
+// EventAttendee is a guest of an event
+type EventAttendee struct {
+	Email          string `json:"email"`
+	Name           string `json:"name,omitempty"`
+	ResponseStatus string `json:"response_status,omitempty"`
+	Self           bool   `json:"self,omitempty"`
+	Optional       bool   `json:"optional,omitempty"`
+	Resource       bool   `json:"resource,omitempty"`
 }
 
-func getColorInfo(colorId string, colorDefinitions map[string]calendar.ColorDefinition) (string, string) {
-	if colorId == "" {
-		return "Default", "⚪"
+// attendeeCount returns the number of people invited, ignoring rooms and
+// other resources. Events without a guest list count the owner only.
+func (e *CalendarEvent) attendeeCount() int {
+	count := 0
+	for _, attendee := range e.Attendees {
+		if !attendee.Resource {
+			count++
+		}
 	}
-
-	// Use our custom mapping based on your actual calendar categories
-	if color, exists := customColorMap[colorId]; exists {
-		return color["name"], color["emoji"]
+	if count == 0 {
+		return 1
 	}
-
-	// If not in our custom mapping, try to get info from API color definitions
-	if colorDef, exists := colorDefinitions[colorId]; exists {
-		emoji := getEmojiFromHex(colorDef.Background)
-		return fmt.Sprintf("Category %s", colorId), emoji
-	}
-
-	return fmt.Sprintf("Color %s", colorId), "🎨"
+	return count
 }
 
-func getEmojiFromHex(hexColor string) string {
-	// Simple color mapping based on hex values
-	// This is a basic implementation - you might want to enhance this
-	if hexColor == "" {
-		return "⚪"
-	}
-
-	// Remove # if present
-	hexColor = strings.TrimPrefix(hexColor, "#")
-
-	// Basic color detection based on hex values
-	switch {
-	case strings.HasPrefix(hexColor, "f") || strings.HasPrefix(hexColor, "e") || strings.HasPrefix(hexColor, "d"):
-		if strings.Contains(hexColor, "0") || strings.Contains(hexColor, "1") || strings.Contains(hexColor, "2") {
-			return "🔴" // Red-ish
+// declined reports whether the user declined the event.
+func (e *CalendarEvent) declined() bool {
+	for _, attendee := range e.Attendees {
+		if attendee.Self {
+			return attendee.ResponseStatus == "declined"
 		}
-		return "🟡" // Yellow-ish
-	case strings.HasPrefix(hexColor, "a") || strings.HasPrefix(hexColor, "b") || strings.HasPrefix(hexColor, "c"):
-		return "🟢" // Green-ish
-	case strings.HasPrefix(hexColor, "7") || strings.HasPrefix(hexColor, "8") || strings.HasPrefix(hexColor, "9"):
-		return "🔵" // Blue-ish
-	case strings.HasPrefix(hexColor, "4") || strings.HasPrefix(hexColor, "5") || strings.HasPrefix(hexColor, "6"):
-		return "🟣" // Purple-ish
-	case strings.HasPrefix(hexColor, "1") || strings.HasPrefix(hexColor, "2") || strings.HasPrefix(hexColor, "3"):
-		return "⚫" // Dark
-	default:
-		return "🎨"
 	}
+	return false
 }
 
-func fetchCalendarColors(srv *calendar.Service) map[string]calendar.ColorDefinition {
-	colors, err := srv.Colors.Get().Do()
+func (cs *CalendarService) formatTime(timeStr string) string {
+	if timeStr == "" {
+		return "All day"
+	}
+
+	t, err := time.Parse(time.RFC3339, timeStr)
 	if err != nil {
-		log.Printf("Unable to retrieve calendar colors: %v", err)
-		return make(map[string]calendar.ColorDefinition)
+		return timeStr
 	}
 
-	return colors.Event
+	return t.In(cs.config.location).Format(cs.config.Formatting.TimeFormat)
 }
 
-// Initialize calendar service with credentials file path (for auth and test modes)
-func initCalendarService() (*CalendarService, error) {
-	ctx := context.Background()
-
-	// Get required environment variables
-	clientID := os.Getenv("client_id")
-	projectID := os.Getenv("project_id")
-
-	// Validate required environment variables
-	if clientID == "" {
-		return nil, fmt.Errorf("client_id environment variable is required")
+// oauthConfig builds the OAuth client configuration from the Google credentials
+func oauthConfig(cfg *Config) (*oauth2.Config, error) {
+	// Validate required credentials
+	if cfg.Google.ClientID == "" {
+		return nil, fmt.Errorf("client_id is required (set the client_id environment variable or google.client_id in the config file)")
 	}
-	if projectID == "" {
-		return nil, fmt.Errorf("project_id environment variable is required")
+	if cfg.Google.ProjectID == "" {
+		return nil, fmt.Errorf("project_id is required (set the project_id environment variable or google.project_id in the config file)")
 	}
 
 	// client_secret is also required for OAuth
-	clientSecret := os.Getenv("client_secret")
-	if clientSecret == "" {
-		return nil, fmt.Errorf("client_secret environment variable is required")
+	if cfg.Google.ClientSecret == "" {
+		return nil, fmt.Errorf("client_secret is required (set the client_secret environment variable or google.client_secret in the config file)")
 	}
 
+	redirectURL := fmt.Sprintf("http://localhost:%d", cfg.Auth.OAuthPort)
+
 	// Create credentials JSON structure in memory
 	credentialsJSON := map[string]interface{}{
 		"installed": map[string]interface{}{
-			"client_id":                   clientID,
-			"project_id":                  projectID,
+			"client_id":                   cfg.Google.ClientID,
+			"project_id":                  cfg.Google.ProjectID,
 			"auth_uri":                    "https://accounts.google.com/o/oauth2/auth",
 			"token_uri":                   "https://oauth2.googleapis.com/token",
 			"auth_provider_x509_cert_url": "https://www.googleapis.com/oauth2/v1/certs",
-			"client_secret":               clientSecret,
-			"redirect_uris":               []string{"http://localhost:8080"},
+			"client_secret":               cfg.Google.ClientSecret,
+			"redirect_uris":               []string{redirectURL},
 		},
 	}
 
@@ -161,144 +162,427 @@ func initCalendarService() (*CalendarService, error) {
 
 	config, err := google.ConfigFromJSON(credentialsBytes, calendar.CalendarReadonlyScope)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse client secret file to config: %v", err)
+		return nil, fmt.Errorf("unable to parse credentials to config: %v", err)
 	}
-	client := getClient(config)
+	return config, nil
+}
 
-	srv, err := calendar.NewService(ctx, option.WithHTTPClient(client))
+// Initialize calendar service, running the OAuth flow if needed (for text mode)
+func initCalendarService(cfg *Config) (*CalendarService, error) {
+	config, err := oauthConfig(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve Calendar client: %v", err)
+		return nil, err
 	}
+	client := getClient(config, cfg)
 
-	colorDefinitions := fetchCalendarColors(srv)
-
-	return &CalendarService{
-		service:          srv,
-		colorDefinitions: colorDefinitions,
-	}, nil
+	return newCalendarService(client, cfg, accountCacheOwner(cfg))
 }
 
-// Initialize calendar service from environment variables (for MCP mode)
-func initCalendarServiceFromEnv() (*CalendarService, error) {
-	ctx := context.Background()
+// Initialize calendar service from an existing token (for MCP mode)
+func initCalendarServiceFromToken(cfg *Config) (*CalendarService, error) {
+	config, err := oauthConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	// Get required environment variables
-	clientID := os.Getenv("client_id")
-	projectID := os.Getenv("project_id")
+	// Get client from existing token (don't start OAuth flow)
+	client, err := getClientFromExistingToken(config, cfg.tokenPath())
+	if err != nil {
+		return nil, err
+	}
+
+	return newCalendarService(client, cfg, accountCacheOwner(cfg))
+}
 
-	// Validate required environment variables
-	if clientID == "" {
-		return nil, fmt.Errorf("client_id environment variable is required")
+func newCalendarService(client *http.Client, cfg *Config, owner string) (*CalendarService, error) {
+	client = &http.Client{
+		Transport: newRetryTransport(client.Transport, cfg),
+		Timeout:   client.Timeout,
 	}
-	if projectID == "" {
-		return nil, fmt.Errorf("project_id environment variable is required")
+	srv, err := calendar.NewService(context.Background(), option.WithHTTPClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve Calendar client: %v", err)
 	}
 
-	// client_secret is also required for OAuth
-	clientSecret := os.Getenv("client_secret")
-	if clientSecret == "" {
-		return nil, fmt.Errorf("client_secret environment variable is required")
+	cs := &CalendarService{
+		service: srv,
+		config:  cfg,
+		cache:   cfg.cache(),
+		owner:   owner,
 	}
+	ctx, cancel := cs.callContext(context.Background())
+	defer cancel()
+	cs.colorDefinitions = fetchCalendarColors(ctx, srv)
+	return cs, nil
+}
 
-	// Create credentials JSON structure in memory
-	credentialsJSON := map[string]interface{}{
-		"installed": map[string]interface{}{
-			"client_id":                   clientID,
-			"project_id":                  projectID,
-			"auth_uri":                    "https://accounts.google.com/o/oauth2/auth",
-			"token_uri":                   "https://oauth2.googleapis.com/token",
-			"auth_provider_x509_cert_url": "https://www.googleapis.com/oauth2/v1/certs",
-			"client_secret":               clientSecret,
-			"redirect_uris":               []string{"http://localhost:8080"},
-		},
+// callContext bounds a single API call by the configured request timeout.
+func (cs *CalendarService) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if cs.config.Google.RequestTimeout <= 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, cs.config.Google.RequestTimeout)
+}
 
-	// Convert to JSON bytes
-	credentialsBytes, err := json.Marshal(credentialsJSON)
+// Get events for a specific day in YYYY-MM-DD format. asOf is set when
+// the events come from an offline snapshot.
+func (cs *CalendarService) getEventForDay(ctx context.Context, dateStr string) (events []CalendarEvent, asOf time.Time, err error) {
+	startOfDay, err := cs.parseDate(dateStr)
 	if err != nil {
-		return nil, fmt.Errorf("unable to marshal credentials JSON: %v", err)
+		return nil, time.Time{}, err
 	}
+	return cs.getAgenda(ctx, startOfDay, startOfDay.AddDate(0, 0, 1))
+}
 
-	// Use google.ConfigFromJSON just like the file-based version
-	config, err := google.ConfigFromJSON(credentialsBytes, calendar.CalendarReadonlyScope)
+// parseDate returns the start of a YYYY-MM-DD day in the configured timezone.
+func (cs *CalendarService) parseDate(dateStr string) (time.Time, error) {
+	targetDate, err := time.ParseInLocation("2006-01-02", dateStr, cs.config.location)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse credentials to config: %v", err)
+		return time.Time{}, fmt.Errorf("invalid date format, expected YYYY-MM-DD: %v", err)
 	}
+	return targetDate, nil
+}
 
-	// Get client from existing token (don't start OAuth flow)
-	client, err := getClientFromExistingToken(config)
-	if err != nil {
-		return nil, err
+// getEvents returns the events overlapping [start, end) from every
+// configured calendar, in chronological order. When Google can't be
+// reached, the last events stored for the window are returned with the
+// time they were fetched as asOf.
+func (cs *CalendarService) getEvents(ctx context.Context, start, end time.Time) (events []CalendarEvent, asOf time.Time, err error) {
+	return cs.readEvents(ctx, start, end, false)
+}
+
+// getAgenda is getEvents for an agenda window, whose events are also
+// saved as a snapshot for offline use and agenda changes. Reports over
+// other ranges use getEvents so they don't fill the snapshot history.
+func (cs *CalendarService) getAgenda(ctx context.Context, start, end time.Time) (events []CalendarEvent, asOf time.Time, err error) {
+	return cs.readEvents(ctx, start, end, true)
+}
+
+func (cs *CalendarService) readEvents(ctx context.Context, start, end time.Time, snapshot bool) (events []CalendarEvent, asOf time.Time, err error) {
+	events, err = cs.fetchEvents(ctx, start, end)
+	if cs.cache == nil {
+		return events, time.Time{}, err
+	}
+	if err == nil {
+		if !snapshot {
+			return events, time.Time{}, nil
+		}
+		// A running server holding the cache saves its own snapshots
+		if err := cs.saveSnapshot(start, end, events); err != nil && !errors.Is(err, errCacheLocked) {
+			fmt.Fprintf(os.Stderr, "Unable to save snapshot: %v\n", err)
+		}
+		return events, time.Time{}, nil
 	}
+	if ctx.Err() == nil && isUnreachable(err) {
+		if offline, asOf, ok := cs.offlineEvents(start, end); ok {
+			return offline, asOf, nil
+		}
+	}
+	return nil, time.Time{}, err
+}
 
-	srv, err := calendar.NewService(ctx, option.WithHTTPClient(client))
-	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve Calendar client: %v", err)
+func (cs *CalendarService) fetchEvents(ctx context.Context, start, end time.Time) ([]CalendarEvent, error) {
+	var calendarEvents []CalendarEvent
+	for _, calendarID := range cs.config.calendars() {
+		items, cached, err := cs.cachedEvents(ctx, calendarID, start, end)
+		if err != nil {
+			return nil, err
+		}
+		if !cached {
+			callCtx, cancel := cs.callContext(ctx)
+			events, err := cs.service.Events.List(calendarID).ShowDeleted(false).
+				SingleEvents(true).TimeMin(start.Format(time.RFC3339)).
+				TimeMax(end.Format(time.RFC3339)).OrderBy("startTime").Context(callCtx).Do()
+			cancel()
+			if err != nil {
+				return nil, fmt.Errorf("unable to retrieve events from %s: %w", calendarID, err)
+			}
+			items = events.Items
+		}
+
+		for _, item := range items {
+			if event, ok := cs.toCalendarEvent(calendarID, item); ok {
+				cs.describeSeries(ctx, &event, item)
+				calendarEvents = append(calendarEvents, event)
+			}
+		}
 	}
 
-	colorDefinitions := fetchCalendarColors(srv)
+	// Merge events from every calendar in chronological order
+	sortEvents(calendarEvents)
+	return calendarEvents, nil
+}
 
-	return &CalendarService{
-		service:          srv,
-		colorDefinitions: colorDefinitions,
-	}, nil
+func sortEvents(events []CalendarEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
 }
 
-// Get events for a specific day in YYYY-MM-DD format
-func (cs *CalendarService) getEventForDay(dateStr string) ([]CalendarEvent, error) {
-	// Parse the date string
-	targetDate, err := time.Parse("2006-01-02", dateStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid date format, expected YYYY-MM-DD: %v", err)
-	}
+// errEventNotFound is returned by getEvent for missing or hidden events.
+var errEventNotFound = errors.New("event not found")
 
-	// Set start and end of the specified day
-	startOfDay := time.Date(targetDate.Year(), targetDate.Month(), targetDate.Day(), 0, 0, 0, 0, targetDate.Location())
-	endOfDay := startOfDay.Add(24 * time.Hour)
+// getEvent returns a single event. Only the configured calendars can be read.
+func (cs *CalendarService) getEvent(ctx context.Context, calendarID, eventID string) (CalendarEvent, error) {
+	_, event, err := cs.getEventItem(ctx, calendarID, eventID)
+	return event, err
+}
 
-	events, err := cs.service.Events.List("primary").ShowDeleted(false).
-		SingleEvents(true).TimeMin(startOfDay.Format(time.RFC3339)).
-		TimeMax(endOfDay.Format(time.RFC3339)).OrderBy("startTime").Do()
+// getEventItem is getEvent returning the API event too, for the details
+// CalendarEvent leaves out.
+func (cs *CalendarService) getEventItem(ctx context.Context, calendarID, eventID string) (*calendar.Event, CalendarEvent, error) {
+	if !containsFold(cs.config.calendars(), calendarID) {
+		return nil, CalendarEvent{}, errEventNotFound
+	}
+	item, err := cs.fetchEvent(ctx, calendarID, eventID)
 	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve events: %v", err)
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && (apiErr.Code == http.StatusNotFound || apiErr.Code == http.StatusGone) {
+			return nil, CalendarEvent{}, errEventNotFound
+		}
+		return nil, CalendarEvent{}, fmt.Errorf("unable to retrieve event %s: %w", eventID, err)
+	}
+	if item.Status == "cancelled" {
+		return nil, CalendarEvent{}, errEventNotFound
+	}
+	event, ok := cs.toCalendarEvent(calendarID, item)
+	if !ok {
+		return nil, CalendarEvent{}, errEventNotFound
 	}
+	cs.describeSeries(ctx, &event, item)
+	return item, event, nil
+}
 
-	var calendarEvents []CalendarEvent
-	for _, item := range events.Items {
-		var startTime, endTime string
-		isAllDay := false
-
-		if item.Start.DateTime != "" {
-			startTime = formatTime(item.Start.DateTime)
-		} else {
-			startTime = "All day"
-			isAllDay = true
+// fetchEvent reads an event from the cache, or from Google if it isn't
+// cached.
+func (cs *CalendarService) fetchEvent(ctx context.Context, calendarID, eventID string) (*calendar.Event, error) {
+	if cs.cache != nil {
+		if _, err := cs.syncCalendar(ctx, calendarID, false); err == nil {
+			if item, ok, err := cs.cache.item(cs.owner, calendarID, eventID); err == nil && ok {
+				return item, nil
+			}
 		}
+	}
+	ctx, cancel := cs.callContext(ctx)
+	defer cancel()
+	return cs.service.Events.Get(calendarID, eventID).Context(ctx).Do()
+}
+
+// findEvent looks up an event given as an agenda://event URI, as
+// "calendarId/eventId" or as a bare event ID, which is searched for in
+// every configured calendar.
+func (cs *CalendarService) findEvent(ctx context.Context, ref string) (CalendarEvent, error) {
+	_, event, err := cs.findEventItem(ctx, ref)
+	return event, err
+}
 
-		if item.End.DateTime != "" {
-			endTime = formatTime(item.End.DateTime)
+// findEventItem is findEvent returning the API event too.
+func (cs *CalendarService) findEventItem(ctx context.Context, ref string) (*calendar.Event, CalendarEvent, error) {
+	ref = strings.TrimSpace(ref)
+	if strings.HasPrefix(ref, eventURIPrefix) {
+		calendarID, eventID, err := parseEventURI(ref)
+		if err != nil {
+			return nil, CalendarEvent{}, err
 		}
+		return cs.getEventItem(ctx, calendarID, eventID)
+	}
+	if calendarID, eventID, found := strings.Cut(ref, "/"); found {
+		return cs.getEventItem(ctx, calendarID, eventID)
+	}
+	for _, calendarID := range cs.config.calendars() {
+		item, event, err := cs.getEventItem(ctx, calendarID, ref)
+		if !errors.Is(err, errEventNotFound) {
+			return item, event, err
+		}
+	}
+	return nil, CalendarEvent{}, errEventNotFound
+}
+
+// toCalendarEvent converts an API event, applying the privacy settings.
+// It returns false when the event must not be shown at all.
+func (cs *CalendarService) toCalendarEvent(calendarID string, item *calendar.Event) (CalendarEvent, bool) {
+	var startTime, endTime string
+	var start, end time.Time
+	isAllDay := false
+
+	if item.Start.DateTime != "" {
+		startTime = cs.formatTime(item.Start.DateTime)
+		start, _ = time.Parse(time.RFC3339, item.Start.DateTime)
+	} else {
+		startTime = "All day"
+		isAllDay = true
+		start, _ = time.ParseInLocation("2006-01-02", item.Start.Date, cs.config.location)
+	}
+
+	if item.End.DateTime != "" {
+		endTime = cs.formatTime(item.End.DateTime)
+		end, _ = time.Parse(time.RFC3339, item.End.DateTime)
+	} else {
+		end, _ = time.ParseInLocation("2006-01-02", item.End.Date, cs.config.location)
+	}
 
-		colorName, colorEmoji := getColorInfo(item.ColorId, cs.colorDefinitions)
-
-		calendarEvents = append(calendarEvents, CalendarEvent{
-			Summary:     item.Summary,
-			StartTime:   startTime,
-			EndTime:     endTime,
-			Location:    item.Location,
-			Description: item.Description,
-			ColorName:   colorName,
-			ColorEmoji:  colorEmoji,
-			IsAllDay:    isAllDay,
+	color := getColorInfo(item.ColorId, cs.config.Categories, cs.colorDefinitions)
+	description, links := cleanDescription(item.Description)
+
+	event := CalendarEvent{
+		ID:          item.Id,
+		CalendarID:  calendarID,
+		Start:       start,
+		End:         end,
+		Summary:     item.Summary,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		Location:    item.Location,
+		Description: description,
+		Links:       links,
+		ColorID:     item.ColorId,
+		ColorName:   color.Name,
+		ColorEmoji:  color.Emoji,
+		ColorClass:  color.Class,
+		EventType:   item.EventType,
+		IsAllDay:    isAllDay,
+	}
+	switch {
+	case item.OutOfOfficeProperties != nil:
+		event.AutoDeclineMode = item.OutOfOfficeProperties.AutoDeclineMode
+		event.DeclineMessage = item.OutOfOfficeProperties.DeclineMessage
+	case item.FocusTimeProperties != nil:
+		event.AutoDeclineMode = item.FocusTimeProperties.AutoDeclineMode
+		event.DeclineMessage = item.FocusTimeProperties.DeclineMessage
+		event.ChatStatus = item.FocusTimeProperties.ChatStatus
+	case item.WorkingLocationProperties != nil:
+		event.WorkingLocation = workingLocationName(item.WorkingLocationProperties)
+	}
+	event.ConferenceURL = item.HangoutLink
+	if item.ConferenceData != nil {
+		for _, entry := range item.ConferenceData.EntryPoints {
+			if entry.EntryPointType == "video" {
+				event.ConferenceURL = entry.Uri
+				break
+			}
+		}
+	}
+	if isAllDay {
+		event.EndDate = lastDay(event, cs.config.location).Format("2006-01-02")
+	}
+	if item.OriginalStartTime != nil {
+		event.RecurringEventID = item.RecurringEventId
+		event.OriginalStartTime = item.OriginalStartTime.DateTime
+		if event.OriginalStartTime == "" {
+			event.OriginalStartTime = item.OriginalStartTime.Date
+		}
+	}
+	if item.Organizer != nil {
+		event.Organizer = item.Organizer.Email
+		event.OrganizerSelf = item.Organizer.Self
+	}
+	for _, attendee := range item.Attendees {
+		event.Attendees = append(event.Attendees, EventAttendee{
+			Email:          attendee.Email,
+			Name:           attendee.DisplayName,
+			ResponseStatus: attendee.ResponseStatus,
+			Self:           attendee.Self,
+			Optional:       attendee.Optional,
+			Resource:       attendee.Resource,
 		})
 	}
 
-	return calendarEvents, nil
+	privacy := cs.config.Privacy
+	if isPrivate(item) {
+		switch privacy.PrivateEvents {
+		case privateEventsHide:
+			return CalendarEvent{}, false
+		case privateEventsBusy:
+			// Masked before classifying, so that the category can't give
+			// the event away either
+			event = maskEvent(event)
+			color = getColorInfo("", cs.config.Categories, cs.colorDefinitions)
+			event.ColorName = color.Name
+			event.ColorEmoji = color.Emoji
+		}
+	}
+
+	// A color mapped to a category decides it; rules classify the rest,
+	// with the color as the fallback
+	category := color
+	if _, colored := cs.config.Categories[event.ColorID]; !colored || event.ColorID == "" {
+		if ruled, matched := cs.config.classifier.classify(&event); matched {
+			category = ruled
+		}
+	}
+	event.Category = category.Name
+	event.CategoryEmoji = category.Emoji
+	event.CategoryClass = category.Class
+
+	if privacy.HideLocations {
+		event.Location = ""
+	}
+	if privacy.HideDescriptions {
+		event.Description = ""
+		event.Links = nil
+	}
+
+	return event, true
+}
+
+// isPrivate reports whether only the owner of an event may see its details.
+func isPrivate(item *calendar.Event) bool {
+	return item.Visibility == "private" || item.Visibility == "confidential"
+}
+
+// maskedBusy reports whether an event is shown as busy only.
+func (cs *CalendarService) maskedBusy(item *calendar.Event) bool {
+	return isPrivate(item) && cs.config.Privacy.PrivateEvents == privateEventsBusy
+}
+
+// maskEvent keeps the time and type of an event and drops everything
+// that tells what it is or who is in it.
+func maskEvent(event CalendarEvent) CalendarEvent {
+	return CalendarEvent{
+		ID:                event.ID,
+		CalendarID:        event.CalendarID,
+		Start:             event.Start,
+		End:               event.End,
+		Summary:           "Busy",
+		StartTime:         event.StartTime,
+		EndTime:           event.EndTime,
+		EventType:         event.EventType,
+		IsAllDay:          event.IsAllDay,
+		RecurringEventID:  event.RecurringEventID,
+		OriginalStartTime: event.OriginalStartTime,
+		EndDate:           event.EndDate,
+	}
+}
+
+// workingLocationName returns a short label for a working location.
+func workingLocationName(props *calendar.EventWorkingLocationProperties) string {
+	switch {
+	case props.Type == "homeOffice" || props.HomeOffice != nil:
+		return "Home"
+	case props.OfficeLocation != nil:
+		if props.OfficeLocation.Label != "" {
+			return props.OfficeLocation.Label
+		}
+		if props.OfficeLocation.BuildingId != "" {
+			return props.OfficeLocation.BuildingId
+		}
+		return "Office"
+	case props.CustomLocation != nil && props.CustomLocation.Label != "":
+		return props.CustomLocation.Label
+	default:
+		return "Other"
+	}
 }
 
 // Get today's events
-func (cs *CalendarService) getTodaysEvents() ([]CalendarEvent, error) {
-	now := time.Now()
+func (cs *CalendarService) getTodaysEvents(ctx context.Context) ([]CalendarEvent, time.Time, error) {
+	now := time.Now().In(cs.config.location)
 	todayStr := now.Format("2006-01-02")
-	return cs.getEventForDay(todayStr)
+	return cs.getEventForDay(ctx, todayStr)
+}
+
+// today returns the start of the current day in the configured timezone.
+func (cs *CalendarService) today() time.Time {
+	now := time.Now().In(cs.config.location)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, cs.config.location)
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+)
+
+// newFakeService returns a calendar service whose Google API is handler,
+// with the default configuration in UTC and no cache.
+func newFakeService(t *testing.T, handler http.Handler) *CalendarService {
+	t.Helper()
+	api := httptest.NewServer(handler)
+	t.Cleanup(api.Close)
+
+	cfg := defaultConfig()
+	cfg.Timezone = "UTC"
+	cfg.location, _ = loadLocation("UTC")
+	cfg.classifier, _ = newClassifier(cfg.Classification)
+	cfg.selectAccount("")
+	srv, err := calendar.NewService(context.Background(), option.WithEndpoint(api.URL+"/"), option.WithHTTPClient(api.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &CalendarService{service: srv, config: cfg}
+}
+
+// blockingAPI is a Google API that doesn't answer: each request signals
+// started and waits until the client gives up, then signals aborted. It
+// answers after blockingAPITimeout so a failing test doesn't hang.
+type blockingAPI struct {
+	started chan struct{}
+	aborted chan struct{}
+}
+
+const blockingAPITimeout = 10 * time.Second
+
+func newBlockingAPI() *blockingAPI {
+	return &blockingAPI{started: make(chan struct{}, 10), aborted: make(chan struct{}, 10)}
+}
+
+func (api *blockingAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.started <- struct{}{}
+	select {
+	case <-r.Context().Done():
+		api.aborted <- struct{}{}
+	case <-time.After(blockingAPITimeout):
+		http.Error(w, "no answer", http.StatusGatewayTimeout)
+	}
+}
+
+// waitFor fails the test if ch doesn't receive within a few seconds.
+func waitFor(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+// clockAt returns clock on a day of December 2024, in UTC. December 2 is
+// a Monday.
+func clockAt(day int, clock string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", fmt.Sprintf("2024-12-%02d %s", day, clock))
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// testMeeting returns a meeting from start to end.
+func testMeeting(summary string, start, end time.Time) CalendarEvent {
+	return CalendarEvent{ID: summary, Summary: summary, Start: start, End: end, Category: "Meetings", CategoryClass: classMeeting}
+}
+
+// testConfig returns a configuration in UTC with working hours from start
+// to end on weekdays.
+func testConfig(start, end string) *Config {
+	cfg := defaultConfig()
+	cfg.location, _ = loadLocation("UTC")
+	cfg.WorkingHours.Start, cfg.WorkingHours.End = start, end
+	return cfg
+}
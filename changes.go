@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of agenda changes.
+const (
+	changeAdded     = "added"
+	changeCancelled = "cancelled"
+	changeMoved     = "moved"
+	changeRSVP      = "rsvp_changed"
+)
+
+// errNoSnapshot is returned when a window was never fetched before, so
+// there is nothing to compare with.
+var errNoSnapshot = errors.New("no earlier snapshot of this agenda: changes are tracked from now on")
+
+// eventChange is an event that differs between two versions of an agenda.
+type eventChange struct {
+	Kind    string
+	Event   CalendarEvent
+	Details []string
+}
+
+// agendaChanges are the changes to the window [Start, End) between the
+// snapshot fetched at Baseline and the current events.
+type agendaChanges struct {
+	Start, End time.Time
+	Since      time.Time
+	Baseline   time.Time
+	// AsOf is set when the current events come from an offline snapshot
+	AsOf    time.Time
+	Changes []eventChange
+}
+
+// changesSince compares the events of [start, end) with the version that
+// was current at since, or the oldest one kept if since predates it.
+func (cs *CalendarService) changesSince(ctx context.Context, start, end, since time.Time) (*agendaChanges, error) {
+	if cs.cache == nil {
+		return nil, fmt.Errorf("agenda changes require the event cache (cache.enabled: true)")
+	}
+	history, err := cs.snapshots(start, end)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshots: %v", err)
+	}
+	// Fetching also records the current version for later comparisons
+	events, asOf, err := cs.getAgenda(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, errNoSnapshot
+	}
+
+	baseline := history[0]
+	for _, snap := range history[1:] {
+		if !snap.FetchedAt.After(since) {
+			baseline = snap
+		}
+	}
+	return &agendaChanges{
+		Start:    start,
+		End:      end,
+		Since:    since,
+		Baseline: baseline.FetchedAt,
+		AsOf:     asOf,
+		Changes:  diffEvents(baseline.Events, events, cs.config),
+	}, nil
+}
+
+// changeKey identifies an event across versions: instances of a recurring
+// event by their series and original start, which survive rescheduling.
+func changeKey(event CalendarEvent) string {
+	if event.RecurringEventID != "" {
+		return event.CalendarID + "/" + event.RecurringEventID + "@" + event.OriginalStartTime
+	}
+	return event.CalendarID + "/" + event.ID
+}
+
+// diffEvents lists the events added, cancelled, moved or whose responses
+// changed from before to after, in chronological order. An event that
+// both moved and got new responses is reported once for each.
+func diffEvents(before, after []CalendarEvent, cfg *Config) []eventChange {
+	previous := make(map[string]CalendarEvent, len(before))
+	for _, event := range before {
+		previous[changeKey(event)] = event
+	}
+
+	var changes []eventChange
+	seen := make(map[string]bool, len(after))
+	for _, event := range after {
+		key := changeKey(event)
+		seen[key] = true
+		old, ok := previous[key]
+		if !ok {
+			changes = append(changes, eventChange{Kind: changeAdded, Event: event})
+			continue
+		}
+		if details := moveDetails(old, event, cfg); len(details) > 0 {
+			changes = append(changes, eventChange{Kind: changeMoved, Event: event, Details: details})
+		}
+		if details := responseDetails(old, event); len(details) > 0 {
+			changes = append(changes, eventChange{Kind: changeRSVP, Event: event, Details: details})
+		}
+	}
+	for _, event := range before {
+		if !seen[changeKey(event)] {
+			changes = append(changes, eventChange{Kind: changeCancelled, Event: event})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Event.Start.Before(changes[j].Event.Start)
+	})
+	return changes
+}
+
+func moveDetails(old, event CalendarEvent, cfg *Config) []string {
+	var details []string
+	if !old.Start.Equal(event.Start) || !old.End.Equal(event.End) || old.IsAllDay != event.IsAllDay {
+		details = append(details, fmt.Sprintf("%s → %s", changeTime(old, cfg), changeTime(event, cfg)))
+	}
+	if old.Location != event.Location {
+		details = append(details, fmt.Sprintf("location %s → %s", orNone(old.Location), orNone(event.Location)))
+	}
+	return details
+}
+
+func responseDetails(old, event CalendarEvent) []string {
+	responses := make(map[string]string, len(old.Attendees))
+	for _, attendee := range old.Attendees {
+		responses[strings.ToLower(attendee.Email)] = attendee.ResponseStatus
+	}
+	var details []string
+	for _, attendee := range event.Attendees {
+		was, ok := responses[strings.ToLower(attendee.Email)]
+		if !ok || was == attendee.ResponseStatus || attendee.Resource {
+			continue
+		}
+		who := attendee.Name
+		switch {
+		case attendee.Self:
+			who = "you"
+		case who == "":
+			who = attendee.Email
+		}
+		details = append(details, fmt.Sprintf("%s: %s → %s", who, orNone(was), orNone(attendee.ResponseStatus)))
+	}
+	return details
+}
+
+// changeTime describes when an event takes place, with its date.
+func changeTime(event CalendarEvent, cfg *Config) string {
+	start := event.Start.In(cfg.location)
+	if event.IsAllDay {
+		return start.Format("Mon Jan 2") + " all day"
+	}
+	return fmt.Sprintf("%s %s-%s", start.Format("Mon Jan 2"), start.Format(cfg.Formatting.TimeFormat),
+		event.End.In(cfg.location).Format(cfg.Formatting.TimeFormat))
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+// changeSections are the kinds of changes in the order they are listed.
+var changeSections = []struct{ kind, emoji, title string }{
+	{changeAdded, "➕", "Added"},
+	{changeCancelled, "❌", "Cancelled or removed"},
+	{changeMoved, "🕐", "Moved"},
+	{changeRSVP, "✉️ ", "Responses changed"},
+}
+
+// formatChanges renders the changes grouped by kind, as text, markdown or
+// JSON.
+func formatChanges(changes *agendaChanges, format string, cfg *Config) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", formatText:
+		return changesText(changes, cfg), nil
+	case formatMarkdown:
+		return withOfflineNotice(changesMarkdown(changes, cfg), changes.AsOf, cfg), nil
+	case formatJSON:
+		out, err := json.MarshalIndent(changesJSON(changes), "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+	return "", fmt.Errorf("unknown format %q: use one of %s", format, strings.Join(reportFormats, ", "))
+}
+
+// changesTitle names the day or week of the changes.
+func changesTitle(changes *agendaChanges) string {
+	period := changes.Start.Format("Monday, January 2, 2006")
+	if changes.End.Sub(changes.Start) > 24*time.Hour {
+		period = "the week of " + period
+	}
+	return period
+}
+
+// changesBaseline tells which version of the agenda the changes are from.
+func changesBaseline(changes *agendaChanges, cfg *Config) string {
+	baseline := fmt.Sprintf("Compared with the agenda as of %s", changes.Baseline.In(cfg.location).Format("2006-01-02 "+cfg.Formatting.TimeFormat))
+	if changes.Baseline.After(changes.Since) {
+		baseline += " (the oldest snapshot kept)"
+	}
+	return baseline
+}
+
+func changesText(changes *agendaChanges, cfg *Config) string {
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("🔄 Changes to %s\n", changesTitle(changes)))
+	output.WriteString(strings.Repeat("=", 50) + "\n\n")
+	if notice := offlineNotice(changes.AsOf, cfg); notice != "" {
+		output.WriteString(notice + "\n")
+	}
+	output.WriteString(changesBaseline(changes, cfg) + "\n\n")
+
+	if len(changes.Changes) == 0 {
+		output.WriteString("✅ No changes")
+		return output.String()
+	}
+
+	for _, section := range changeSections {
+		var lines []string
+		for _, change := range changes.Changes {
+			if change.Kind != section.kind {
+				continue
+			}
+			line := fmt.Sprintf("   • %s | %s", changeTime(change.Event, cfg), change.Event.Summary)
+			if len(change.Details) > 0 {
+				line += "\n     " + strings.Join(change.Details, "\n     ")
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) > 0 {
+			output.WriteString(fmt.Sprintf("%s %s (%d)\n%s\n\n", section.emoji, section.title, len(lines), strings.Join(lines, "\n")))
+		}
+	}
+	return strings.TrimRight(output.String(), "\n")
+}
+
+func changesMarkdown(changes *agendaChanges, cfg *Config) string {
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("# Changes to %s\n\n", changesTitle(changes)))
+	output.WriteString(changesBaseline(changes, cfg) + ".\n")
+	if len(changes.Changes) == 0 {
+		output.WriteString("\nNo changes.\n")
+		return output.String()
+	}
+
+	for _, section := range changeSections {
+		var lines []string
+		for _, change := range changes.Changes {
+			if change.Kind != section.kind {
+				continue
+			}
+			line := fmt.Sprintf("- **%s** %s", changeTime(change.Event, cfg), change.Event.Summary)
+			for _, detail := range change.Details {
+				line += "\n  - " + detail
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) > 0 {
+			output.WriteString(fmt.Sprintf("\n## %s (%d)\n\n%s\n", section.title, len(lines), strings.Join(lines, "\n")))
+		}
+	}
+	return output.String()
+}
+
+// agendaChangesJSON is the JSON form of the changes.
+type agendaChangesJSON struct {
+	From        string       `json:"from"`
+	To          string       `json:"to"`
+	Since       time.Time    `json:"since"`
+	Baseline    time.Time    `json:"baseline"`
+	OfflineAsOf *time.Time   `json:"offline_as_of,omitempty"`
+	Changes     []changeJSON `json:"changes"`
+}
+
+type changeJSON struct {
+	Kind    string        `json:"kind"`
+	Event   eventResource `json:"event"`
+	Details []string      `json:"details,omitempty"`
+}
+
+func changesJSON(changes *agendaChanges) agendaChangesJSON {
+	data := agendaChangesJSON{
+		From:     changes.Start.Format("2006-01-02"),
+		To:       changes.End.AddDate(0, 0, -1).Format("2006-01-02"),
+		Since:    changes.Since,
+		Baseline: changes.Baseline,
+		Changes:  []changeJSON{},
+	}
+	if !changes.AsOf.IsZero() {
+		data.OfflineAsOf = &changes.AsOf
+	}
+	for _, change := range changes.Changes {
+		data.Changes = append(data.Changes, changeJSON{
+			Kind:    change.Kind,
+			Event:   eventResource{URI: eventURI(change.Event), CalendarEvent: change.Event},
+			Details: change.Details,
+		})
+	}
+	return data
+}
+
+// parseSince parses the start of a changes query: a time today (HH:MM), a
+// date with an optional time, an RFC 3339 timestamp or a duration ago.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	since, err := parseSinceValue(value, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if since.After(now) {
+		return time.Time{}, fmt.Errorf("%q is in the future", value)
+	}
+	return since, nil
+}
+
+func parseSinceValue(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.Parse("15:04", value); err == nil {
+		return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location()), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use HH:MM, YYYY-MM-DD [HH:MM], RFC 3339 or a duration such as 3h", value)
+}
+
+// changesWindow returns the day, or with week the Monday-based week, that
+// contains dateStr (default: today).
+func (cs *CalendarService) changesWindow(dateStr string, week bool) (start, end time.Time, err error) {
+	if dateStr == "" {
+		dateStr = time.Now().In(cs.config.location).Format("2006-01-02")
+	}
+	start, err = cs.parseDate(dateStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if week {
+		start = startOfWeek(start)
+		return start, start.AddDate(0, 0, 7), nil
+	}
+	return start, start.AddDate(0, 0, 1), nil
+}
+
+// Run changes mode - show what changed on the agenda since a given time
+func runChangesMode(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("changes", flag.ExitOnError)
+	sinceFlag := fs.String("since", "", "Compare with the agenda at this time: HH:MM, YYYY-MM-DD [HH:MM], RFC 3339 or a duration such as 3h")
+	week := fs.Bool("week", false, "Check the whole week instead of the day")
+	format := fs.String("format", formatText, "Output format: "+strings.Join(reportFormats, ", "))
+	positional := parseFlags(fs, args)
+	if *sinceFlag == "" {
+		log.Fatalf("--since is required")
+	}
+	if len(positional) > 1 {
+		log.Fatalf("Usage: agenda-mcp changes --since TIME [--week] [--format FORMAT] [YYYY-MM-DD]")
+	}
+	if !containsFold(reportFormats, *format) {
+		log.Fatalf("Unknown format %q: use one of %s", *format, strings.Join(reportFormats, ", "))
+	}
+	since, err := parseSince(*sinceFlag, time.Now().In(cfg.location))
+	if err != nil {
+		log.Fatalf("Invalid --since: %v", err)
+	}
+
+	cs, err := initCalendarService(cfg)
+	if err != nil {
+		log.Fatalf("Authentication failed: %v", err)
+	}
+	var dateStr string
+	if len(positional) == 1 {
+		dateStr = positional[0]
+	}
+	start, end, err := cs.changesWindow(dateStr, *week)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	changes, err := cs.changesSince(context.Background(), start, end, since)
+	if err != nil {
+		log.Fatalf("Failed to get agenda changes: %v", err)
+	}
+	output, err := formatChanges(changes, *format, cfg)
+	if err != nil {
+		log.Fatalf("Failed to format changes: %v", err)
+	}
+	fmt.Println(strings.TrimRight(output, "\n"))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestChangesFormats(t *testing.T) {
+	cfg := testConfig("09:00", "18:00")
+	moved := testMeeting("Planning", clockAt(2, "14:00"), clockAt(2, "15:00"))
+	changes := &agendaChanges{
+		Start:    clockAt(2, "00:00"),
+		End:      clockAt(3, "00:00"),
+		Since:    clockAt(2, "08:00"),
+		Baseline: clockAt(2, "08:00"),
+		Changes: []eventChange{
+			{Kind: changeAdded, Event: testMeeting("Standup", clockAt(2, "09:00"), clockAt(2, "09:15"))},
+			{Kind: changeMoved, Event: moved, Details: []string{"Mon Dec 2 10:00-11:00 → Mon Dec 2 14:00-15:00"}},
+		},
+	}
+	text, err := formatChanges(changes, "", cfg)
+	if err != nil || !strings.Contains(text, "➕ Added (1)") || !strings.Contains(text, "🕐 Moved (1)") {
+		t.Errorf("changes as text = %q, %v", text, err)
+	}
+	markdown, err := formatChanges(changes, formatMarkdown, cfg)
+	if err != nil || !strings.HasPrefix(markdown, "# ") || !strings.Contains(markdown, "## Moved (1)") {
+		t.Errorf("changes as markdown = %q, %v", markdown, err)
+	}
+	if _, err := formatChanges(changes, "csv", cfg); err == nil {
+		t.Error("changes accepted an unsupported format")
+	}
+
+	out, err := formatChanges(changes, formatJSON, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data agendaChangesJSON
+	if err := json.Unmarshal([]byte(out), &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.From != "2024-12-02" || len(data.Changes) != 2 || data.Changes[1].Kind != changeMoved ||
+		data.Changes[1].Event.Summary != "Planning" || len(data.Changes[1].Details) != 1 {
+		t.Errorf("changes as JSON = %+v", data)
+	}
+}
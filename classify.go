@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ClassificationConfig holds the rules that assign categories to events.
+type ClassificationConfig struct {
+	InternalDomains []string     `yaml:"internal_domains,omitempty"`
+	Rules           []RuleConfig `yaml:"rules"`
+}
+
+// RuleConfig assigns Category to events matching every condition that is
+// set. Rules are evaluated in order and the first match wins.
+type RuleConfig struct {
+	Category string `yaml:"category"`
+	Emoji    string `yaml:"emoji,omitempty"`
+	Class    string `yaml:"class,omitempty"`
+
+	Title             string `yaml:"title,omitempty"`
+	OrganizerDomain   string `yaml:"organizer_domain,omitempty"`
+	MinAttendees      int    `yaml:"min_attendees,omitempty"`
+	MaxAttendees      int    `yaml:"max_attendees,omitempty"`
+	ExternalAttendees *bool  `yaml:"external_attendees,omitempty"`
+	CalendarID        string `yaml:"calendar_id,omitempty"`
+	EventType         string `yaml:"event_type,omitempty"`
+	ColorID           string `yaml:"color_id,omitempty"`
+}
+
+// Event types reported by the Calendar API.
+var eventTypes = []string{"default", "focusTime", "outOfOffice", "workingLocation", "birthday", "fromGmail"}
+
+// Emoji and class used for well-known categories when a rule doesn't set them.
+var knownCategories = map[string]ColorInfo{
+	"1:1":           {Emoji: "🟡", Class: classMeeting},
+	"internal":      {Emoji: "🟣", Class: classMeeting},
+	"external":      {Emoji: "🔴", Class: classMeeting},
+	"focus":         {Emoji: "🟢", Class: classFocus},
+	"travel":        {Emoji: "🟠"},
+	"personal":      {Emoji: "🔵", Class: classPersonal},
+	"out of office": {Emoji: "🏝️", Class: classPersonal},
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// defaultRules classify events when the config file doesn't define any.
+func defaultRules() []RuleConfig {
+	return []RuleConfig{
+		{Category: "focus", EventType: "focusTime"},
+		{Category: "out of office", EventType: "outOfOffice"},
+		{Category: "external", ExternalAttendees: boolPtr(true)},
+		{Category: "1:1", MinAttendees: 2, MaxAttendees: 2},
+		{Category: "internal", MinAttendees: 3},
+	}
+}
+
+type rule struct {
+	RuleConfig
+	title *regexp.Regexp
+}
+
+// classifier assigns categories to events using the configured rules.
+type classifier struct {
+	rules           []rule
+	internalDomains map[string]bool
+}
+
+func newClassifier(cfg ClassificationConfig) (*classifier, error) {
+	c := &classifier{internalDomains: make(map[string]bool)}
+	for _, domain := range cfg.InternalDomains {
+		c.internalDomains[strings.ToLower(domain)] = true
+	}
+	for _, rc := range cfg.Rules {
+		r := rule{RuleConfig: rc}
+		if rc.Title != "" {
+			re, err := regexp.Compile(rc.Title)
+			if err != nil {
+				return nil, fmt.Errorf("invalid title pattern for category %q: %v", rc.Category, err)
+			}
+			r.title = re
+		}
+		c.rules = append(c.rules, r)
+	}
+	return c, nil
+}
+
+// ruleProblem is a validation problem with one field of a rule.
+type ruleProblem struct {
+	field   string
+	message string
+}
+
+// validateRule checks one rule and returns its problems in field order.
+func validateRule(rc RuleConfig) []ruleProblem {
+	var problems []ruleProblem
+	if rc.Category == "" {
+		problems = append(problems, ruleProblem{"category", "rule category is required"})
+	}
+	if rc.Title != "" {
+		if _, err := regexp.Compile(rc.Title); err != nil {
+			problems = append(problems, ruleProblem{"title", fmt.Sprintf("invalid title pattern: %v", err)})
+		}
+	}
+	if rc.MinAttendees < 0 {
+		problems = append(problems, ruleProblem{"min_attendees", "min_attendees must not be negative"})
+	}
+	if rc.MaxAttendees < 0 {
+		problems = append(problems, ruleProblem{"max_attendees", "max_attendees must not be negative"})
+	}
+	if rc.MaxAttendees > 0 && rc.MinAttendees > rc.MaxAttendees {
+		problems = append(problems, ruleProblem{"max_attendees", "max_attendees must not be less than min_attendees"})
+	}
+	if rc.EventType != "" && !isEventType(rc.EventType) {
+		problems = append(problems, ruleProblem{"event_type", fmt.Sprintf("event_type must be one of %s, got %q", strings.Join(eventTypes, ", "), rc.EventType)})
+	}
+	switch rc.Class {
+	case "", classMeeting, classFocus, classPersonal:
+	default:
+		problems = append(problems, ruleProblem{"class", fmt.Sprintf("class must be one of meeting, focus, personal, got %q", rc.Class)})
+	}
+	return problems
+}
+
+func isEventType(eventType string) bool {
+	for _, t := range eventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// classify returns the category of the first rule matching event, or
+// false when no rule matches.
+func (c *classifier) classify(event *CalendarEvent) (ColorInfo, bool) {
+	for _, r := range c.rules {
+		if !c.matches(r, event) {
+			continue
+		}
+		info := knownCategories[r.Category]
+		info.Name = r.Category
+		if info.Emoji == "" {
+			info.Emoji = "🏷️"
+		}
+		if r.Emoji != "" {
+			info.Emoji = r.Emoji
+		}
+		if r.Class != "" {
+			info.Class = r.Class
+		}
+		return info, true
+	}
+	return ColorInfo{}, false
+}
+
+func (c *classifier) matches(r rule, event *CalendarEvent) bool {
+	if r.title != nil && !r.title.MatchString(event.Summary) {
+		return false
+	}
+	if r.OrganizerDomain != "" && !strings.EqualFold(emailDomain(event.Organizer), r.OrganizerDomain) {
+		return false
+	}
+	attendees := event.attendeeCount()
+	if r.MinAttendees > 0 && attendees < r.MinAttendees {
+		return false
+	}
+	if r.MaxAttendees > 0 && attendees > r.MaxAttendees {
+		return false
+	}
+	if r.ExternalAttendees != nil && c.hasExternalAttendees(event) != *r.ExternalAttendees {
+		return false
+	}
+	if r.CalendarID != "" && r.CalendarID != event.CalendarID {
+		return false
+	}
+	if r.EventType != "" && r.EventType != event.EventType {
+		return false
+	}
+	if r.ColorID != "" && r.ColorID != event.ColorID {
+		return false
+	}
+	return true
+}
+
+// hasExternalAttendees reports whether anyone outside the internal domains
+// is invited. Without configured domains, the user's own domain is used.
+func (c *classifier) hasExternalAttendees(event *CalendarEvent) bool {
+	internal := c.internalDomains
+	if len(internal) == 0 {
+		own := ""
+		for _, attendee := range event.Attendees {
+			if attendee.Self {
+				own = emailDomain(attendee.Email)
+			}
+		}
+		if own == "" && event.OrganizerSelf {
+			own = emailDomain(event.Organizer)
+		}
+		if own == "" {
+			return false
+		}
+		internal = map[string]bool{own: true}
+	}
+
+	for _, attendee := range event.Attendees {
+		if attendee.Resource {
+			continue
+		}
+		if domain := emailDomain(attendee.Email); domain != "" && !internal[domain] {
+			return true
+		}
+	}
+	return false
+}
+
+func emailDomain(email string) string {
+	if _, domain, found := strings.Cut(email, "@"); found {
+		return strings.ToLower(domain)
+	}
+	return ""
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// googleColorNames are the names Google Calendar shows for its event colors.
+var googleColorNames = map[string]string{
+	"1":  "Lavender",
+	"2":  "Sage",
+	"3":  "Grape",
+	"4":  "Flamingo",
+	"5":  "Banana",
+	"6":  "Tangerine",
+	"7":  "Peacock",
+	"8":  "Graphite",
+	"9":  "Blueberry",
+	"10": "Basil",
+	"11": "Tomato",
+}
+
+// colorEmoji is a colored circle emoji with the RGB value it renders as.
+type colorEmoji struct {
+	emoji   string
+	r, g, b uint8
+}
+
+var colorEmojis = []colorEmoji{
+	{"🔴", 221, 46, 68},
+	{"🟠", 244, 144, 12},
+	{"🟡", 253, 203, 88},
+	{"🟢", 120, 177, 89},
+	{"🔵", 85, 172, 238},
+	{"🟣", 170, 142, 214},
+	{"🟤", 193, 105, 79},
+	{"⚫", 49, 55, 61},
+	{"⚪", 230, 231, 232},
+}
+
+// Category classes, used to group categories in reports.
+const (
+	classMeeting  = "meeting"
+	classFocus    = "focus"
+	classPersonal = "personal"
+)
+
+// ColorInfo describes how an event color is displayed.
+type ColorInfo struct {
+	Name  string
+	Emoji string
+	Class string
+}
+
+func getColorInfo(colorId string, categories map[string]CategoryConfig, colorDefinitions map[string]calendar.ColorDefinition) ColorInfo {
+	if colorId == "" {
+		return ColorInfo{Name: "Default", Emoji: "⚪"}
+	}
+
+	info := ColorInfo{Name: fmt.Sprintf("Color %s", colorId), Emoji: "🎨"}
+	if name, exists := googleColorNames[colorId]; exists {
+		info.Name = name
+	}
+	if colorDef, exists := colorDefinitions[colorId]; exists {
+		info.Emoji = getEmojiFromHex(colorDef.Background)
+	}
+
+	// Categories from the configuration take precedence
+	if category, exists := categories[colorId]; exists {
+		info.Name = category.Name
+		if category.Emoji != "" {
+			info.Emoji = category.Emoji
+		}
+		info.Class = category.Class
+	}
+
+	return info
+}
+
+// getEmojiFromHex returns the circle emoji closest to a "#rrggbb" color.
+// Colors are compared in the HSL cylinder, with hue and saturation weighted
+// above lightness so pastel shades still map to their hue.
+func getEmojiFromHex(hexColor string) string {
+	r, g, b, ok := parseHexColor(hexColor)
+	if !ok {
+		return "⚪"
+	}
+
+	x, y, z := hslPoint(r, g, b)
+	best, bestDistance := "🎨", math.Inf(1)
+	for _, candidate := range colorEmojis {
+		cx, cy, cz := hslPoint(candidate.r, candidate.g, candidate.b)
+		distance := (x-cx)*(x-cx) + (y-cy)*(y-cy) + 0.25*(z-cz)*(z-cz)
+		if distance < bestDistance {
+			best, bestDistance = candidate.emoji, distance
+		}
+	}
+	return best
+}
+
+func parseHexColor(hexColor string) (r, g, b uint8, ok bool) {
+	hexColor = strings.TrimPrefix(hexColor, "#")
+	if len(hexColor) == 3 {
+		hexColor = string([]byte{hexColor[0], hexColor[0], hexColor[1], hexColor[1], hexColor[2], hexColor[2]})
+	}
+	if len(hexColor) != 6 {
+		return 0, 0, 0, false
+	}
+	v, err := strconv.ParseUint(hexColor, 16, 32)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return uint8(v >> 16), uint8(v >> 8), uint8(v), true
+}
+
+// hslPoint maps an RGB color to cartesian coordinates in the HSL cylinder:
+// saturation is the radius, hue the angle and lightness the height.
+func hslPoint(r, g, b uint8) (x, y, z float64) {
+	rf, gf, bf := float64(r)/255, float64(g)/255, float64(b)/255
+	max := math.Max(rf, math.Max(gf, bf))
+	min := math.Min(rf, math.Min(gf, bf))
+	lightness := (max + min) / 2
+	if max == min {
+		return 0, 0, lightness
+	}
+
+	delta := max - min
+	saturation := delta / (max + min)
+	if lightness > 0.5 {
+		saturation = delta / (2 - max - min)
+	}
+
+	var hue float64
+	switch max {
+	case rf:
+		hue = math.Mod((gf-bf)/delta+6, 6)
+	case gf:
+		hue = (bf-rf)/delta + 2
+	default:
+		hue = (rf-gf)/delta + 4
+	}
+	angle := hue * math.Pi / 3
+
+	return saturation * math.Cos(angle), saturation * math.Sin(angle), lightness
+}
+
+func fetchCalendarColors(ctx context.Context, srv *calendar.Service) map[string]calendar.ColorDefinition {
+	colors, err := srv.Colors.Get().Context(ctx).Do()
+	if err != nil {
+		log.Printf("Unable to retrieve calendar colors: %v", err)
+		return make(map[string]calendar.ColorDefinition)
+	}
+
+	return colors.Event
+}
+
+// Run colors mode - list the account's event palette with current mappings
+func runColorsMode(cfg *Config) {
+	cs, err := initCalendarService(cfg)
+	if err != nil {
+		log.Fatalf("Authentication failed: %v", err)
+	}
+
+	if len(cs.colorDefinitions) == 0 {
+		log.Fatalf("No event colors returned by Google Calendar")
+	}
+
+	ids := make([]string, 0, len(cs.colorDefinitions))
+	for id := range cs.colorDefinitions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.Atoi(ids[i])
+		b, _ := strconv.Atoi(ids[j])
+		return a < b
+	})
+
+	fmt.Println("🎨 Event color palette")
+	fmt.Println(strings.Repeat("=", 50))
+	fmt.Println("")
+	for _, id := range ids {
+		def := cs.colorDefinitions[id]
+		info := getColorInfo(id, cfg.Categories, cs.colorDefinitions)
+
+		source := "Google default"
+		if _, configured := cfg.Categories[id]; configured {
+			source = "configured"
+		}
+
+		fmt.Printf("%3s  %s  %s  %-25s", id, def.Background, getEmojiFromHex(def.Background), info.Name)
+		fmt.Printf(" → %s", info.Emoji)
+		if info.Class != "" {
+			fmt.Printf(" [%s]", info.Class)
+		}
+		fmt.Printf(" (%s)\n", source)
+	}
+
+	for id := range cfg.Categories {
+		if _, exists := cs.colorDefinitions[id]; !exists {
+			fmt.Fprintf(os.Stderr, "⚠️  Category %q is configured but is not a color in this account's palette\n", id)
+		}
+	}
+}
@@ -0,0 +1,609 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every user-tunable setting. It is built from the defaults,
+// then the config file, then the environment, in that order.
+type Config struct {
+	Google         GoogleConfig              `yaml:"google"`
+	Auth           AuthConfig                `yaml:"auth"`
+	Accounts       []AccountConfig           `yaml:"accounts,omitempty"`
+	Calendars      []string                  `yaml:"calendars"`
+	Timezone       string                    `yaml:"timezone"`
+	WorkingHours   WorkingHoursConfig        `yaml:"working_hours"`
+	Categories     map[string]CategoryConfig `yaml:"categories"`
+	Classification ClassificationConfig      `yaml:"classification"`
+	EventTypes     EventTypesConfig          `yaml:"event_types"`
+	Formatting     FormattingConfig          `yaml:"formatting"`
+	Privacy        PrivacyConfig             `yaml:"privacy"`
+	Server         ServerConfig              `yaml:"server"`
+	Cache          CacheConfig               `yaml:"cache"`
+
+	path       string
+	location   *time.Location
+	account    AccountConfig
+	classifier *classifier
+	limiter    *rateLimiter
+}
+
+// GoogleConfig holds the OAuth client credentials.
+type GoogleConfig struct {
+	ClientID     string `yaml:"client_id"`
+	ProjectID    string `yaml:"project_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// Deadline of each Calendar API call; 0 disables it
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	// Retries of transient failures, and the requests per second (0
+	// disables limiting) and burst allowed by the client-side limiter
+	MaxRetries int     `yaml:"max_retries"`
+	RateLimit  float64 `yaml:"rate_limit"`
+	RateBurst  int     `yaml:"rate_burst"`
+}
+
+// AuthConfig controls the OAuth flow and where the token is kept.
+type AuthConfig struct {
+	OAuthPort int    `yaml:"oauth_port"`
+	TokenPath string `yaml:"token_path,omitempty"`
+}
+
+// AccountConfig describes one Google account and the calendars to read from it.
+type AccountConfig struct {
+	Name      string   `yaml:"name"`
+	TokenPath string   `yaml:"token_path,omitempty"`
+	Calendars []string `yaml:"calendars,omitempty"`
+}
+
+// WorkingHoursConfig describes the user's regular working day.
+type WorkingHoursConfig struct {
+	Start string   `yaml:"start"`
+	End   string   `yaml:"end"`
+	Days  []string `yaml:"days"`
+}
+
+// CategoryConfig is the display name, emoji and optional class (meeting,
+// focus or personal) for a Google colorId. An empty emoji uses the one
+// closest to the color in the account's palette.
+type CategoryConfig struct {
+	Name  string `yaml:"name"`
+	Emoji string `yaml:"emoji,omitempty"`
+	Class string `yaml:"class,omitempty"`
+}
+
+// FormattingConfig controls how agendas are rendered.
+type FormattingConfig struct {
+	DescriptionLength int    `yaml:"description_length"`
+	TimeFormat        string `yaml:"time_format"`
+}
+
+// PrivacyConfig controls which event details are exposed.
+type PrivacyConfig struct {
+	HideDescriptions bool   `yaml:"hide_descriptions"`
+	HideLocations    bool   `yaml:"hide_locations"`
+	PrivateEvents    string `yaml:"private_events"`
+}
+
+// Values accepted by privacy.private_events.
+const (
+	privateEventsShow = "show"
+	privateEventsBusy = "busy"
+	privateEventsHide = "hide"
+)
+
+const defaultTokenFile = "token.json"
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+var clockPattern = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+
+func defaultConfig() *Config {
+	return &Config{
+		Google: GoogleConfig{
+			RequestTimeout: 30 * time.Second,
+			MaxRetries:     4,
+			RateLimit:      10,
+			RateBurst:      20,
+		},
+		Auth: AuthConfig{
+			OAuthPort: 8080,
+		},
+		Calendars:  []string{"primary"},
+		Categories: map[string]CategoryConfig{},
+		Classification: ClassificationConfig{
+			Rules: defaultRules(),
+		},
+		Timezone: "Local",
+		WorkingHours: WorkingHoursConfig{
+			Start: "09:00",
+			End:   "18:00",
+			Days:  []string{"monday", "tuesday", "wednesday", "thursday", "friday"},
+		},
+		Formatting: FormattingConfig{
+			DescriptionLength: 100,
+			TimeFormat:        "15:04",
+		},
+		Privacy: PrivacyConfig{
+			PrivateEvents: privateEventsShow,
+		},
+		Server: ServerConfig{
+			Transport:    transportStdio,
+			Listen:       ":8080",
+			BasePath:     "/mcp",
+			PollInterval: time.Minute,
+		},
+		Cache: CacheConfig{
+			MaxAge:      5 * time.Minute,
+			PastDays:    7,
+			FutureDays:  60,
+			HistoryDays: 14,
+		},
+	}
+}
+
+// defaultConfigPath returns the config file location in the XDG config dir.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "agenda-mcp", "config.yaml")
+}
+
+// loadConfig builds the effective configuration. An explicit path must
+// exist; otherwise the default location is used if present.
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath()
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := cfg.parse(path, data); err != nil {
+				return nil, err
+			}
+			cfg.path = path
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("unable to read config file: %v", err)
+		}
+	}
+
+	cfg.applyEnv()
+
+	location, err := loadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	cfg.location = location
+
+	cfg.classifier, err = newClassifier(cfg.Classification)
+	if err != nil {
+		return nil, err
+	}
+	cfg.limiter = newRateLimiter(cfg.Google.RateLimit, cfg.Google.RateBurst)
+
+	if err := cfg.selectAccount(""); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// parse decodes the YAML document over the defaults and validates it,
+// reporting every problem with its line number.
+func (c *Config) parse(path string, data []byte) error {
+	name := filepath.Base(path)
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+
+	// Unknown fields and type mismatches are collected alongside the
+	// semantic checks so every problem is reported at once.
+	var problems []string
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		var typeErr *yaml.TypeError
+		switch {
+		case errors.As(err, &typeErr):
+			problems = append(problems, typeErr.Errors...)
+		case errors.Is(err, io.EOF):
+			return nil
+		default:
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	problems = append(problems, c.validate(&root)...)
+	if len(problems) > 0 {
+		return configErrors(name, problems)
+	}
+	return nil
+}
+
+// configErrors formats yaml-style "line N: message" problems as "file:N: message".
+func configErrors(name string, problems []string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid config file %s:", name)
+	for _, problem := range problems {
+		if rest, ok := strings.CutPrefix(problem, "line "); ok {
+			if n, msg, found := strings.Cut(rest, ": "); found {
+				fmt.Fprintf(&b, "\n  %s:%s: %s", name, n, msg)
+				continue
+			}
+		}
+		fmt.Fprintf(&b, "\n  %s: %s", name, problem)
+	}
+	return errors.New(b.String())
+}
+
+// validate checks the semantic constraints the YAML decoder can't express.
+func (c *Config) validate(root *yaml.Node) []string {
+	var problems []string
+	report := func(msg string, path ...string) {
+		problems = append(problems, fmt.Sprintf("line %d: %s", nodeLine(root, path...), msg))
+	}
+
+	if c.Auth.OAuthPort < 1 || c.Auth.OAuthPort > 65535 {
+		report(fmt.Sprintf("oauth_port must be between 1 and 65535, got %d", c.Auth.OAuthPort), "auth", "oauth_port")
+	}
+
+	seen := make(map[string]bool)
+	for i, account := range c.Accounts {
+		index := strconv.Itoa(i)
+		if account.Name == "" {
+			report("account name is required", "accounts", index)
+		} else if seen[account.Name] {
+			report(fmt.Sprintf("duplicate account name %q", account.Name), "accounts", index, "name")
+		}
+		seen[account.Name] = true
+		for j, id := range account.Calendars {
+			if strings.TrimSpace(id) == "" {
+				report("calendar ID must not be empty", "accounts", index, "calendars", strconv.Itoa(j))
+			}
+		}
+	}
+
+	if len(c.Calendars) == 0 {
+		report("at least one calendar is required", "calendars")
+	}
+	for i, id := range c.Calendars {
+		if strings.TrimSpace(id) == "" {
+			report("calendar ID must not be empty", "calendars", strconv.Itoa(i))
+		}
+	}
+
+	if _, err := loadLocation(c.Timezone); err != nil {
+		report(err.Error(), "timezone")
+	}
+
+	start, startOK := c.WorkingHours.Start, clockPattern.MatchString(c.WorkingHours.Start)
+	end, endOK := c.WorkingHours.End, clockPattern.MatchString(c.WorkingHours.End)
+	if !startOK {
+		report(fmt.Sprintf("working_hours.start must be HH:MM, got %q", start), "working_hours", "start")
+	}
+	if !endOK {
+		report(fmt.Sprintf("working_hours.end must be HH:MM, got %q", end), "working_hours", "end")
+	}
+	if startOK && endOK && start >= end {
+		report("working_hours.start must be before working_hours.end", "working_hours", "end")
+	}
+	for i, day := range c.WorkingHours.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			report(fmt.Sprintf("unknown weekday %q", day), "working_hours", "days", strconv.Itoa(i))
+		}
+	}
+
+	for id, category := range c.Categories {
+		if category.Name == "" {
+			report(fmt.Sprintf("category %q needs a name", id), "categories", id)
+		}
+		switch category.Class {
+		case "", classMeeting, classFocus, classPersonal:
+		default:
+			report(fmt.Sprintf("category %q class must be one of meeting, focus, personal, got %q", id, category.Class), "categories", id, "class")
+		}
+	}
+
+	for i, rc := range c.Classification.Rules {
+		for _, problem := range validateRule(rc) {
+			report(problem.message, "classification", "rules", strconv.Itoa(i), problem.field)
+		}
+	}
+
+	for i, eventType := range c.EventTypes.Include {
+		if !isEventType(eventType) {
+			report(fmt.Sprintf("unknown event type %q", eventType), "event_types", "include", strconv.Itoa(i))
+		}
+	}
+	for i, eventType := range c.EventTypes.Exclude {
+		if !isEventType(eventType) {
+			report(fmt.Sprintf("unknown event type %q", eventType), "event_types", "exclude", strconv.Itoa(i))
+		}
+	}
+
+	if c.Formatting.DescriptionLength < 0 {
+		report("description_length must not be negative", "formatting", "description_length")
+	}
+	if c.Formatting.TimeFormat == "" {
+		report("time_format must not be empty", "formatting", "time_format")
+	}
+
+	switch c.Privacy.PrivateEvents {
+	case privateEventsShow, privateEventsBusy, privateEventsHide:
+	default:
+		report(fmt.Sprintf("private_events must be one of show, busy, hide, got %q", c.Privacy.PrivateEvents), "privacy", "private_events")
+	}
+
+	if err := c.Server.validate(); err != nil {
+		report(err.Error(), "server", "transport")
+	}
+	for _, problem := range c.Server.Auth.validate() {
+		report(problem.message, "server", "auth", problem.field)
+	}
+	if c.Google.RequestTimeout < 0 {
+		report(fmt.Sprintf("request_timeout must be 0 (no deadline) or positive, got %s", c.Google.RequestTimeout), "google", "request_timeout")
+	}
+	if c.Google.MaxRetries < 0 {
+		report(fmt.Sprintf("max_retries must not be negative, got %d", c.Google.MaxRetries), "google", "max_retries")
+	}
+	if c.Google.RateLimit < 0 {
+		report(fmt.Sprintf("rate_limit must be 0 (unlimited) or positive, got %g", c.Google.RateLimit), "google", "rate_limit")
+	}
+	if c.Google.RateLimit > 0 && c.Google.RateBurst < 1 {
+		report(fmt.Sprintf("rate_burst must be at least 1, got %d", c.Google.RateBurst), "google", "rate_burst")
+	}
+	if c.Server.PollInterval != 0 && c.Server.PollInterval < minPollInterval {
+		report(fmt.Sprintf("poll_interval must be 0 (disabled) or at least %s, got %s", minPollInterval, c.Server.PollInterval), "server", "poll_interval")
+	}
+	for _, problem := range c.Server.MultiTenant.validate(c.Server.Auth) {
+		report(problem.message, "server", "multi_tenant", problem.field)
+	}
+	if c.Cache.MaxAge < 0 {
+		report(fmt.Sprintf("max_age must not be negative, got %s", c.Cache.MaxAge), "cache", "max_age")
+	}
+	if c.Cache.PastDays < 0 {
+		report(fmt.Sprintf("past_days must not be negative, got %d", c.Cache.PastDays), "cache", "past_days")
+	}
+	if c.Cache.FutureDays < 0 {
+		report(fmt.Sprintf("future_days must not be negative, got %d", c.Cache.FutureDays), "cache", "future_days")
+	}
+	if c.Cache.HistoryDays < 1 {
+		report(fmt.Sprintf("history_days must be at least 1, got %d", c.Cache.HistoryDays), "cache", "history_days")
+	}
+
+	return problems
+}
+
+// nodeLine returns the line of the node at path, falling back to the
+// closest existing parent. Path elements index mappings by key and
+// sequences by position.
+func nodeLine(root *yaml.Node, path ...string) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := node.Line
+	for _, key := range path {
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					next = node.Content[i+1]
+					line = node.Content[i].Line
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(key); err == nil && i < len(node.Content) {
+				next = node.Content[i]
+				line = next.Line
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+		if node.Kind != yaml.MappingNode && node.Kind != yaml.SequenceNode {
+			line = node.Line
+		}
+	}
+	return line
+}
+
+// applyEnv lets environment variables override the Google credentials,
+// which keeps existing MCP client configurations working.
+func (c *Config) applyEnv() {
+	if v := os.Getenv("client_id"); v != "" {
+		c.Google.ClientID = v
+	}
+	if v := os.Getenv("project_id"); v != "" {
+		c.Google.ProjectID = v
+	}
+	if v := os.Getenv("client_secret"); v != "" {
+		c.Google.ClientSecret = v
+	}
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", name)
+	}
+	return location, nil
+}
+
+// selectAccount makes the named account current. An empty name selects
+// the first configured account, or the implicit default account built
+// from the top-level settings.
+func (c *Config) selectAccount(name string) error {
+	if len(c.Accounts) == 0 {
+		if name != "" && name != "default" {
+			return fmt.Errorf("unknown account %q: no accounts are configured", name)
+		}
+		c.account = AccountConfig{Name: "default", TokenPath: c.Auth.TokenPath}
+	} else if name == "" {
+		c.account = c.Accounts[0]
+	} else {
+		found := false
+		for _, account := range c.Accounts {
+			if account.Name == name {
+				c.account = account
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown account %q", name)
+		}
+	}
+
+	if c.account.TokenPath == "" {
+		c.account.TokenPath = c.Auth.TokenPath
+	}
+	if len(c.account.Calendars) == 0 {
+		c.account.Calendars = c.Calendars
+	}
+	return nil
+}
+
+// calendars returns the calendar IDs of the current account.
+func (c *Config) calendars() []string {
+	return c.account.Calendars
+}
+
+// tokenPath returns where the current account's token is stored. An empty
+// result keeps the historical defaults (token.json in the working
+// directory for text mode, next to the executable for MCP mode).
+func (c *Config) tokenPath() string {
+	return expandHome(c.account.TokenPath)
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// isWorkday reports whether day is one of the configured working days.
+func (c *Config) isWorkday(day time.Weekday) bool {
+	for _, name := range c.WorkingHours.Days {
+		if weekdays[strings.ToLower(name)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// workingHours returns the working hours of the day starting at day, or
+// false when it isn't a working day.
+func (c *Config) workingHours(day time.Time) (start, end time.Time, ok bool) {
+	if !c.isWorkday(day.Weekday()) {
+		return time.Time{}, time.Time{}, false
+	}
+	start, end = clockTimes(day, c.WorkingHours.Start, c.WorkingHours.End)
+	return start, end, true
+}
+
+// clockTimes returns the HH:MM times start and end of day.
+func clockTimes(day time.Time, start, end string) (time.Time, time.Time) {
+	at := func(clock string) time.Time {
+		t, _ := time.Parse("15:04", clock)
+		return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, day.Location())
+	}
+	return at(start), at(end)
+}
+
+// masked returns a copy of the configuration that is safe to print.
+func (c *Config) masked() *Config {
+	out := *c
+	out.Google.ClientSecret = maskSecret(c.Google.ClientSecret)
+	if c.Server.Auth.OAuth != nil {
+		oauth := *c.Server.Auth.OAuth
+		oauth.ClientSecret = maskSecret(oauth.ClientSecret)
+		out.Server.Auth.OAuth = &oauth
+	}
+	return &out
+}
+
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return "********"
+	}
+	return secret[:4] + "********"
+}
+
+// runConfigMode handles the "config" subcommands.
+func runConfigMode(cfg *Config, args []string) {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Println("Usage: agenda-mcp config show")
+		fmt.Println("  Prints the effective configuration with secrets masked.")
+		os.Exit(1)
+	}
+
+	if cfg.path != "" {
+		fmt.Printf("# Loaded from %s\n", cfg.path)
+	} else {
+		fmt.Printf("# No config file found, using defaults (searched %s)\n", defaultConfigPath())
+	}
+	fmt.Printf("# Active account: %s\n", cfg.account.Name)
+	if cfg.Cache.Enabled {
+		fmt.Printf("# ⚠️  Cached events, with their descriptions and attendees, are stored unencrypted in %s\n", cfg.Cache.path())
+	}
+
+	data, err := yaml.Marshal(cfg.masked())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to render config: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(unescapeYAML(string(data)))
+}
+
+var yamlEscape = regexp.MustCompile(`\\U([0-9A-Fa-f]{8})`)
+
+// unescapeYAML turns the \UXXXXXXXX escapes the YAML encoder uses for
+// emoji back into the characters themselves so they stay readable.
+func unescapeYAML(s string) string {
+	return yamlEscape.ReplaceAllStringFunc(s, func(escape string) string {
+		r, err := strconv.ParseUint(escape[2:], 16, 32)
+		if err != nil {
+			return escape
+		}
+		return string(rune(r))
+	})
+}
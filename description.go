@@ -0,0 +1,250 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlTagPattern recognises the rich text descriptions of Google Calendar,
+// which use a small set of HTML tags.
+var htmlTagPattern = regexp.MustCompile(`(?i)</?(a|b|br|div|em|i|li|ol|p|span|strong|u|ul)\b[^>]*>`)
+
+// urlPattern matches bare links in text.
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"'\]]+`)
+
+// cleanDescription converts an event description to text and extracts
+// its links. HTML descriptions keep their paragraphs and lists, with
+// links reduced to their text.
+func cleanDescription(description string) (text string, links []string) {
+	if htmlTagPattern.MatchString(description) {
+		text, links = htmlToText(description)
+	} else {
+		text = strings.TrimSpace(strings.ReplaceAll(description, "\r\n", "\n"))
+	}
+	for _, link := range urlPattern.FindAllString(text, -1) {
+		links = appendLink(links, unwrapRedirect(strings.TrimRight(link, ".,;:!?)")))
+	}
+	return text, links
+}
+
+// htmlToText renders an HTML fragment as text, returning the targets of
+// its links.
+func htmlToText(fragment string) (string, []string) {
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div})
+	if err != nil {
+		return strings.TrimSpace(htmlTagPattern.ReplaceAllString(fragment, " ")), nil
+	}
+
+	var output strings.Builder
+	var links []string
+	var lists []int // item counters of the enclosing lists, -1 for bullets
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			text := strings.ReplaceAll(n.Data, "\u00a0", " ")
+			output.WriteString(whitespacePattern.ReplaceAllString(text, " "))
+			return
+		case html.ElementNode:
+		default:
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+			return
+		}
+
+		switch n.Data {
+		case "script", "style":
+			return
+		case "br":
+			output.WriteString("\n")
+			return
+		case "p", "div":
+			output.WriteString("\n\n")
+		case "ul", "ol":
+			if len(lists) == 0 {
+				output.WriteString("\n")
+			}
+			counter := -1
+			if n.Data == "ol" {
+				counter = 0
+			}
+			lists = append(lists, counter)
+			defer func() { lists = lists[:len(lists)-1] }()
+		case "li":
+			output.WriteString("\n" + strings.Repeat("  ", max(len(lists)-1, 0)))
+			if len(lists) > 0 && lists[len(lists)-1] >= 0 {
+				lists[len(lists)-1]++
+				output.WriteString(strconv.Itoa(lists[len(lists)-1]) + ". ")
+			} else {
+				output.WriteString("- ")
+			}
+		case "a":
+			for _, attr := range n.Attr {
+				if attr.Key == "href" && (strings.HasPrefix(attr.Val, "http://") || strings.HasPrefix(attr.Val, "https://")) {
+					links = appendLink(links, unwrapRedirect(attr.Val))
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		switch {
+		case n.Data == "p" || n.Data == "div":
+			output.WriteString("\n\n")
+		case (n.Data == "ul" || n.Data == "ol") && len(lists) == 1:
+			// Nested lists continue their parent list
+			output.WriteString("\n\n")
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return tidyLines(output.String()), links
+}
+
+// tidyLines collapses the spaces of every line and keeps at most one
+// blank line in a row. Only nested list items stay indented.
+func tidyLines(text string) string {
+	var lines []string
+	blank := true
+	for _, line := range strings.Split(text, "\n") {
+		content := strings.TrimLeft(line, " ")
+		indent := line[:len(line)-len(content)]
+		content = strings.TrimSpace(whitespacePattern.ReplaceAllString(content, " "))
+		if content == "" {
+			if !blank {
+				lines = append(lines, "")
+			}
+			blank = true
+			continue
+		}
+		if !strings.HasPrefix(content, "- ") && !numberedItemPattern.MatchString(content) {
+			indent = ""
+		}
+		lines = append(lines, indent+content)
+		blank = false
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+var (
+	numberedItemPattern = regexp.MustCompile(`^\d+\. `)
+	whitespacePattern   = regexp.MustCompile(`\s+`)
+)
+
+// unwrapRedirect returns the target of Google's link redirector, which
+// rich text descriptions often use.
+func unwrapRedirect(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.Host != "www.google.com" || u.Path != "/url" {
+		return link
+	}
+	if target := u.Query().Get("q"); strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		return target
+	}
+	return link
+}
+
+func appendLink(links []string, link string) []string {
+	for _, existing := range links {
+		if existing == link {
+			return links
+		}
+	}
+	return append(links, link)
+}
+
+// truncateText shortens text to at most limit characters, ending with
+// "...". Characters are counted as they are displayed, so accented
+// letters and emoji sequences are never split. A limit of 0 keeps the
+// whole text.
+func truncateText(text string, limit int) string {
+	if limit <= 0 {
+		return text
+	}
+	starts := graphemeStarts(text)
+	if len(starts) <= limit {
+		return text
+	}
+	return strings.TrimRightFunc(text[:starts[limit]], unicode.IsSpace) + "..."
+}
+
+// graphemeStarts returns the byte offsets at which user-perceived
+// characters start. It approximates Unicode text segmentation for what
+// appears in calendars: combining marks, variation selectors, emoji
+// modifiers and tags, zero width joiner sequences and flags.
+func graphemeStarts(text string) []int {
+	var starts []int
+	var previous rune
+	regionalIndicators := 0
+	for i, r := range text {
+		extends := i > 0 && (unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+			r == zeroWidthJoiner || previous == zeroWidthJoiner ||
+			(r >= 0xfe00 && r <= 0xfe0f) ||
+			(r >= 0x1f3fb && r <= 0x1f3ff) ||
+			(r >= 0xe0020 && r <= 0xe007f))
+		if isRegionalIndicator(r) {
+			// Flags are pairs of regional indicators
+			extends = extends || regionalIndicators%2 == 1
+			regionalIndicators++
+		} else {
+			regionalIndicators = 0
+		}
+		previous = r
+		if !extends {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+const zeroWidthJoiner = '\u200d'
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+// oneLine joins the lines of text, for descriptions shown inline.
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// meetingLinkPattern matches links of the common video call services.
+var meetingLinkPattern = regexp.MustCompile(`https://(?:meet\.google\.com|[\w.-]*zoom\.us|teams\.microsoft\.com|teams\.live\.com|[\w.-]*webex\.com)/[^\s"'<>)\]]*`)
+
+// otherLinks returns the links of an event's description except its join
+// link.
+func otherLinks(event CalendarEvent) []string {
+	join := joinLink(event)
+	var links []string
+	for _, link := range event.Links {
+		if link != join {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// joinLink returns the link to join an event's call: its conference, or
+// the first video call link in its location or description.
+func joinLink(event CalendarEvent) string {
+	if event.ConferenceURL != "" {
+		return event.ConferenceURL
+	}
+	if link := meetingLinkPattern.FindString(event.Location); link != "" {
+		return link
+	}
+	for _, link := range event.Links {
+		if meetingLinkPattern.MatchString(link) {
+			return link
+		}
+	}
+	return ""
+}
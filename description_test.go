@@ -0,0 +1,89 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCleanDescription(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		text        string
+		links       []string
+	}{
+		{"plain", "Plain text\r\nsecond line", "Plain text\nsecond line", nil},
+		{"lists", "<p>Agenda:</p><ul><li>One</li><li>Two<ol><li>Sub a</li><li>Sub b</li></ol></li></ul><p>Bye&nbsp;now</p>",
+			"Agenda:\n\n- One\n- Two\n  1. Sub a\n  2. Sub b\n\nBye now", nil},
+		{"line breaks", "Line one<br>Line two<br><br><br>Line three", "Line one\nLine two\n\nLine three", nil},
+		{"scripts and styles", "<p>a</p><script>alert(1)</script><style>p{}</style><p>b</p>", "a\n\nb", nil},
+		{"not html", "5 < 6 and 7 > 3", "5 < 6 and 7 > 3", nil},
+		{"entities", "<b>Tom &amp; Jerry</b> &lt;3", "Tom & Jerry <3", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, links := cleanDescription(tt.description)
+			if text != tt.text || !slices.Equal(links, tt.links) {
+				t.Errorf("cleanDescription(%q) = %q, %q, want %q, %q", tt.description, text, links, tt.text, tt.links)
+			}
+		})
+	}
+}
+
+func TestDescriptionLinks(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		links       []string
+	}{
+		{"anchor text is kept, target extracted", `<a href="https://example.com/notes">Notes</a>`, []string{"https://example.com/notes"}},
+		{"google redirect", `<a href="https://www.google.com/url?q=https://zoom.us/j/123&sa=D">here</a>`, []string{"https://zoom.us/j/123"}},
+		{"redirect to a non-web link", `<a href="https://www.google.com/url?q=javascript:alert(1)">x</a>`, []string{"https://www.google.com/url?q=javascript:alert(1)"}},
+		{"other schemes", `<a href="mailto:x@example.com">mail</a> <a href="javascript:alert(1)">js</a>`, nil},
+		{"bare links lose trailing punctuation", "see https://example.com/doc. and (https://example.com/x)", []string{"https://example.com/doc", "https://example.com/x"}},
+		{"duplicates", `<a href="https://example.com/a">https://example.com/a</a>`, []string{"https://example.com/a"}},
+		{"in order of appearance", "<p>https://b.example.com</p><a href=\"https://a.example.com\">a</a>", []string{"https://a.example.com", "https://b.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, links := cleanDescription(tt.description); !slices.Equal(links, tt.links) {
+				t.Errorf("links of %q = %q, want %q", tt.description, links, tt.links)
+			}
+		})
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  string
+	}{
+		{"short", "abc", 3, "abc"},
+		{"ascii", "abcdef", 3, "abc..."},
+		{"no limit", "abcdef", 0, "abcdef"},
+		{"trailing space", "ab cd", 3, "ab..."},
+		{"precomposed accents", "héllo", 2, "hé..."},
+		{"combining accents", "he\u0301\u0300llo", 2, "he\u0301\u0300..."},
+		{"zwj sequences", "👩\u200d💻👨\u200d👩\u200d👧\u200d👦👩\u200d💻", 2, "👩\u200d💻👨\u200d👩\u200d👧\u200d👦..."},
+		{"flags", "🇫🇷🇩🇪🇯🇵", 2, "🇫🇷🇩🇪..."},
+		{"odd regional indicators", "🇫🇷🇩", 1, "🇫🇷..."},
+		{"skin tones", "👍🏽👍🏽👍🏽", 1, "👍🏽..."},
+		{"variation selectors", "❤️❤️❤️", 2, "❤️❤️..."},
+		{"tag sequences", "🏴\U000e0067\U000e0062\U000e0065\U000e006e\U000e0067\U000e007fx", 1, "🏴\U000e0067\U000e0062\U000e0065\U000e006e\U000e0067\U000e007f..."},
+		{"counted as displayed", "👩\u200d💻👩\u200d💻", 2, "👩\u200d💻👩\u200d💻"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateText(tt.text, tt.limit)
+			if got != tt.want {
+				t.Errorf("truncateText(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+			}
+			if !strings.HasPrefix(tt.text, strings.TrimSuffix(got, "...")) {
+				t.Errorf("truncateText(%q, %d) = %q isn't a prefix", tt.text, tt.limit, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// eventDetail is an event with everything Google Calendar knows about it,
+// as returned by get_event and the event resources.
+type eventDetail struct {
+	eventResource
+	Status        string `json:"status,omitempty"`
+	HTMLLink      string `json:"html_link,omitempty"`
+	OrganizerName string `json:"organizer_name,omitempty"`
+	Creator       string `json:"creator,omitempty"`
+	// Recurrence holds the RRULE, EXDATE and RDATE lines of the series
+	Recurrence  []string          `json:"recurrence,omitempty"`
+	Conference  *eventConference  `json:"conference,omitempty"`
+	Attachments []eventAttachment `json:"attachments,omitempty"`
+	// Reminders are the calendar's defaults when DefaultReminders is set
+	Reminders        []eventReminder `json:"reminders,omitempty"`
+	DefaultReminders bool            `json:"default_reminders,omitempty"`
+	Created          string          `json:"created,omitempty"`
+	Updated          string          `json:"updated,omitempty"`
+}
+
+// eventConference is the video call or dial-in of an event.
+type eventConference struct {
+	Name        string            `json:"name,omitempty"`
+	ID          string            `json:"id,omitempty"`
+	EntryPoints []conferenceEntry `json:"entry_points,omitempty"`
+}
+
+// conferenceEntry is one way to join a conference: video, phone, sip or
+// more.
+type conferenceEntry struct {
+	Type  string `json:"type"`
+	URI   string `json:"uri"`
+	Label string `json:"label,omitempty"`
+	PIN   string `json:"pin,omitempty"`
+}
+
+// eventAttachment is a file attached to an event, usually on Drive.
+type eventAttachment struct {
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	MIMEType string `json:"mime_type,omitempty"`
+}
+
+// eventReminder is a popup or email reminder before an event.
+type eventReminder struct {
+	Method  string `json:"method"`
+	Minutes int64  `json:"minutes"`
+}
+
+// getEventDetail looks up an event like findEvent, with all its details.
+func (cs *CalendarService) getEventDetail(ctx context.Context, ref string) (eventDetail, error) {
+	item, event, err := cs.findEventItem(ctx, ref)
+	if err != nil {
+		return eventDetail{}, err
+	}
+	return cs.eventDetail(ctx, item, event), nil
+}
+
+// eventDetail adds the details of the API event to event.
+func (cs *CalendarService) eventDetail(ctx context.Context, item *calendar.Event, event CalendarEvent) eventDetail {
+	detail := eventDetail{
+		eventResource: eventResource{URI: eventURI(event), CalendarEvent: event},
+		Status:        item.Status,
+		HTMLLink:      item.HtmlLink,
+		Recurrence:    item.Recurrence,
+		Created:       item.Created,
+		Updated:       item.Updated,
+	}
+	// Private events shown as busy keep none of their details
+	if cs.maskedBusy(item) {
+		detail.Recurrence = nil
+		return detail
+	}
+	if item.Organizer != nil {
+		detail.OrganizerName = item.Organizer.DisplayName
+	}
+	if item.Creator != nil {
+		detail.Creator = item.Creator.Email
+	}
+	if item.ConferenceData != nil {
+		detail.Conference = toEventConference(item.ConferenceData)
+	}
+	for _, attachment := range item.Attachments {
+		detail.Attachments = append(detail.Attachments, eventAttachment{
+			Title:    attachment.Title,
+			URL:      attachment.FileUrl,
+			MIMEType: attachment.MimeType,
+		})
+	}
+	if item.Reminders != nil {
+		detail.DefaultReminders = item.Reminders.UseDefault
+		detail.Reminders = toEventReminders(item.Reminders.Overrides)
+		if item.Reminders.UseDefault {
+			detail.Reminders = cs.defaultReminders(ctx, event.CalendarID)
+		}
+	}
+
+	// Instances only know their series, which holds the rule
+	if len(detail.Recurrence) == 0 && item.RecurringEventId != "" {
+		if series, ok := cs.recurringSeries(ctx, event.CalendarID, item.RecurringEventId); ok {
+			detail.Recurrence = series.Recurrence
+		}
+	}
+	return detail
+}
+
+// defaultReminders returns the default reminders of a calendar, or none
+// when they can't be read.
+func (cs *CalendarService) defaultReminders(ctx context.Context, calendarID string) []eventReminder {
+	ctx, cancel := cs.callContext(ctx)
+	defer cancel()
+	entry, err := cs.service.CalendarList.Get(calendarID).Context(ctx).Do()
+	if err != nil {
+		return nil
+	}
+	return toEventReminders(entry.DefaultReminders)
+}
+
+func toEventReminders(reminders []*calendar.EventReminder) []eventReminder {
+	var out []eventReminder
+	for _, reminder := range reminders {
+		out = append(out, eventReminder{Method: reminder.Method, Minutes: reminder.Minutes})
+	}
+	return out
+}
+
+func toEventConference(data *calendar.ConferenceData) *eventConference {
+	conference := &eventConference{ID: data.ConferenceId}
+	if data.ConferenceSolution != nil {
+		conference.Name = data.ConferenceSolution.Name
+	}
+	for _, entry := range data.EntryPoints {
+		pin := entry.Pin
+		if pin == "" {
+			pin = entry.Passcode
+		}
+		conference.EntryPoints = append(conference.EntryPoints, conferenceEntry{
+			Type:  entry.EntryPointType,
+			URI:   entry.Uri,
+			Label: entry.Label,
+			PIN:   pin,
+		})
+	}
+	if len(conference.EntryPoints) == 0 {
+		return nil
+	}
+	return conference
+}
+
+// renderEventDetail renders an event in an output format. CSV and ICS
+// only have the fields of the agenda.
+func renderEventDetail(detail eventDetail, format string, cfg *Config) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", formatText:
+		return formatEventText(detail, cfg, false), nil
+	case formatPlain:
+		return formatEventText(detail, cfg, true), nil
+	case formatMarkdown:
+		return formatEventMarkdown(detail, cfg), nil
+	case formatJSON:
+		out, err := json.MarshalIndent(detail, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+	formatter, err := newFormatter(format, cfg)
+	if err != nil {
+		return "", err
+	}
+	day := detail.Start.In(cfg.location)
+	return formatter.format(agendaView{
+		URI:    detail.URI,
+		Start:  time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, cfg.location),
+		End:    detail.End,
+		Events: []CalendarEvent{detail.CalendarEvent},
+	})
+}
+
+// formatEventText renders an event with all its details for terminals,
+// with emoji unless plain.
+func formatEventText(detail eventDetail, cfg *Config, plain bool) string {
+	label := func(emoji, name string) string {
+		if plain {
+			return name + ": "
+		}
+		return emoji + " "
+	}
+	heading := func(emoji, name string) string {
+		if plain {
+			return name
+		}
+		return emoji + " " + name
+	}
+	event := detail.CalendarEvent
+	var output strings.Builder
+	output.WriteString(label("📌", "Event") + event.Summary + "\n")
+	output.WriteString(strings.Repeat("=", 50) + "\n\n")
+
+	output.WriteString(label("🗓️ ", "When") + eventWhen(event, cfg) + "\n")
+	if repeats := recurrenceLine(event); repeats != "" {
+		output.WriteString(label("🔁", "Repeats") + repeats + "\n")
+	}
+	category := fmt.Sprintf("%s %s%s", event.CategoryEmoji, event.Category, eventTypeTag(event))
+	if plain {
+		category = event.Category
+		if typeLabel := eventTypeLabel(event); typeLabel != "" {
+			category += fmt.Sprintf(" [%s]", typeLabel)
+		}
+	}
+	output.WriteString(label("🏷️ ", "Category") + category + "\n")
+	if status := eventTypeStatus(event); status != "" {
+		output.WriteString(label("🚫", "Status") + strings.TrimPrefix(status, "🚫 ") + "\n")
+	}
+	if event.WorkingLocation != "" {
+		output.WriteString(label("🏢", "Working from") + event.WorkingLocation + "\n")
+	}
+	if event.Location != "" {
+		output.WriteString(label("📍", "Location") + event.Location + "\n")
+	}
+	if link := joinLink(event); link != "" {
+		output.WriteString(label("🎥", "Join") + link + "\n")
+	}
+	for _, entry := range dialIns(detail.Conference) {
+		output.WriteString(label("📞", "Dial-in") + entry + "\n")
+	}
+	if organizer := organizerName(detail); organizer != "" {
+		output.WriteString(label("👤", "Organizer") + organizer + "\n")
+	}
+	if detail.Creator != "" && detail.Creator != event.Organizer {
+		output.WriteString(heading("✍️ ", "Created by") + " " + detail.Creator + "\n")
+	}
+	if len(event.Attendees) > 0 {
+		output.WriteString(heading("👥", fmt.Sprintf("Guests (%d):\n", len(event.Attendees))))
+		for i, guest := range guestList(event) {
+			marker := "-"
+			if !plain {
+				marker = responseEmoji[event.Attendees[i].ResponseStatus]
+			}
+			output.WriteString(fmt.Sprintf("   %s %s\n", marker, guest))
+		}
+	}
+	if len(detail.Attachments) > 0 {
+		output.WriteString(heading("📎", "Attachments:\n"))
+		for _, attachment := range detail.Attachments {
+			output.WriteString(fmt.Sprintf("   - %s: %s\n", attachment.Title, attachment.URL))
+		}
+	}
+	if reminders := reminderList(detail); reminders != "" {
+		output.WriteString(label("⏰", "Reminders") + reminders + "\n")
+	}
+	if links := otherLinks(event); len(links) > 0 {
+		output.WriteString(label("🔗", "Links") + strings.Join(links, " ") + "\n")
+	}
+	if detail.HTMLLink != "" {
+		output.WriteString(label("🌐", "Open in Google Calendar") + detail.HTMLLink + "\n")
+	}
+	if event.Description != "" {
+		output.WriteString("\n" + heading("📝", "Description:\n") + event.Description + "\n")
+	}
+	return output.String()
+}
+
+// responseEmoji marks the RSVP states of guests.
+var responseEmoji = map[string]string{
+	"accepted":    "✅",
+	"declined":    "❌",
+	"tentative":   "❔",
+	"needsAction": "⏳",
+	"":            "⏳",
+}
+
+// eventWhen describes the days and times of an event.
+func eventWhen(event CalendarEvent, cfg *Config) string {
+	start, end := event.Start.In(cfg.location), event.End.In(cfg.location)
+	days := eventDays(event, cfg.location)
+	switch {
+	case event.IsAllDay && days > 1:
+		last := lastDay(event, cfg.location)
+		return fmt.Sprintf("%s to %s (all day, %d days)", start.Format("Monday, January 2"), last.Format("Monday, January 2, 2006"), days)
+	case event.IsAllDay:
+		return start.Format("Monday, January 2, 2006") + " (all day)"
+	case days > 1:
+		layout := "Monday, January 2, 2006, " + cfg.Formatting.TimeFormat
+		return fmt.Sprintf("%s - %s (%s)", start.Format(layout), end.Format(layout), formatDuration(end.Sub(start)))
+	}
+	return fmt.Sprintf("%s, %s - %s (%s)", start.Format("Monday, January 2, 2006"), event.StartTime, event.EndTime, formatDuration(end.Sub(start)))
+}
+
+// organizerName returns the organizer with their name when known.
+func organizerName(detail eventDetail) string {
+	if detail.OrganizerName != "" && detail.Organizer != "" {
+		return fmt.Sprintf("%s <%s>", detail.OrganizerName, detail.Organizer)
+	}
+	return detail.Organizer
+}
+
+// dialIns describes the entry points of a conference other than video.
+func dialIns(conference *eventConference) []string {
+	if conference == nil {
+		return nil
+	}
+	var entries []string
+	for _, entry := range conference.EntryPoints {
+		if entry.Type == "video" {
+			continue
+		}
+		text := entry.Label
+		if text == "" {
+			text = strings.TrimPrefix(strings.TrimPrefix(entry.URI, "tel:"), "sip:")
+		}
+		if entry.PIN != "" {
+			text += " (PIN " + entry.PIN + ")"
+		}
+		entries = append(entries, text)
+	}
+	return entries
+}
+
+// reminderList describes the reminders of an event, e.g. "popup 10m
+// before, email 1d before".
+func reminderList(detail eventDetail) string {
+	var reminders []string
+	for _, reminder := range detail.Reminders {
+		before := formatDuration(time.Duration(reminder.Minutes) * time.Minute)
+		if reminder.Minutes > 0 && reminder.Minutes%(24*60) == 0 {
+			before = fmt.Sprintf("%dd", reminder.Minutes/(24*60))
+		}
+		reminders = append(reminders, reminder.Method+" "+before+" before")
+	}
+	text := strings.Join(reminders, ", ")
+	if detail.DefaultReminders {
+		if text == "" {
+			return "calendar defaults"
+		}
+		text += " (calendar defaults)"
+	}
+	return text
+}
+
+// runShowMode prints every detail of one event.
+func runShowMode(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	format := fs.String("format", formatText, "Output format: "+strings.Join(outputFormats, ", "))
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 {
+		log.Fatalf("Usage: agenda-mcp show <event-id|calendarId/eventId|agenda://event/...> [--format FORMAT]")
+	}
+	if _, err := newFormatter(*format, cfg); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	cs, err := initCalendarService(cfg)
+	if err != nil {
+		log.Fatalf("Authentication failed: %v", err)
+	}
+	detail, err := cs.getEventDetail(context.Background(), positional[0])
+	if err != nil {
+		log.Fatalf("Failed to get event %s: %v", positional[0], err)
+	}
+	output, err := renderEventDetail(detail, *format, cfg)
+	if err != nil {
+		log.Fatalf("Failed to format event: %v", err)
+	}
+	fmt.Println(strings.TrimRight(output, "\n"))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EventTypesConfig sets which event types are shown by default. An empty
+// include list shows every type that isn't excluded.
+type EventTypesConfig struct {
+	Include []string `yaml:"include,omitempty"`
+	Exclude []string `yaml:"exclude,omitempty"`
+}
+
+// eventFilter selects which events are shown.
+type eventFilter struct {
+	categories   []string
+	includeTypes []string
+	excludeTypes []string
+}
+
+// newEventFilter builds a filter from comma-separated lists. Type lists
+// left empty fall back to the configured defaults.
+func newEventFilter(cfg *Config, categories, includeTypes, excludeTypes string) (eventFilter, error) {
+	filter := eventFilter{
+		categories:   splitList(categories),
+		includeTypes: splitList(includeTypes),
+		excludeTypes: splitList(excludeTypes),
+	}
+	if includeTypes == "" {
+		filter.includeTypes = cfg.EventTypes.Include
+	}
+	if excludeTypes == "" {
+		filter.excludeTypes = cfg.EventTypes.Exclude
+	}
+
+	for _, eventType := range append(append([]string{}, filter.includeTypes...), filter.excludeTypes...) {
+		if !isEventType(eventType) {
+			return eventFilter{}, fmt.Errorf("unknown event type %q, expected one of %s", eventType, strings.Join(eventTypes, ", "))
+		}
+	}
+	return filter, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (f eventFilter) keep(event CalendarEvent) bool {
+	eventType := event.EventType
+	if eventType == "" {
+		eventType = "default"
+	}
+	if len(f.includeTypes) > 0 && !containsFold(f.includeTypes, eventType) {
+		return false
+	}
+	if containsFold(f.excludeTypes, eventType) {
+		return false
+	}
+	// Working locations aren't events, so categories don't apply to them
+	if len(f.categories) > 0 && eventType != "workingLocation" && !containsFold(f.categories, event.Category) {
+		return false
+	}
+	return true
+}
+
+func (f eventFilter) apply(events []CalendarEvent) []CalendarEvent {
+	var kept []CalendarEvent
+	for _, event := range events {
+		if f.keep(event) {
+			kept = append(kept, event)
+		}
+	}
+	return kept
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
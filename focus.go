@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+// defaultFocusBlock is the shortest free block that counts as focus time.
+const defaultFocusBlock = 90 * time.Minute
+
+// splitMargin is the free time a meeting must leave on both sides to
+// split an afternoon rather than sit at one of its ends.
+const splitMargin = 30 * time.Minute
+
+// focusOptions are the settings of a focus report: the shortest block of
+// focus time and the working hours, as HH:MM.
+type focusOptions struct {
+	MinBlock  time.Duration
+	WorkStart string
+	WorkEnd   string
+}
+
+// focusOptionsFrom checks the options of a focus report, naming the
+// argument at fault in errors. Empty working hours and a zero block use
+// the configured and default ones.
+func focusOptionsFrom(cfg *Config, minBlock time.Duration, workStart, workEnd string) (focusOptions, error) {
+	opts := focusOptions{MinBlock: minBlock, WorkStart: workStart, WorkEnd: workEnd}
+	if opts.MinBlock == 0 {
+		opts.MinBlock = defaultFocusBlock
+	}
+	if opts.WorkStart == "" {
+		opts.WorkStart = cfg.WorkingHours.Start
+	}
+	if opts.WorkEnd == "" {
+		opts.WorkEnd = cfg.WorkingHours.End
+	}
+	switch {
+	case opts.MinBlock < 0:
+		return focusOptions{}, invalidArgument("min_block", "the shortest focus block must be positive")
+	case !clockPattern.MatchString(opts.WorkStart):
+		return focusOptions{}, invalidArgument("work_start", "working hours must be HH:MM, got %q", opts.WorkStart)
+	case !clockPattern.MatchString(opts.WorkEnd):
+		return focusOptions{}, invalidArgument("work_end", "working hours must be HH:MM, got %q", opts.WorkEnd)
+	case opts.WorkStart >= opts.WorkEnd && workEnd == "":
+		return focusOptions{}, invalidArgument("work_start", "working hours must start before they end")
+	case opts.WorkStart >= opts.WorkEnd:
+		return focusOptions{}, invalidArgument("work_end", "working hours must start before they end")
+	}
+	return opts, nil
+}
+
+// focusReport measures the focus time of [Start, End) and of the period
+// of the same length before it.
+type focusReport struct {
+	focusOptions
+	// AsOf is set when the events come from an offline snapshot
+	AsOf     time.Time
+	Current  focusPeriod
+	Previous focusPeriod
+	Days     []focusDay
+	Splits   []afternoonSplit
+}
+
+// focusPeriod sums up the working days of [Start, End).
+type focusPeriod struct {
+	Start, End time.Time
+	Workdays   int
+	// FocusTime is the free time in blocks of at least MinBlock, out of
+	// FreeTime within working hours
+	FocusTime   time.Duration
+	Blocks      int
+	FreeTime    time.Duration
+	MeetingTime time.Duration
+	// Fragmentation is the percentage of free time in blocks too short
+	// to focus
+	Fragmentation float64
+}
+
+// focusDay is the focus time of one day.
+type focusDay struct {
+	Day           time.Time
+	Workday       bool
+	Blocks        []timeSpan
+	FocusTime     time.Duration
+	FreeTime      time.Duration
+	Fragmentation float64
+}
+
+// afternoonSplit is a meeting alone in an afternoon that it cuts in two.
+type afternoonSplit struct {
+	Event         CalendarEvent
+	Before, After time.Duration
+}
+
+// interrupts reports whether an event interrupts focus. Focus time
+// events are focus time themselves.
+func interrupts(event CalendarEvent) bool {
+	return countsAsBusy(event) && event.EventType != "focusTime" && event.CategoryClass != classFocus
+}
+
+// focusReport measures the focus time of [start, end) and compares it
+// with the period before.
+func (cs *CalendarService) focusReport(ctx context.Context, start, end time.Time, opts focusOptions) (*focusReport, error) {
+	days := daysBetween(start, end, cs.config.location)
+	previousStart := start.AddDate(0, 0, -days)
+	events, asOf, err := cs.getEvents(ctx, previousStart, end)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &focusReport{focusOptions: opts, AsOf: asOf}
+	report.Previous, _, _ = analyzeFocus(events, previousStart, start, opts, cs.config)
+	report.Current, report.Days, report.Splits = analyzeFocus(events, start, end, opts, cs.config)
+	return report, nil
+}
+
+func analyzeFocus(events []CalendarEvent, start, end time.Time, opts focusOptions, cfg *Config) (focusPeriod, []focusDay, []afternoonSplit) {
+	period := focusPeriod{Start: start, End: end}
+	var days []focusDay
+	var splits []afternoonSplit
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		stats := focusDay{Day: day, Workday: cfg.isWorkday(day.Weekday())}
+		if !stats.Workday {
+			days = append(days, stats)
+			continue
+		}
+		period.Workdays++
+		workStart, workEnd := clockTimes(day, opts.WorkStart, opts.WorkEnd)
+		work := timeSpan{workStart, workEnd}
+
+		var busy, meetings []timeSpan
+		var interruptions []CalendarEvent
+		for _, event := range eventsOnDay(events, day) {
+			if !interrupts(event) {
+				continue
+			}
+			span := clip(timeSpan{event.Start, event.End}, work)
+			if span.duration() <= 0 {
+				continue
+			}
+			busy = append(busy, span)
+			interruptions = append(interruptions, event)
+			if isMeeting(event) {
+				meetings = append(meetings, span)
+			}
+		}
+
+		for _, free := range freeBlocks(busy, work) {
+			stats.FreeTime += free.duration()
+			if free.duration() >= opts.MinBlock {
+				stats.Blocks = append(stats.Blocks, free)
+				stats.FocusTime += free.duration()
+			}
+		}
+		stats.Fragmentation = fragmentation(stats.FocusTime, stats.FreeTime)
+		days = append(days, stats)
+
+		period.FocusTime += stats.FocusTime
+		period.FreeTime += stats.FreeTime
+		period.Blocks += len(stats.Blocks)
+		period.MeetingTime += unionTime(meetings)
+		if split, ok := splitAfternoon(interruptions, work, opts); ok {
+			splits = append(splits, split)
+		}
+	}
+	if period.Workdays > 0 {
+		period.Fragmentation = fragmentation(period.FocusTime, period.FreeTime)
+	}
+	return period, days, splits
+}
+
+// fragmentation returns the percentage of free time outside focus blocks,
+// 100 when there is no free time at all.
+func fragmentation(focus, free time.Duration) float64 {
+	if free <= 0 {
+		return 100
+	}
+	return 100 * float64(free-focus) / float64(free)
+}
+
+// splitAfternoon finds a meeting that is the only interruption of an
+// afternoon and leaves free time on both sides of it, so that the
+// afternoon offers less focus time than if it were at either end.
+func splitAfternoon(events []CalendarEvent, work timeSpan, opts focusOptions) (afternoonSplit, bool) {
+	noon := time.Date(work.Start.Year(), work.Start.Month(), work.Start.Day(), 12, 0, 0, 0, work.Start.Location())
+	afternoon := clip(timeSpan{noon, work.End}, work)
+	var inAfternoon []CalendarEvent
+	for _, event := range events {
+		if clip(timeSpan{event.Start, event.End}, afternoon).duration() > 0 {
+			inAfternoon = append(inAfternoon, event)
+		}
+	}
+	if len(inAfternoon) != 1 || !isMeeting(inAfternoon[0]) {
+		return afternoonSplit{}, false
+	}
+	event := inAfternoon[0]
+	meeting := clip(timeSpan{event.Start, event.End}, afternoon)
+	split := afternoonSplit{
+		Event:  event,
+		Before: meeting.Start.Sub(afternoon.Start),
+		After:  afternoon.End.Sub(meeting.End),
+	}
+	if split.Before < splitMargin || split.After < splitMargin || split.Before+split.After < opts.MinBlock {
+		return afternoonSplit{}, false
+	}
+	return split, true
+}
+
+// formatFocusReport renders the report as text, markdown or JSON.
+func formatFocusReport(report *focusReport, format string, cfg *Config) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", formatText:
+		return withOfflineNotice(focusReportText(report, cfg), report.AsOf, cfg), nil
+	case formatMarkdown:
+		return withOfflineNotice(focusReportMarkdown(report, cfg), report.AsOf, cfg), nil
+	case formatJSON:
+		out, err := json.MarshalIndent(focusReportJSON(report), "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+	return "", fmt.Errorf("unknown format %q: use one of %s", format, strings.Join(reportFormats, ", "))
+}
+
+// signedDuration formats a change in time, e.g. "+1h 30m".
+func signedDuration(d time.Duration) string {
+	if d < 0 {
+		return "-" + formatDuration(-d)
+	}
+	return "+" + formatDuration(d)
+}
+
+// focusComparisons describes the period against the previous one.
+func focusComparisons(report *focusReport) (focus, fragmented, meetings string) {
+	current, previous := report.Current, report.Previous
+	focus = fmt.Sprintf("%s in %s (previously %s in %s, %s)",
+		formatDuration(current.FocusTime), plural(current.Blocks, "block"),
+		formatDuration(previous.FocusTime), plural(previous.Blocks, "block"),
+		signedDuration(current.FocusTime-previous.FocusTime))
+	fragmented = fmt.Sprintf("%.0f%% of free time in short gaps", current.Fragmentation)
+	if previous.Workdays > 0 {
+		fragmented += fmt.Sprintf(" (previously %.0f%%, %+.0f points)",
+			previous.Fragmentation, math.Round(current.Fragmentation)-math.Round(previous.Fragmentation))
+	} else {
+		fragmented += " (no working days before)"
+	}
+	meetings = fmt.Sprintf("%s (previously %s, %s)",
+		formatDuration(current.MeetingTime), formatDuration(previous.MeetingTime),
+		signedDuration(current.MeetingTime-previous.MeetingTime))
+	return focus, fragmented, meetings
+}
+
+func focusReportText(report *focusReport, cfg *Config) string {
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("🎯 Focus report for %s\n", periodTitle(report.Current.Start, report.Current.End)))
+	output.WriteString(strings.Repeat("=", 50) + "\n\n")
+	output.WriteString(fmt.Sprintf("Working hours %s-%s, focus blocks of %s or more, compared with %s\n\n",
+		report.WorkStart, report.WorkEnd, formatDuration(report.MinBlock), periodTitle(report.Previous.Start, report.Previous.End)))
+
+	focus, fragmented, meetings := focusComparisons(report)
+	output.WriteString("🧠 Focus time: " + focus + "\n")
+	output.WriteString("🧩 Fragmentation: " + fragmented + "\n")
+	output.WriteString("🤝 Meetings: " + meetings + "\n")
+
+	output.WriteString("\n📅 Per day:\n")
+	for _, day := range report.Days {
+		output.WriteString("   " + day.Day.Format("Mon Jan 2") + ": ")
+		if !day.Workday {
+			output.WriteString("day off\n")
+			continue
+		}
+		output.WriteString(fmt.Sprintf("%s focus in %s", formatDuration(day.FocusTime), plural(len(day.Blocks), "block")))
+		var blocks []string
+		for _, block := range day.Blocks {
+			blocks = append(blocks, clockRange(block, cfg))
+		}
+		if len(blocks) > 0 {
+			output.WriteString(" (" + strings.Join(blocks, ", ") + ")")
+		}
+		output.WriteString(fmt.Sprintf(", fragmentation %.0f%%\n", day.Fragmentation))
+	}
+
+	if len(report.Splits) > 0 {
+		output.WriteString("\n✂️  Meetings splitting free afternoons:\n")
+		for _, split := range report.Splits {
+			output.WriteString(fmt.Sprintf("   %s %s %s: %s free before, %s after\n", split.Event.Start.In(cfg.location).Format("Mon Jan 2"),
+				clockRange(timeSpan{split.Event.Start, split.Event.End}, cfg), split.Event.Summary,
+				formatDuration(split.Before), formatDuration(split.After)))
+		}
+	}
+	return output.String()
+}
+
+func focusReportMarkdown(report *focusReport, cfg *Config) string {
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("# Focus report for %s\n\n", periodTitle(report.Current.Start, report.Current.End)))
+	output.WriteString(fmt.Sprintf("Working hours %s–%s, focus blocks of %s or more, compared with %s.\n\n",
+		report.WorkStart, report.WorkEnd, formatDuration(report.MinBlock), periodTitle(report.Previous.Start, report.Previous.End)))
+
+	focus, fragmented, meetings := focusComparisons(report)
+	output.WriteString("- **Focus time:** " + focus + "\n")
+	output.WriteString("- **Fragmentation:** " + fragmented + "\n")
+	output.WriteString("- **Meetings:** " + meetings + "\n")
+
+	output.WriteString("\n## Per day\n\n")
+	output.WriteString("| Day | Focus hours | Blocks | Fragmentation |\n|-----|------------:|--------|--------------:|\n")
+	for _, day := range report.Days {
+		if !day.Workday {
+			output.WriteString(fmt.Sprintf("| %s | day off | | |\n", day.Day.Format("Mon Jan 2")))
+			continue
+		}
+		var blocks []string
+		for _, block := range day.Blocks {
+			blocks = append(blocks, clockRange(block, cfg))
+		}
+		output.WriteString(fmt.Sprintf("| %s | %.1f | %s | %.0f%% |\n", day.Day.Format("Mon Jan 2"), day.FocusTime.Hours(), strings.Join(blocks, ", "), day.Fragmentation))
+	}
+
+	if len(report.Splits) > 0 {
+		output.WriteString("\n## Meetings splitting free afternoons\n\n")
+		for _, split := range report.Splits {
+			output.WriteString(fmt.Sprintf("- **%s %s** %s — %s free before, %s after\n", split.Event.Start.In(cfg.location).Format("Mon Jan 2"),
+				clockRange(timeSpan{split.Event.Start, split.Event.End}, cfg), split.Event.Summary,
+				formatDuration(split.Before), formatDuration(split.After)))
+		}
+	}
+	return output.String()
+}
+
+// focusJSON is the JSON form of the focus report. Times are in hours.
+type focusJSON struct {
+	From            string          `json:"from"`
+	To              string          `json:"to"`
+	WorkingHours    string          `json:"working_hours"`
+	MinBlockMinutes int             `json:"min_block_minutes"`
+	OfflineAsOf     *time.Time      `json:"offline_as_of,omitempty"`
+	Current         focusPeriodJSON `json:"current"`
+	Previous        focusPeriodJSON `json:"previous"`
+	Days            []focusDayJSON  `json:"days"`
+	Splits          []eventResource `json:"split_afternoons"`
+}
+
+type focusPeriodJSON struct {
+	From          string  `json:"from"`
+	To            string  `json:"to"`
+	FocusHours    float64 `json:"focus_hours"`
+	Blocks        int     `json:"blocks"`
+	FreeHours     float64 `json:"free_hours"`
+	MeetingHours  float64 `json:"meeting_hours"`
+	Fragmentation float64 `json:"fragmentation_percent"`
+}
+
+type focusDayJSON struct {
+	Date          string     `json:"date"`
+	Workday       bool       `json:"workday"`
+	FocusHours    float64    `json:"focus_hours"`
+	FreeHours     float64    `json:"free_hours"`
+	Fragmentation float64    `json:"fragmentation_percent"`
+	Blocks        []spanJSON `json:"blocks,omitempty"`
+}
+
+func focusPeriodToJSON(period focusPeriod) focusPeriodJSON {
+	return focusPeriodJSON{
+		From:          period.Start.Format("2006-01-02"),
+		To:            period.End.AddDate(0, 0, -1).Format("2006-01-02"),
+		FocusHours:    hours(period.FocusTime),
+		Blocks:        period.Blocks,
+		FreeHours:     hours(period.FreeTime),
+		MeetingHours:  hours(period.MeetingTime),
+		Fragmentation: math.Round(period.Fragmentation*10) / 10,
+	}
+}
+
+func focusReportJSON(report *focusReport) focusJSON {
+	data := focusJSON{
+		From:            report.Current.Start.Format("2006-01-02"),
+		To:              report.Current.End.AddDate(0, 0, -1).Format("2006-01-02"),
+		WorkingHours:    report.WorkStart + "-" + report.WorkEnd,
+		MinBlockMinutes: int(report.MinBlock.Minutes()),
+		Current:         focusPeriodToJSON(report.Current),
+		Previous:        focusPeriodToJSON(report.Previous),
+		Splits:          []eventResource{},
+	}
+	if !report.AsOf.IsZero() {
+		data.OfflineAsOf = &report.AsOf
+	}
+	for _, day := range report.Days {
+		dayData := focusDayJSON{Date: day.Day.Format("2006-01-02"), Workday: day.Workday}
+		if day.Workday {
+			dayData.FocusHours = hours(day.FocusTime)
+			dayData.FreeHours = hours(day.FreeTime)
+			dayData.Fragmentation = math.Round(day.Fragmentation*10) / 10
+		}
+		for _, block := range day.Blocks {
+			dayData.Blocks = append(dayData.Blocks, spanJSON{block.Start, block.End})
+		}
+		data.Days = append(data.Days, dayData)
+	}
+	for _, split := range report.Splits {
+		data.Splits = append(data.Splits, eventResource{URI: eventURI(split.Event), CalendarEvent: split.Event})
+	}
+	return data
+}
+
+// Run focus mode - report focus time and fragmentation
+func runFocusMode(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("focus", flag.ExitOnError)
+	from := fs.String("from", "", "First day in YYYY-MM-DD format (default: Monday of this week)")
+	to := fs.String("to", "", "Last day in YYYY-MM-DD format (default: a week after --from)")
+	minBlock := fs.Int("min-block", int(defaultFocusBlock.Minutes()), "Shortest free block that counts as focus time, in minutes")
+	workStart := fs.String("start", "", "Start of the working day as HH:MM (default: working_hours.start)")
+	workEnd := fs.String("end", "", "End of the working day as HH:MM (default: working_hours.end)")
+	format := fs.String("format", formatText, "Output format: "+strings.Join(reportFormats, ", "))
+	parseFlags(fs, args)
+	if !containsFold(reportFormats, *format) {
+		log.Fatalf("Unknown format %q: use one of %s", *format, strings.Join(reportFormats, ", "))
+	}
+	if *minBlock < 1 {
+		log.Fatalf("--min-block must be at least 1")
+	}
+	opts, err := focusOptionsFrom(cfg, time.Duration(*minBlock)*time.Minute, *workStart, *workEnd)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	cs, err := initCalendarService(cfg)
+	if err != nil {
+		log.Fatalf("Authentication failed: %v", err)
+	}
+	start, end, err := cs.reportPeriod(*from, *to)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	report, err := cs.focusReport(context.Background(), start, end, opts)
+	if err != nil {
+		log.Fatalf("Failed to get calendar events: %v", err)
+	}
+	output, err := formatFocusReport(report, *format, cfg)
+	if err != nil {
+		log.Fatalf("Failed to format report: %v", err)
+	}
+	fmt.Println(strings.TrimRight(output, "\n"))
+}
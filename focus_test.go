@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFocusOptionsArguments(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.WorkingHours.Start, cfg.WorkingHours.End = "09:00", "17:00"
+	tests := []struct {
+		minBlock           time.Duration
+		workStart, workEnd string
+		argument           string
+	}{
+		{minBlock: -time.Minute, argument: "min_block"},
+		{workStart: "9am", argument: "work_start"},
+		{workEnd: "25:00", argument: "work_end"},
+		{workStart: "18:00", argument: "work_start"},
+		{workEnd: "08:00", argument: "work_end"},
+		{workStart: "14:00", workEnd: "13:00", argument: "work_end"},
+		{workStart: "13:00", workEnd: "18:00"},
+		{},
+	}
+	for _, tt := range tests {
+		_, err := focusOptionsFrom(cfg, tt.minBlock, tt.workStart, tt.workEnd)
+		var te *toolError
+		switch {
+		case tt.argument == "" && err != nil:
+			t.Errorf("focusOptionsFrom(%v, %q, %q) failed: %v", tt.minBlock, tt.workStart, tt.workEnd, err)
+		case tt.argument != "" && (!errors.As(err, &te) || te.Argument != tt.argument):
+			t.Errorf("focusOptionsFrom(%v, %q, %q) = %v, want an invalid %s", tt.minBlock, tt.workStart, tt.workEnd, err, tt.argument)
+		}
+	}
+}
+
+func TestAnalyzeFocus(t *testing.T) {
+	declined := testMeeting("declined", clockAt(2, "10:00"), clockAt(2, "11:00"))
+	declined.Attendees = []EventAttendee{{Email: "me@example.com", Self: true, ResponseStatus: "declined"}, {Email: "bob@example.com"}}
+	allDay := testMeeting("all-day", clockAt(2, "00:00"), clockAt(3, "00:00"))
+	allDay.IsAllDay = true
+	focusTime := CalendarEvent{ID: "focus", Summary: "Focus", Start: clockAt(2, "13:00"), End: clockAt(2, "16:00"), EventType: "focusTime"}
+
+	tests := []struct {
+		name               string
+		day, days          int
+		workStart, workEnd string
+		events             []CalendarEvent
+		want               focusPeriod
+		splits             []time.Duration
+	}{
+		{
+			name: "overlapping", day: 2, days: 1, workStart: "09:00", workEnd: "18:00",
+			events: []CalendarEvent{
+				testMeeting("review", clockAt(2, "10:00"), clockAt(2, "11:00")),
+				testMeeting("sync", clockAt(2, "10:30"), clockAt(2, "12:00")),
+			},
+			want: focusPeriod{Workdays: 1, FocusTime: 6 * time.Hour, Blocks: 1, FreeTime: 7 * time.Hour, MeetingTime: 2 * time.Hour, Fragmentation: 100.0 / 7},
+		},
+		{
+			name: "crossing midnight", day: 2, days: 2, workStart: "09:00", workEnd: "18:00",
+			events: []CalendarEvent{testMeeting("overnight", clockAt(2, "17:00"), clockAt(3, "10:00"))},
+			want:   focusPeriod{Workdays: 2, FocusTime: 16 * time.Hour, Blocks: 2, FreeTime: 16 * time.Hour, MeetingTime: 2 * time.Hour},
+		},
+		{
+			name: "declined, all-day and focus time", day: 2, days: 1, workStart: "09:00", workEnd: "18:00",
+			events: []CalendarEvent{declined, allDay, focusTime},
+			want:   focusPeriod{Workdays: 1, FocusTime: 9 * time.Hour, Blocks: 1, FreeTime: 9 * time.Hour},
+		},
+		{
+			name: "working hours after noon", day: 2, days: 1, workStart: "13:00", workEnd: "21:00",
+			events: []CalendarEvent{
+				testMeeting("morning", clockAt(2, "10:00"), clockAt(2, "11:00")),
+				testMeeting("afternoon", clockAt(2, "16:00"), clockAt(2, "17:00")),
+			},
+			want:   focusPeriod{Workdays: 1, FocusTime: 7 * time.Hour, Blocks: 2, FreeTime: 7 * time.Hour, MeetingTime: time.Hour},
+			splits: []time.Duration{3 * time.Hour, 4 * time.Hour},
+		},
+		{
+			name: "fully booked", day: 2, days: 1, workStart: "09:00", workEnd: "18:00",
+			events: []CalendarEvent{
+				testMeeting("morning", clockAt(2, "08:00"), clockAt(2, "13:00")),
+				testMeeting("afternoon", clockAt(2, "13:00"), clockAt(2, "19:00")),
+			},
+			want: focusPeriod{Workdays: 1, MeetingTime: 9 * time.Hour, Fragmentation: 100},
+		},
+		{
+			name: "weekend", day: 7, days: 2, workStart: "09:00", workEnd: "18:00",
+			events: []CalendarEvent{testMeeting("brunch", clockAt(7, "11:00"), clockAt(7, "12:00"))},
+			want:   focusPeriod{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := clockAt(tt.day, "00:00")
+			opts := focusOptions{MinBlock: defaultFocusBlock, WorkStart: tt.workStart, WorkEnd: tt.workEnd}
+			period, days, splits := analyzeFocus(tt.events, start, start.AddDate(0, 0, tt.days), opts, testConfig(tt.workStart, tt.workEnd))
+			if len(days) != tt.days {
+				t.Errorf("%d days, want %d", len(days), tt.days)
+			}
+			if math.Abs(period.Fragmentation-tt.want.Fragmentation) > 0.01 {
+				t.Errorf("fragmentation %.2f%%, want %.2f%%", period.Fragmentation, tt.want.Fragmentation)
+			}
+			period.Start, period.End, period.Fragmentation, tt.want.Fragmentation = time.Time{}, time.Time{}, 0, 0
+			if period != tt.want {
+				t.Errorf("period = %+v, want %+v", period, tt.want)
+			}
+			var got []time.Duration
+			for _, split := range splits {
+				got = append(got, split.Before, split.After)
+			}
+			if !reflect.DeepEqual(got, tt.splits) {
+				t.Errorf("splits with free time %v, want %v", got, tt.splits)
+			}
+		})
+	}
+}
+
+func TestSplitAfternoon(t *testing.T) {
+	other := CalendarEvent{ID: "errand", Summary: "Errand", Start: clockAt(2, "14:00"), End: clockAt(2, "15:00")}
+	tests := []struct {
+		name               string
+		workStart, workEnd string
+		minBlock           time.Duration
+		events             []CalendarEvent
+		before, after      time.Duration
+		split              bool
+	}{
+		{
+			name: "meeting in the middle", workStart: "09:00", workEnd: "18:00",
+			events: []CalendarEvent{testMeeting("sync", clockAt(2, "14:00"), clockAt(2, "15:00"))},
+			before: 2 * time.Hour, after: 3 * time.Hour, split: true,
+		},
+		{
+			name: "morning meeting ending at noon", workStart: "09:00", workEnd: "18:00",
+			events: []CalendarEvent{
+				testMeeting("standup", clockAt(2, "11:00"), clockAt(2, "12:00")),
+				testMeeting("sync", clockAt(2, "14:00"), clockAt(2, "15:00")),
+			},
+			before: 2 * time.Hour, after: 3 * time.Hour, split: true,
+		},
+		{
+			name: "working hours after noon", workStart: "13:00", workEnd: "21:00",
+			events: []CalendarEvent{testMeeting("sync", clockAt(2, "16:00"), clockAt(2, "17:00"))},
+			before: 3 * time.Hour, after: 4 * time.Hour, split: true,
+		},
+		{
+			name: "end of the day", workStart: "09:00", workEnd: "18:00",
+			events: []CalendarEvent{testMeeting("sync", clockAt(2, "17:00"), clockAt(2, "18:00"))},
+		},
+		{
+			name: "close to noon", workStart: "09:00", workEnd: "18:00",
+			events: []CalendarEvent{testMeeting("lunch", clockAt(2, "12:15"), clockAt(2, "13:00"))},
+		},
+		{
+			name: "not a meeting", workStart: "09:00", workEnd: "18:00",
+			events: []CalendarEvent{other},
+		},
+		{
+			name: "two meetings", workStart: "09:00", workEnd: "18:00",
+			events: []CalendarEvent{
+				testMeeting("sync", clockAt(2, "14:00"), clockAt(2, "15:00")),
+				testMeeting("review", clockAt(2, "16:00"), clockAt(2, "16:30")),
+			},
+		},
+		{
+			name: "too little free time", workStart: "09:00", workEnd: "18:00", minBlock: 6 * time.Hour,
+			events: []CalendarEvent{testMeeting("sync", clockAt(2, "14:00"), clockAt(2, "15:00"))},
+		},
+	}
+	for _, tt := range tests {
+		opts := focusOptions{MinBlock: defaultFocusBlock, WorkStart: tt.workStart, WorkEnd: tt.workEnd}
+		if tt.minBlock != 0 {
+			opts.MinBlock = tt.minBlock
+		}
+		workStart, workEnd := clockTimes(clockAt(2, "00:00"), tt.workStart, tt.workEnd)
+		split, ok := splitAfternoon(tt.events, timeSpan{workStart, workEnd}, opts)
+		if ok != tt.split || split.Before != tt.before || split.After != tt.after {
+			t.Errorf("%s: split %v with %v before and %v after, want %v with %v and %v",
+				tt.name, ok, split.Before, split.After, tt.split, tt.before, tt.after)
+		}
+	}
+}
+
+func TestFragmentation(t *testing.T) {
+	tests := []struct {
+		focus, free time.Duration
+		want        float64
+	}{
+		{0, 0, 100},
+		{0, 3 * time.Hour, 100},
+		{2 * time.Hour, 2 * time.Hour, 0},
+		{3 * time.Hour, 4 * time.Hour, 25},
+	}
+	for _, tt := range tests {
+		if got := fragmentation(tt.focus, tt.free); got != tt.want {
+			t.Errorf("fragmentation(%v, %v) = %v, want %v", tt.focus, tt.free, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Output formats of the agenda, shared by text mode and the MCP tools.
+const (
+	formatText     = "text"
+	formatPlain    = "plain"
+	formatMarkdown = "markdown"
+	formatJSON     = "json"
+	formatCSV      = "csv"
+	formatICS      = "ics"
+)
+
+var outputFormats = []string{formatText, formatPlain, formatMarkdown, formatJSON, formatCSV, formatICS}
+
+// Output formats of the reports.
+var reportFormats = []string{formatText, formatMarkdown, formatJSON}
+
+// agendaView is an agenda to render: the events in [Start, End).
+type agendaView struct {
+	URI        string
+	Start, End time.Time
+	Events     []CalendarEvent
+	// AsOf is set when the events come from an offline snapshot
+	AsOf time.Time
+	// Full shows complete descriptions and guest lists
+	Full bool
+}
+
+// dayView is the agenda of the day starting at day.
+func dayView(day time.Time, events []CalendarEvent, asOf time.Time) agendaView {
+	return agendaView{
+		URI:    dayURIPrefix + day.Format("2006-01-02"),
+		Start:  day,
+		End:    day.AddDate(0, 0, 1),
+		Events: events,
+		AsOf:   asOf,
+	}
+}
+
+// agendaFormatter renders agendas in one output format.
+type agendaFormatter interface {
+	format(agenda agendaView) (string, error)
+}
+
+// newFormatter returns the formatter of an output format, text by default.
+func newFormatter(name string, cfg *Config) (agendaFormatter, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", formatText:
+		return textFormatter{cfg: cfg}, nil
+	case formatPlain:
+		return textFormatter{cfg: cfg, plain: true}, nil
+	case formatMarkdown:
+		return markdownFormatter{cfg: cfg}, nil
+	case formatJSON:
+		return jsonFormatter{cfg: cfg}, nil
+	case formatCSV:
+		return csvFormatter{cfg: cfg}, nil
+	case formatICS:
+		return icsFormatter{}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q: use one of %s", name, strings.Join(outputFormats, ", "))
+}
+
+// formatOption is the format argument of the agenda tools.
+func formatOption() mcp.ToolOption {
+	return mcp.WithString("format",
+		mcp.Description("Output format: text (default), plain, markdown, json, csv or ics"),
+		mcp.Enum(outputFormats...),
+	)
+}
+
+// reportFormatOption is the format argument of the report tools.
+func reportFormatOption() mcp.ToolOption {
+	return mcp.WithString("format",
+		mcp.Description("Output format: text (default), markdown or json"),
+		mcp.Enum(reportFormats...),
+	)
+}
+
+// fullOption is the full-detail argument of the agenda tools.
+func fullOption() mcp.ToolOption {
+	return mcp.WithBoolean("full",
+		mcp.Description("Include complete descriptions and guest lists instead of one-line summaries"),
+	)
+}
+
+// templateOption is the template argument of the agenda tools, if
+// enabled.
+func templateOption(enabled bool) mcp.ToolOption {
+	if !enabled {
+		return func(*mcp.Tool) {}
+	}
+	return mcp.WithString("template",
+		mcp.Description("Go text/template rendering the agenda instead of a format; see the README for the data and functions available"),
+	)
+}
+
+// textFormatter renders the agenda for terminals, with emoji unless plain.
+type textFormatter struct {
+	cfg   *Config
+	plain bool
+}
+
+func (f textFormatter) format(agenda agendaView) (string, error) {
+	var output strings.Builder
+	if notice := offlineNotice(agenda.AsOf, f.cfg); notice != "" {
+		output.WriteString(f.icon("⚠️", strings.TrimPrefix(notice, "⚠️ ")) + "\n\n")
+	}
+
+	if !agenda.End.After(agenda.Start.AddDate(0, 0, 1)) {
+		output.WriteString(f.icon("📅", fmt.Sprintf("Daily Agenda for %s\n", agenda.Start.Format("Monday, January 2, 2006"))))
+		output.WriteString(strings.Repeat("=", 50) + "\n\n")
+		f.writeDay(&output, agenda.Start, agenda.Events, isToday(agenda.Start, f.cfg), agenda.Full)
+		return output.String(), nil
+	}
+
+	output.WriteString(f.icon("📅", fmt.Sprintf("Agenda from %s to %s\n", agenda.Start.Format("Monday, January 2"), agenda.End.AddDate(0, 0, -1).Format("Monday, January 2, 2006"))))
+	output.WriteString(strings.Repeat("=", 50) + "\n")
+	for day := agenda.Start; day.Before(agenda.End); day = day.AddDate(0, 0, 1) {
+		var dayOutput strings.Builder
+		f.writeDay(&dayOutput, day, eventsOnDay(agenda.Events, day), false, agenda.Full)
+		output.WriteString(fmt.Sprintf("\n%s\n%s\n\n", day.Format("Monday, January 2"), strings.Repeat("-", 30)))
+		output.WriteString(strings.TrimRight(dayOutput.String(), "\n") + "\n")
+	}
+	return output.String(), nil
+}
+
+func (f textFormatter) writeDay(output *strings.Builder, day time.Time, events []CalendarEvent, today, full bool) {
+	events = writeWorkingLocation(output, events, f.plain)
+	if len(events) == 0 {
+		switch {
+		case f.plain && today:
+			output.WriteString("No events scheduled for today.")
+		case f.plain:
+			output.WriteString("No events scheduled for this day.")
+		case today:
+			output.WriteString("🎉 No events scheduled for today!")
+		default:
+			output.WriteString("🎉 No events scheduled for this day!")
+		}
+		return
+	}
+	writeEventList(output, day, events, f.cfg, f.plain, full)
+}
+
+// icon prefixes text with emoji, unless the output is plain.
+func (f textFormatter) icon(emoji, text string) string {
+	if f.plain {
+		return text
+	}
+	return emoji + " " + text
+}
+
+func isToday(day time.Time, cfg *Config) bool {
+	return day.Format("2006-01-02") == time.Now().In(cfg.location).Format("2006-01-02")
+}
+
+// startOfDay returns midnight of the day of t in loc.
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// daysBetween counts the calendar days from the day of a to the day of
+// b, whatever the daylight saving changes in between.
+func daysBetween(a, b time.Time, loc *time.Location) int {
+	a, b = startOfDay(a, loc), startOfDay(b, loc)
+	return int(math.Round(b.Sub(a).Hours() / 24))
+}
+
+// lastDay returns the last day an event takes place on. The end date of
+// all-day events is exclusive, and timed events ending at midnight end
+// the day before.
+func lastDay(event CalendarEvent, loc *time.Location) time.Time {
+	end := event.End
+	if event.IsAllDay {
+		end = startOfDay(end, loc).AddDate(0, 0, -1)
+	} else {
+		end = end.Add(-time.Nanosecond)
+	}
+	if end.Before(event.Start) {
+		return startOfDay(event.Start, loc)
+	}
+	return startOfDay(end, loc)
+}
+
+// eventDays returns the number of days an event spans.
+func eventDays(event CalendarEvent, loc *time.Location) int {
+	return daysBetween(event.Start, lastDay(event, loc), loc) + 1
+}
+
+// dayOfEvent describes which day of a multi-day event day is, e.g.
+// "Day 2 of 5". It returns "" for events within one day.
+func dayOfEvent(event CalendarEvent, day time.Time, loc *time.Location) string {
+	days := eventDays(event, loc)
+	if days <= 1 {
+		return ""
+	}
+	n := daysBetween(event.Start, day, loc) + 1
+	if n < 1 || n > days {
+		return fmt.Sprintf("%d days", days)
+	}
+	return fmt.Sprintf("Day %d of %d", n, days)
+}
+
+// timeRange returns the times of a timed event, with their dates when it
+// doesn't start and end on the same day.
+func timeRange(event CalendarEvent, cfg *Config) string {
+	if event.EndTime == "" || (event.EndTime == event.StartTime && event.End.Equal(event.Start)) {
+		return event.StartTime
+	}
+	if eventDays(event, cfg.location) <= 1 {
+		return event.StartTime + " - " + event.EndTime
+	}
+	layout := "Mon Jan 2 " + cfg.Formatting.TimeFormat
+	return event.Start.In(cfg.location).Format(layout) + " - " + event.End.In(cfg.location).Format(layout)
+}
+
+// markdownFormatter renders the agenda as the markdown of the resources.
+type markdownFormatter struct {
+	cfg *Config
+}
+
+func (f markdownFormatter) format(agenda agendaView) (string, error) {
+	return withOfflineNotice(formatAgendaMarkdown(agenda, f.cfg), agenda.AsOf, f.cfg), nil
+}
+
+// jsonFormatter renders the agenda as the JSON of the resources.
+type jsonFormatter struct {
+	cfg *Config
+}
+
+func (f jsonFormatter) format(agenda agendaView) (string, error) {
+	data := agendaJSON{
+		URI:      agenda.URI,
+		From:     agenda.Start.Format("2006-01-02"),
+		To:       agenda.End.AddDate(0, 0, -1).Format("2006-01-02"),
+		Timezone: f.cfg.location.String(),
+		Events:   toEventResources(agenda.Events),
+	}
+	if !agenda.AsOf.IsZero() {
+		data.OfflineAsOf = &agenda.AsOf
+	}
+	out, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// csvFormatter renders one row per event. Timed events have RFC 3339
+// start and end times, all-day events their first and last dates.
+type csvFormatter struct {
+	cfg *Config
+}
+
+var csvHeader = []string{"start", "end", "all_day", "summary", "category", "event_type", "location",
+	"organizer", "attendees", "description", "links", "calendar_id", "event_id"}
+
+func (f csvFormatter) format(agenda agendaView) (string, error) {
+	var output strings.Builder
+	w := csv.NewWriter(&output)
+	if err := w.Write(csvHeader); err != nil {
+		return "", err
+	}
+	for _, event := range agenda.Events {
+		start, end := event.Start.In(f.cfg.location).Format(time.RFC3339), event.End.In(f.cfg.location).Format(time.RFC3339)
+		if event.IsAllDay {
+			start, end = event.Start.Format("2006-01-02"), lastDay(event, f.cfg.location).Format("2006-01-02")
+		}
+		var attendees []string
+		for _, attendee := range event.Attendees {
+			attendees = append(attendees, attendee.Email)
+		}
+		err := w.Write([]string{start, end, fmt.Sprint(event.IsAllDay), event.Summary, event.Category, event.EventType,
+			event.Location, event.Organizer, strings.Join(attendees, ";"), event.Description, strings.Join(event.Links, ";"), event.CalendarID, event.ID})
+		if err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	return output.String(), w.Error()
+}
+
+// icsFormatter renders the agenda as an iCalendar file (RFC 5545).
+type icsFormatter struct{}
+
+func (f icsFormatter) format(agenda agendaView) (string, error) {
+	var output strings.Builder
+	line := func(name, value string) {
+		output.WriteString(foldICSLine(name+":"+value) + "\r\n")
+	}
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	if !agenda.AsOf.IsZero() {
+		stamp = agenda.AsOf.UTC().Format("20060102T150405Z")
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//agenda-mcp//EN")
+	line("CALSCALE", "GREGORIAN")
+	for _, event := range agenda.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", event.ID+"/"+event.CalendarID)
+		line("DTSTAMP", stamp)
+		if event.IsAllDay {
+			line("DTSTART;VALUE=DATE", event.Start.Format("20060102"))
+			line("DTEND;VALUE=DATE", event.End.Format("20060102"))
+		} else {
+			line("DTSTART", event.Start.UTC().Format("20060102T150405Z"))
+			line("DTEND", event.End.UTC().Format("20060102T150405Z"))
+		}
+		line("SUMMARY", escapeICSText(event.Summary))
+		if event.Location != "" {
+			line("LOCATION", escapeICSText(event.Location))
+		}
+		if event.Description != "" {
+			line("DESCRIPTION", escapeICSText(event.Description))
+		}
+		if event.Category != "" {
+			line("CATEGORIES", escapeICSText(event.Category))
+		}
+		if event.Organizer != "" {
+			line("ORGANIZER", "mailto:"+event.Organizer)
+		}
+		for _, attendee := range event.Attendees {
+			params := ""
+			if attendee.Name != "" {
+				params += ";CN=" + icsParamValue(attendee.Name)
+			}
+			if status := icsPartStat(attendee.ResponseStatus); status != "" {
+				params += ";PARTSTAT=" + status
+			}
+			line("ATTENDEE"+params, "mailto:"+attendee.Email)
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return output.String(), nil
+}
+
+func icsPartStat(responseStatus string) string {
+	switch responseStatus {
+	case "accepted":
+		return "ACCEPTED"
+	case "declined":
+		return "DECLINED"
+	case "tentative":
+		return "TENTATIVE"
+	case "needsAction":
+		return "NEEDS-ACTION"
+	}
+	return ""
+}
+
+var icsTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeICSText(text string) string {
+	return icsTextEscaper.Replace(text)
+}
+
+// icsParamValue quotes a parameter value. Quoted values may contain
+// neither double quotes nor control characters, so those are dropped.
+func icsParamValue(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r == '"' || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, value)
+	return `"` + value + `"`
+}
+
+// foldICSLine splits content lines longer than 75 octets, without
+// splitting UTF-8 sequences.
+func foldICSLine(line string) string {
+	var output strings.Builder
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		output.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space
+		limit = 74
+	}
+	output.WriteString(line)
+	return output.String()
+}
+
+// periodTitle names the period of a report.
+func periodTitle(start, end time.Time) string {
+	last := end.AddDate(0, 0, -1)
+	if !last.After(start) {
+		return start.Format("Monday, January 2, 2006")
+	}
+	return fmt.Sprintf("%s to %s", start.Format("Monday, January 2"), last.Format("Monday, January 2, 2006"))
+}
+
+// hours rounds a duration to hundredths of an hour for JSON reports.
+func hours(d time.Duration) float64 {
+	return math.Round(d.Hours()*100) / 100
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenItems are the API events of the golden agenda, from Monday
+// December 23 to Wednesday December 25, 2024.
+const goldenItems = `[
+ {"id":"standup","summary":"Standup","start":{"dateTime":"2024-12-23T09:00:00Z"},"end":{"dateTime":"2024-12-23T09:15:00Z"},
+  "location":"Room 1, \"Aquarium\"","colorId":"9",
+  "organizer":{"email":"lead@example.com"},
+  "attendees":[{"email":"me@example.com","self":true,"responseStatus":"accepted"},
+   {"email":"bob@example.com","displayName":"Bob \"The Builder\"\r\nSmith","responseStatus":"tentative"},
+   {"email":"carol@example.com","displayName":"Carol; Ops, Team","responseStatus":"declined"}],
+  "description":"<p>Daily <b>sync</b></p><a href=\"https://example.com/notes\">Notes</a>",
+  "hangoutLink":"https://meet.google.com/abc-defg-hij"},
+ {"id":"focus","summary":"Deep work","eventType":"focusTime","start":{"dateTime":"2024-12-23T10:00:00Z"},"end":{"dateTime":"2024-12-23T12:00:00Z"}},
+ {"id":"release","summary":"Release night","start":{"dateTime":"2024-12-23T22:00:00Z"},"end":{"dateTime":"2024-12-24T02:00:00Z"}},
+ {"id":"holiday","summary":"Holiday","start":{"date":"2024-12-24"},"end":{"date":"2024-12-26"}}
+]`
+
+// goldenAgenda returns the agenda rendered in the golden files, as read
+// from an offline snapshot so that its output doesn't depend on today.
+func goldenAgenda(t *testing.T) (agendaView, *Config) {
+	t.Helper()
+	cs := newFakeService(t, http.NotFoundHandler())
+	var items []*calendar.Event
+	if err := json.Unmarshal([]byte(goldenItems), &items); err != nil {
+		t.Fatal(err)
+	}
+	var events []CalendarEvent
+	for _, item := range items {
+		if event, ok := cs.toCalendarEvent("primary", item); ok {
+			events = append(events, event)
+		}
+	}
+	start := time.Date(2024, 12, 23, 0, 0, 0, 0, time.UTC)
+	return agendaView{
+		URI:    "agenda://range/2024-12-23/2024-12-25",
+		Start:  start,
+		End:    start.AddDate(0, 0, 3),
+		Events: events,
+		AsOf:   time.Date(2024, 12, 22, 18, 30, 0, 0, time.UTC),
+	}, cs.config
+}
+
+func TestFormattersGolden(t *testing.T) {
+	agenda, cfg := goldenAgenda(t)
+	for _, name := range outputFormats {
+		t.Run(name, func(t *testing.T) {
+			formatter, err := newFormatter(name, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := formatter.format(agenda)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", name+".golden")
+			if *update {
+				if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("%s output differs from %s:\n%s", name, path, got)
+			}
+		})
+	}
+}
+
+func TestICSParamValue(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"Bob Smith", `"Bob Smith"`},
+		{`Bob "The Builder"`, `"Bob The Builder"`},
+		{"Carol; Ops, Team: QA", `"Carol; Ops, Team: QA"`},
+		{"Line\r\nbreak\ttab\x00", `"Linebreaktab"`},
+		{"Zoë 山田", `"Zoë 山田"`},
+	}
+	for _, tt := range tests {
+		if got := icsParamValue(tt.name); got != tt.want {
+			t.Errorf("icsParamValue(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+		if got := icsParamValue(tt.name); strings.ContainsAny(got[1:len(got)-1], "\"\r\n") {
+			t.Errorf("icsParamValue(%q) = %s breaks the content line", tt.name, got)
+		}
+	}
+}
+
+// spanEvent returns an event from start to end, given as RFC 3339 times
+// or as dates for all-day events.
+func spanEvent(t *testing.T, cs *CalendarService, start, end string) CalendarEvent {
+	t.Helper()
+	item := &calendar.Event{Id: "span", Summary: "Span", Start: &calendar.EventDateTime{}, End: &calendar.EventDateTime{}}
+	if len(start) == len("2006-01-02") {
+		item.Start.Date, item.End.Date = start, end
+	} else {
+		item.Start.DateTime, item.End.DateTime = start, end
+	}
+	event, ok := cs.toCalendarEvent("primary", item)
+	if !ok {
+		t.Fatalf("event from %s to %s dropped", start, end)
+	}
+	return event
+}
+
+func TestEventDays(t *testing.T) {
+	cs := newFakeService(t, http.NotFoundHandler())
+	loc := cs.config.location
+	day := func(date string) time.Time {
+		d, _ := time.ParseInLocation("2006-01-02", date, loc)
+		return d
+	}
+
+	tests := []struct {
+		name       string
+		start, end string
+		lastDay    string
+		// dayOfEvent on December 24, and timeRange
+		dayOf, times string
+	}{
+		{"all-day", "2024-12-24", "2024-12-25", "2024-12-24", "", "All day"},
+		{"all-day over days", "2024-12-23", "2024-12-26", "2024-12-25", "Day 2 of 3", "All day"},
+		{"all-day before", "2024-12-20", "2024-12-22", "2024-12-21", "2 days", "All day"},
+		{"timed", "2024-12-24T09:00:00Z", "2024-12-24T10:00:00Z", "2024-12-24", "", "09:00 - 10:00"},
+		{"ending at midnight", "2024-12-24T22:00:00Z", "2024-12-25T00:00:00Z", "2024-12-24", "", "22:00 - 00:00"},
+		{"midnight to midnight", "2024-12-24T00:00:00Z", "2024-12-25T00:00:00Z", "2024-12-24", "", "00:00 - 00:00"},
+		{"crossing midnight", "2024-12-23T22:00:00Z", "2024-12-24T02:00:00Z", "2024-12-24", "Day 2 of 2", "Mon Dec 23 22:00 - Tue Dec 24 02:00"},
+		{"starting at midnight", "2024-12-24T00:00:00Z", "2024-12-24T01:00:00Z", "2024-12-24", "", "00:00 - 01:00"},
+		{"over days", "2024-12-23T09:00:00Z", "2024-12-25T17:00:00Z", "2024-12-25", "Day 2 of 3", "Mon Dec 23 09:00 - Wed Dec 25 17:00"},
+		{"over days to midnight", "2024-12-23T09:00:00Z", "2024-12-25T00:00:00Z", "2024-12-24", "Day 2 of 2", "Mon Dec 23 09:00 - Wed Dec 25 00:00"},
+		{"no duration", "2024-12-24T09:00:00Z", "2024-12-24T09:00:00Z", "2024-12-24", "", "09:00"},
+		{"no duration at midnight", "2024-12-24T00:00:00Z", "2024-12-24T00:00:00Z", "2024-12-24", "", "00:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := spanEvent(t, cs, tt.start, tt.end)
+			if got := lastDay(event, loc); !got.Equal(day(tt.lastDay)) {
+				t.Errorf("lastDay = %s, want %s", got.Format("2006-01-02"), tt.lastDay)
+			}
+			if got := dayOfEvent(event, day("2024-12-24"), loc); got != tt.dayOf {
+				t.Errorf("dayOfEvent = %q, want %q", got, tt.dayOf)
+			}
+			if event.IsAllDay {
+				if event.StartTime != tt.times {
+					t.Errorf("start time = %q, want %q", event.StartTime, tt.times)
+				}
+			} else if got := timeRange(event, cs.config); got != tt.times {
+				t.Errorf("timeRange = %q, want %q", got, tt.times)
+			}
+		})
+	}
+}
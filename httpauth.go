@@ -0,0 +1,506 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthServerConfig protects the HTTP transports. With no tokens and no
+// OAuth issuer configured, the endpoint is open.
+type AuthServerConfig struct {
+	Tokens         []StaticTokenConfig  `yaml:"tokens,omitempty"`
+	OAuth          *OAuthResourceConfig `yaml:"oauth,omitempty"`
+	AllowedOrigins []string             `yaml:"allowed_origins,omitempty"`
+}
+
+// StaticTokenConfig is a bearer token, stored as the hex SHA-256 of the
+// token so the config file never contains the token itself.
+type StaticTokenConfig struct {
+	Name   string `yaml:"name"`
+	SHA256 string `yaml:"sha256"`
+}
+
+// OAuthResourceConfig makes the server an OAuth 2.1 protected resource, as
+// described by the MCP authorization spec. Access tokens are checked with
+// the issuer's token introspection endpoint (RFC 7662).
+type OAuthResourceConfig struct {
+	Resource         string   `yaml:"resource"`
+	Issuer           string   `yaml:"issuer"`
+	IntrospectionURL string   `yaml:"introspection_url"`
+	ClientID         string   `yaml:"client_id,omitempty"`
+	ClientSecret     string   `yaml:"client_secret,omitempty"`
+	RequiredScopes   []string `yaml:"required_scopes,omitempty"`
+	// AllowMissingAudience accepts tokens without an "aud" claim, for
+	// issuers that don't set one. Such tokens may be meant for another
+	// resource, so this is off by default.
+	AllowMissingAudience bool `yaml:"allow_missing_audience,omitempty"`
+}
+
+func (ac AuthServerConfig) enabled() bool {
+	return len(ac.Tokens) > 0 || ac.OAuth != nil
+}
+
+func (ac AuthServerConfig) validate() []ruleProblem {
+	var problems []ruleProblem
+	for _, token := range ac.Tokens {
+		if token.Name == "" {
+			problems = append(problems, ruleProblem{"tokens", "token name is required"})
+		}
+		if sum, err := hex.DecodeString(token.SHA256); err != nil || len(sum) != sha256.Size {
+			problems = append(problems, ruleProblem{"tokens", fmt.Sprintf("token %q: sha256 must be 64 hex characters (use 'agenda-mcp server hash-token')", token.Name)})
+		}
+	}
+	if oauth := ac.OAuth; oauth != nil {
+		if _, err := url.ParseRequestURI(oauth.Resource); err != nil {
+			problems = append(problems, ruleProblem{"oauth", "oauth.resource must be the absolute URL of the MCP endpoint"})
+		}
+		if _, err := url.ParseRequestURI(oauth.Issuer); err != nil {
+			problems = append(problems, ruleProblem{"oauth", "oauth.issuer must be the URL of the authorization server"})
+		}
+		if _, err := url.ParseRequestURI(oauth.IntrospectionURL); err != nil {
+			problems = append(problems, ruleProblem{"oauth", "oauth.introspection_url must be a URL"})
+		}
+	}
+	return problems
+}
+
+// principal is the authenticated caller of the HTTP endpoint. Subject
+// names where the identity comes from, "static:<name>" for static tokens
+// and "oauth:<issuer>#<sub>" for OAuth, so one can't pass for the other.
+type principal struct {
+	Subject string
+	Scopes  []string
+}
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, p *principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// principalFromContext returns the authenticated caller, or nil when the
+// endpoint isn't protected.
+func principalFromContext(ctx context.Context) *principal {
+	p, _ := ctx.Value(principalKey{}).(*principal)
+	return p
+}
+
+// Errors returned by token verifiers.
+var (
+	errInvalidToken      = errors.New("invalid token")
+	errInsufficientScope = errors.New("insufficient scope")
+)
+
+// tokenVerifier checks a bearer token and identifies its owner. It returns
+// errInvalidToken for tokens it doesn't accept.
+type tokenVerifier interface {
+	verify(ctx context.Context, token string) (*principal, error)
+}
+
+// staticTokenVerifier accepts the tokens whose hashes are in the config.
+type staticTokenVerifier struct {
+	tokens []StaticTokenConfig
+}
+
+func (v *staticTokenVerifier) verify(ctx context.Context, token string) (*principal, error) {
+	sum := sha256.Sum256([]byte(token))
+	var match *principal
+	for _, t := range v.tokens {
+		expected, err := hex.DecodeString(t.SHA256)
+		if err != nil {
+			continue
+		}
+		// Compare against every token so timing doesn't reveal which one matched
+		if subtle.ConstantTimeCompare(sum[:], expected) == 1 && match == nil {
+			match = &principal{Subject: "static:" + t.Name}
+		}
+	}
+	if match == nil {
+		return nil, errInvalidToken
+	}
+	return match, nil
+}
+
+// introspectionVerifier validates access tokens with the issuer's RFC 7662
+// introspection endpoint, caching positive answers until the token expires
+// or for at most introspectionCacheTTL. At most maxIntrospectionCache
+// tokens are cached, dropping those expiring first.
+type introspectionVerifier struct {
+	config *OAuthResourceConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cachedPrincipal
+}
+
+type cachedPrincipal struct {
+	principal *principal
+	expires   time.Time
+}
+
+const (
+	introspectionCacheTTL = time.Minute
+	maxIntrospectionCache = 10000
+)
+
+func newIntrospectionVerifier(config *OAuthResourceConfig) *introspectionVerifier {
+	return &introspectionVerifier{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		cache:  make(map[[sha256.Size]byte]cachedPrincipal),
+	}
+}
+
+type introspectionResponse struct {
+	Active   bool            `json:"active"`
+	Subject  string          `json:"sub"`
+	Username string          `json:"username"`
+	Scope    string          `json:"scope"`
+	Issuer   string          `json:"iss"`
+	Expires  int64           `json:"exp"`
+	Audience json.RawMessage `json:"aud"`
+}
+
+func (v *introspectionVerifier) verify(ctx context.Context, token string) (*principal, error) {
+	key := sha256.Sum256([]byte(token))
+	v.mu.Lock()
+	cached, ok := v.cache[key]
+	v.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.principal, nil
+	}
+
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.config.IntrospectionURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if v.config.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(v.config.ClientID), url.QueryEscape(v.config.ClientSecret))
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token introspection failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token introspection failed: %s", resp.Status)
+	}
+
+	var result introspectionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid introspection response: %v", err)
+	}
+
+	if !result.Active {
+		return nil, errInvalidToken
+	}
+	if result.Issuer != "" && strings.TrimSuffix(result.Issuer, "/") != strings.TrimSuffix(v.config.Issuer, "/") {
+		return nil, errInvalidToken
+	}
+	if !hasAudience(result.Audience) {
+		if !v.config.AllowMissingAudience {
+			return nil, errInvalidToken
+		}
+	} else if !audienceContains(result.Audience, v.config.Resource) {
+		return nil, errInvalidToken
+	}
+
+	subject := result.Subject
+	if subject == "" {
+		subject = result.Username
+	}
+	if subject == "" {
+		return nil, errInvalidToken
+	}
+	p := &principal{
+		Subject: "oauth:" + strings.TrimSuffix(v.config.Issuer, "/") + "#" + subject,
+		Scopes:  strings.Fields(result.Scope),
+	}
+	for _, scope := range v.config.RequiredScopes {
+		if !containsFold(p.Scopes, scope) {
+			return nil, errInsufficientScope
+		}
+	}
+
+	expires := time.Now().Add(introspectionCacheTTL)
+	if result.Expires > 0 && time.Unix(result.Expires, 0).Before(expires) {
+		expires = time.Unix(result.Expires, 0)
+	}
+	v.remember(key, cachedPrincipal{principal: p, expires: expires})
+	return p, nil
+}
+
+// remember caches a verified token, making room if needed.
+func (v *introspectionVerifier) remember(key [sha256.Size]byte, cached cachedPrincipal) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := time.Now()
+	if _, exists := v.cache[key]; !exists && len(v.cache) >= maxIntrospectionCache {
+		var first [sha256.Size]byte
+		found := false
+		for k, c := range v.cache {
+			if !now.Before(c.expires) {
+				delete(v.cache, k)
+			} else if !found || c.expires.Before(v.cache[first].expires) {
+				first, found = k, true
+			}
+		}
+		if len(v.cache) >= maxIntrospectionCache {
+			delete(v.cache, first)
+		}
+	}
+	v.cache[key] = cached
+}
+
+// hasAudience reports whether an "aud" claim is set and not empty.
+func hasAudience(raw json.RawMessage) bool {
+	switch strings.TrimSpace(string(raw)) {
+	case "", "null", `""`, "[]":
+		return false
+	}
+	return true
+}
+
+// audienceContains reports whether the "aud" claim, a string or an array
+// of strings, includes resource.
+func audienceContains(raw json.RawMessage, resource string) bool {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single == resource
+	}
+	var many []string
+	if err := json.Unmarshal(raw, &many); err == nil {
+		for _, aud := range many {
+			if aud == resource {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// chainVerifier accepts a token if any of its verifiers does.
+type chainVerifier []tokenVerifier
+
+func (c chainVerifier) verify(ctx context.Context, token string) (*principal, error) {
+	err := errInvalidToken
+	for _, v := range c {
+		p, verr := v.verify(ctx, token)
+		if verr == nil {
+			return p, nil
+		}
+		// Keep the most specific failure
+		if !errors.Is(verr, errInvalidToken) {
+			err = verr
+		}
+	}
+	return nil, err
+}
+
+// httpAuth guards the MCP endpoints with bearer tokens and origin checks.
+type httpAuth struct {
+	config      AuthServerConfig
+	verifier    tokenVerifier
+	metadataURL string
+}
+
+func newHTTPAuth(config AuthServerConfig) *httpAuth {
+	auth := &httpAuth{config: config}
+
+	var chain chainVerifier
+	if len(config.Tokens) > 0 {
+		chain = append(chain, &staticTokenVerifier{tokens: config.Tokens})
+	}
+	if config.OAuth != nil {
+		chain = append(chain, newIntrospectionVerifier(config.OAuth))
+		auth.metadataURL = protectedResourceMetadataURL(config.OAuth.Resource)
+	}
+	if len(chain) > 0 {
+		auth.verifier = chain
+	}
+	return auth
+}
+
+// protectedResourceMetadataURL returns the RFC 9728 metadata location for
+// resource, inserting the well-known path before the resource's path.
+func protectedResourceMetadataURL(resource string) string {
+	u, err := url.Parse(resource)
+	if err != nil {
+		return ""
+	}
+	u.Path = "/.well-known/oauth-protected-resource" + strings.TrimSuffix(u.Path, "/")
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// register adds the protected resource metadata endpoint to mux.
+func (a *httpAuth) register(mux *http.ServeMux) {
+	if a.config.OAuth == nil {
+		return
+	}
+	metadata, err := url.Parse(a.metadataURL)
+	if err != nil {
+		return
+	}
+	mux.HandleFunc(metadata.Path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		json.NewEncoder(w).Encode(map[string]any{
+			"resource":                 a.config.OAuth.Resource,
+			"authorization_servers":    []string{a.config.OAuth.Issuer},
+			"bearer_methods_supported": []string{"header"},
+			"scopes_supported":         a.config.OAuth.RequiredScopes,
+			"resource_name":            "Google Calendar agenda",
+		})
+	})
+}
+
+// wrap returns next guarded by the origin check and, when enabled, bearer
+// token authentication. The caller is added to the request context.
+func (a *httpAuth) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.originAllowed(r) {
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+		if a.verifier == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := bearerToken(r)
+		if !ok {
+			a.challenge(w, http.StatusUnauthorized, "", "Missing bearer token")
+			return
+		}
+
+		p, err := a.verifier.verify(r.Context(), token)
+		switch {
+		case err == nil:
+			next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+		case errors.Is(err, errInsufficientScope):
+			a.challenge(w, http.StatusForbidden, "insufficient_scope", "Insufficient scope")
+		case errors.Is(err, errInvalidToken):
+			a.challenge(w, http.StatusUnauthorized, "invalid_token", "Invalid bearer token")
+		default:
+			fmt.Fprintf(os.Stderr, "Token verification error: %v\n", err)
+			http.Error(w, "Unable to verify token", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// challenge writes a 401 or 403 with the WWW-Authenticate header clients
+// use to discover how to authenticate (RFC 6750, RFC 9728).
+func (a *httpAuth) challenge(w http.ResponseWriter, status int, code, message string) {
+	params := []string{`realm="agenda-mcp"`}
+	if code != "" {
+		params = append(params, fmt.Sprintf("error=%q", code))
+	}
+	if code == "insufficient_scope" && a.config.OAuth != nil && len(a.config.OAuth.RequiredScopes) > 0 {
+		params = append(params, fmt.Sprintf("scope=%q", strings.Join(a.config.OAuth.RequiredScopes, " ")))
+	}
+	if a.metadataURL != "" {
+		params = append(params, fmt.Sprintf("resource_metadata=%q", a.metadataURL))
+	}
+	w.Header().Set("WWW-Authenticate", "Bearer "+strings.Join(params, ", "))
+	http.Error(w, message, status)
+}
+
+// originAllowed rejects browser requests from other sites, which protects
+// against DNS rebinding. Requests without an Origin header (non-browser
+// clients) are allowed. Without a configured list, only the server's own
+// host and loopback origins are accepted.
+func (a *httpAuth) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(a.config.AllowedOrigins) > 0 {
+		for _, allowed := range a.config.AllowedOrigins {
+			if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+				return true
+			}
+		}
+		return false
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	requestHost := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		requestHost = h
+	}
+	return strings.EqualFold(host, requestHost)
+}
+
+// generateToken returns a random bearer token and its config entry hash.
+func generateToken() (token, hash string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token = "amcp_" + hex.EncodeToString(raw)
+	sum := sha256.Sum256([]byte(token))
+	return token, hex.EncodeToString(sum[:]), nil
+}
+
+// runServerMode handles the "server" subcommands.
+func runServerMode(args []string) {
+	if len(args) == 0 || args[0] != "hash-token" {
+		fmt.Println("Usage: agenda-mcp server hash-token [name]")
+		fmt.Println("  Generates a bearer token for the HTTP transport and prints the")
+		fmt.Println("  config entry holding its hash.")
+		os.Exit(1)
+	}
+
+	name := "client"
+	if len(args) >= 2 {
+		name = args[1]
+	}
+	token, hash, err := generateToken()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to generate token: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("🔑 Give this token to the MCP client (it is not stored anywhere):")
+	fmt.Printf("   %s\n\n", token)
+	fmt.Println("Add this entry to server.auth.tokens in the config file:")
+	fmt.Printf("   - name: %s\n     sha256: %s\n", name, hash)
+}
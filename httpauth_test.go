@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeIssuer serves RFC 7662 introspection answers by token.
+func fakeIssuer(t *testing.T, answers map[string]map[string]any) *httptest.Server {
+	t.Helper()
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		answer, ok := answers[r.PostForm.Get("token")]
+		if !ok {
+			answer = map[string]any{"active": false}
+		}
+		json.NewEncoder(w).Encode(answer)
+	}))
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func TestIntrospectionVerifier(t *testing.T) {
+	const resource = "https://agenda.example.com/mcp"
+	answers := map[string]map[string]any{
+		"inactive":       {"active": false, "sub": "alice", "aud": resource},
+		"wrong-audience": {"active": true, "sub": "alice", "aud": "https://other.example.com"},
+		"no-audience":    {"active": true, "sub": "alice"},
+		"empty-audience": {"active": true, "sub": "alice", "aud": []string{}},
+		"valid":          {"active": true, "sub": "alice", "aud": resource, "scope": "agenda.read"},
+		"valid-list":     {"active": true, "sub": "bob", "aud": []string{"https://other.example.com", resource}},
+		"no-scope":       {"active": true, "sub": "alice", "aud": resource},
+		"username":       {"active": true, "username": "carol", "aud": resource},
+		"anonymous":      {"active": true, "aud": resource},
+	}
+	issuer := fakeIssuer(t, answers)
+	for _, answer := range answers {
+		answer["iss"] = issuer.URL
+	}
+
+	tests := []struct {
+		token   string
+		scopes  []string
+		subject string
+		err     error
+	}{
+		{token: "unknown", err: errInvalidToken},
+		{token: "inactive", err: errInvalidToken},
+		{token: "wrong-audience", err: errInvalidToken},
+		{token: "no-audience", err: errInvalidToken},
+		{token: "empty-audience", err: errInvalidToken},
+		{token: "valid", subject: "#alice"},
+		{token: "valid-list", subject: "#bob"},
+		{token: "valid", scopes: []string{"agenda.read"}, subject: "#alice"},
+		{token: "username", subject: "#carol"},
+		{token: "anonymous", err: errInvalidToken},
+		{token: "no-scope", scopes: []string{"agenda.read"}, err: errInsufficientScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			v := newIntrospectionVerifier(&OAuthResourceConfig{
+				Resource:         resource,
+				Issuer:           issuer.URL,
+				IntrospectionURL: issuer.URL,
+				RequiredScopes:   tt.scopes,
+			})
+			p, err := v.verify(context.Background(), tt.token)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("verify(%q) = %v, %v; want error %v", tt.token, p, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify(%q) failed: %v", tt.token, err)
+			}
+			if want := "oauth:" + issuer.URL + tt.subject; p.Subject != want {
+				t.Errorf("verify(%q) subject = %q, want %q", tt.token, p.Subject, want)
+			}
+		})
+	}
+}
+
+func TestIntrospectionVerifierAllowMissingAudience(t *testing.T) {
+	issuer := fakeIssuer(t, map[string]map[string]any{
+		"no-audience":    {"active": true, "sub": "alice"},
+		"wrong-audience": {"active": true, "sub": "alice", "aud": "https://other.example.com"},
+	})
+	v := newIntrospectionVerifier(&OAuthResourceConfig{
+		Resource:             "https://agenda.example.com/mcp",
+		Issuer:               issuer.URL,
+		IntrospectionURL:     issuer.URL,
+		AllowMissingAudience: true,
+	})
+	if _, err := v.verify(context.Background(), "no-audience"); err != nil {
+		t.Errorf("token without audience rejected: %v", err)
+	}
+	if _, err := v.verify(context.Background(), "wrong-audience"); !errors.Is(err, errInvalidToken) {
+		t.Errorf("token for another resource accepted: %v", err)
+	}
+}
+
+func TestHTTPAuthRejectsTokenWithoutAudience(t *testing.T) {
+	issuer := fakeIssuer(t, map[string]map[string]any{
+		"no-audience": {"active": true, "sub": "alice"},
+	})
+	auth := newHTTPAuth(AuthServerConfig{OAuth: &OAuthResourceConfig{
+		Resource:         "https://agenda.example.com/mcp",
+		Issuer:           issuer.URL,
+		IntrospectionURL: issuer.URL,
+	}})
+	handler := auth.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request without a valid token reached the handler")
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	req.Header.Set("Authorization", "Bearer no-audience")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestIntrospectionCacheIsBounded(t *testing.T) {
+	v := newIntrospectionVerifier(&OAuthResourceConfig{})
+	now := time.Now()
+	for i := 0; i < maxIntrospectionCache; i++ {
+		v.remember(sha256.Sum256([]byte(fmt.Sprint("token", i))), cachedPrincipal{expires: now.Add(time.Duration(i+1) * time.Second)})
+	}
+	// An expired token makes room for the next one
+	expired := sha256.Sum256([]byte("token0"))
+	v.cache[expired] = cachedPrincipal{expires: now.Add(-time.Second)}
+	v.remember(sha256.Sum256([]byte("new")), cachedPrincipal{expires: now.Add(time.Minute)})
+	if _, ok := v.cache[expired]; ok || len(v.cache) != maxIntrospectionCache {
+		t.Errorf("expired token kept, %d cached", len(v.cache))
+	}
+
+	// Otherwise the token expiring first goes
+	v.remember(sha256.Sum256([]byte("newer")), cachedPrincipal{expires: now.Add(time.Minute)})
+	if _, ok := v.cache[sha256.Sum256([]byte("token1"))]; ok || len(v.cache) != maxIntrospectionCache {
+		t.Errorf("token expiring first kept, %d cached", len(v.cache))
+	}
+	if _, ok := v.cache[sha256.Sum256([]byte("newer"))]; !ok {
+		t.Error("latest token not cached")
+	}
+}
+
+func TestPrincipalNamespaces(t *testing.T) {
+	issuer := fakeIssuer(t, map[string]map[string]any{
+		"oauth-alice": {"active": true, "sub": "alice", "aud": "https://agenda.example.com/mcp"},
+	})
+	sum := sha256.Sum256([]byte("static-alice"))
+	verifier := chainVerifier{
+		&staticTokenVerifier{tokens: []StaticTokenConfig{{Name: "alice", SHA256: hex.EncodeToString(sum[:])}}},
+		newIntrospectionVerifier(&OAuthResourceConfig{
+			Resource:         "https://agenda.example.com/mcp",
+			Issuer:           issuer.URL,
+			IntrospectionURL: issuer.URL,
+		}),
+	}
+	static, err := verifier.verify(context.Background(), "static-alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oauth, err := verifier.verify(context.Background(), "oauth-alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if static.Subject != "static:alice" || oauth.Subject != "oauth:"+issuer.URL+"#alice" {
+		t.Errorf("subjects %q and %q, want them in their own namespaces", static.Subject, oauth.Subject)
+	}
+}
@@ -3,40 +3,119 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: agenda-mcp <mode> [options]")
+	args, configPath, account := extractGlobalFlags(os.Args[1:])
+
+	if len(args) < 1 {
+		fmt.Println("Usage: agenda-mcp [--config file] [--account name] <mode> [options]")
 		fmt.Println("Modes:")
 		fmt.Println("  text [YYYY-MM-DD] - Display agenda (today's agenda if no date specified)")
+		fmt.Println("       [--category a,b]  Only show events in these categories")
+		fmt.Println("       [--include-types a,b] [--exclude-types a,b]  Filter by event type")
+		fmt.Println("       [--format text|plain|markdown|json|csv|ics]  Output format (default: text)")
+		fmt.Println("       [--template file]  Render the agenda with a Go text/template")
+		fmt.Println("       [--full]  Show complete descriptions and guest lists")
 		fmt.Println("  mcp               - Start MCP server to provide agenda tool")
+		fmt.Println("       [--transport stdio|http|sse] [--listen addr] [--base-path /mcp]")
+		fmt.Println("  colors            - List the account's event colors and their categories")
+		fmt.Println("  config show       - Print the effective configuration (secrets masked)")
+		fmt.Println("  server hash-token [name] - Generate a bearer token for the HTTP transport")
+		fmt.Println("  token encrypt     - Encrypt an existing plaintext token file")
+		fmt.Println("  users list|remove <user> - Manage the users of a multi-tenant server")
+		fmt.Println("  cache status|clear|sync - Inspect, clear or refresh the local event cache")
+		fmt.Println("  prefetch [--days N]     - Store the coming days for offline use (default: 7)")
+		fmt.Println("  changes --since TIME [--week] [YYYY-MM-DD] - Show what changed on the agenda since TIME")
+		fmt.Println("  show <event-id> [--format text|plain|markdown|json|csv|ics] - Show every detail of an event")
+		fmt.Println("  stats [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--format text|markdown|json] - Show where the time went (default: this week)")
+		fmt.Println("  focus [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--min-block 90] [--start HH:MM] [--end HH:MM] [--format ...] - Report focus time and fragmentation")
+		fmt.Println("")
+		fmt.Println("Global options:")
+		fmt.Println("  --config file     - Config file (default: " + defaultConfigPath() + ")")
+		fmt.Println("  --account name    - Account from the config file to use")
 		fmt.Println("")
 		fmt.Println("Examples:")
 		fmt.Println("  agenda-mcp text           # Show today's agenda")
 		fmt.Println("  agenda-mcp text 2024-12-25   # Show agenda for Christmas")
+		fmt.Println("  agenda-mcp text --category 1:1,external   # Only 1:1s and external meetings")
 		fmt.Println("")
-		fmt.Println("Environment variables for MCP mode:")
+		fmt.Println("Environment variables (override the config file):")
 		fmt.Println("  client_id     - Google OAuth client ID")
 		fmt.Println("  project_id    - Google project ID")
 		fmt.Println("  client_secret - Google OAuth client secret")
+		fmt.Println("")
+		fmt.Println("Optional token encryption (set one):")
+		fmt.Println("  token_passphrase - Passphrase used to encrypt token.json")
+		fmt.Println("  token_key_file   - File whose contents are used to encrypt token.json")
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if err := cfg.selectAccount(account); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
 		os.Exit(1)
 	}
 
-	mode := os.Args[1]
+	mode := args[0]
 
 	switch mode {
 	case "text":
-		// Check if a date parameter was provided
-		var dateStr string
-		if len(os.Args) >= 3 {
-			dateStr = os.Args[2]
-		}
-		runTextMode(dateStr)
+		runTextMode(cfg, args[1:])
 	case "mcp":
-		runMCPMode()
+		runMCPMode(cfg, args[1:])
+	case "colors":
+		runColorsMode(cfg)
+	case "config":
+		runConfigMode(cfg, args[1:])
+	case "server":
+		runServerMode(args[1:])
+	case "token":
+		runTokenMode(args[1:])
+	case "users":
+		runUsersMode(cfg, args[1:])
+	case "cache":
+		runCacheMode(cfg, args[1:])
+	case "prefetch":
+		runPrefetchMode(cfg, args[1:])
+	case "changes":
+		runChangesMode(cfg, args[1:])
+	case "show":
+		runShowMode(cfg, args[1:])
+	case "stats":
+		runStatsMode(cfg, args[1:])
+	case "focus":
+		runFocusMode(cfg, args[1:])
 	default:
 		// Default to text mode with no date (today)
-		runTextMode("")
+		runTextMode(cfg, nil)
+	}
+}
+
+// extractGlobalFlags removes --config and --account (in either "--flag value"
+// or "--flag=value" form) from anywhere in args.
+func extractGlobalFlags(args []string) (rest []string, configPath, account string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || (name != "config" && name != "account") {
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		if name == "config" {
+			configPath = value
+		} else {
+			account = value
+		}
 	}
+	return rest, configPath, account
 }
@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -11,68 +14,478 @@ import (
 
 // Run MCP mode - start MCP server
 
-func runMCPMode() {
+func runMCPMode(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("mcp", flag.ExitOnError)
+	transport := fs.String("transport", cfg.Server.Transport, "Transport to serve: stdio, http or sse")
+	listen := fs.String("listen", cfg.Server.Listen, "Address to listen on for the http and sse transports")
+	basePath := fs.String("base-path", cfg.Server.BasePath, "Path the http and sse endpoints are served under")
+	parseFlags(fs, args)
+
+	cfg.Server.Transport = *transport
+	cfg.Server.Listen = *listen
+	cfg.Server.BasePath = normalizeBasePath(*basePath)
+	if err := cfg.Server.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid server options: %v\n", err)
+		os.Exit(1)
+	}
+
 	fmt.Fprintf(os.Stderr, "🔌 Starting MCP server...\n")
 
-	cs, err := initCalendarServiceFromEnv()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to initialize calendar service: %v\n", err)
+	hooks := &server.Hooks{}
+	var provider calendarProvider
+	var tp *tenantProvider
+	if cfg.Server.MultiTenant.Enabled {
+		if cfg.Server.Transport == transportStdio {
+			fmt.Fprintf(os.Stderr, "Invalid server options: multi_tenant requires the http or sse transport\n")
+			os.Exit(1)
+		}
+		var err error
+		tp, err = newTenantProvider(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to initialize calendar service: %v\n", err)
+			os.Exit(1)
+		}
+		tp.addHooks(hooks)
+		provider = tp
+		fmt.Fprintf(os.Stderr, "👥 Multi-tenant mode: user tokens are stored in %s\n", tp.users.dir)
+	} else {
+		cs, err := initCalendarServiceFromToken(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to initialize calendar service: %v\n", err)
+			os.Exit(1)
+		}
+		provider = staticProvider{cs}
+	}
+
+	var subs *subscriptionManager
+	if cfg.Server.PollInterval > 0 {
+		subs = newSubscriptionManager(provider, cfg.Server.PollInterval)
+		subs.addHooks(hooks)
+	}
+	rpc := newRPCLayer(subs)
+	rpc.addHooks(hooks)
+
+	s := newMCPServer(provider, cfg.Server.acceptsTemplates(),
+		server.WithHooks(hooks),
+		server.WithResourceCapabilities(subs != nil, false),
+	)
+	rpc.s = s
+	if subs != nil {
+		subs.s = s
+	}
+
+	if cache := cfg.cache(); cache != nil {
+		if err := cache.keepOpen(); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Unable to open the event cache, events are read from Google: %v\n", err)
+		} else {
+			defer cache.close()
+		}
+	}
+
+	var ext httpExtension
+	if tp != nil {
+		tp.addTools(s)
+		ext = tp
+	}
+
+	if err := serveMCP(rpc, cfg.Server, ext); err != nil {
+		fmt.Fprintf(os.Stderr, "MCP server error: %v\n", err)
 		os.Exit(1)
 	}
+}
+
+// calendarProvider returns the calendar service a tool call acts on.
+type calendarProvider interface {
+	calendarFor(ctx context.Context) (*CalendarService, error)
+}
+
+// staticProvider serves every caller from the same calendar service.
+type staticProvider struct {
+	cs *CalendarService
+}
+
+func (p staticProvider) calendarFor(ctx context.Context) (*CalendarService, error) {
+	return p.cs, nil
+}
 
+// newMCPServer creates the MCP server and registers the agenda tools.
+// The agenda tools take a template argument if templates is set.
+func newMCPServer(provider calendarProvider, templates bool, opts ...server.ServerOption) *server.MCPServer {
 	// Create MCP server
 	s := server.NewMCPServer(
 		"google-calendar-agenda",
 		"1.0.0",
-		server.WithToolCapabilities(false),
+		append([]server.ServerOption{
+			server.WithToolCapabilities(false),
+			server.WithResourceCapabilities(false, false),
+			server.WithPromptCapabilities(false),
+		}, opts...)...,
 	)
 
+	addResources(s, provider)
+	addPrompts(s, provider)
+
 	// Create the get-daily-agenda tool
-	todayTool := mcp.NewTool("get_todays_agenda",
-		mcp.WithDescription("Get today's agenda from Google Calendar for the user"),
-	)
+	todayTool := mcp.NewTool("get_todays_agenda", append([]mcp.ToolOption{
+		mcp.WithDescription("Get the user's agenda for today from Google Calendar, in the configured timezone. " +
+			"Lists each event with its time, title, category, location and attendees. Use get_agenda_for_date for other days."),
+		readOnlyAnnotations("Today's agenda", true),
+		formatOption(),
+		templateOption(templates),
+		fullOption(),
+	}, filterOptions()...)...)
 
 	// Add tool handler for today's agenda
-	s.AddTool(todayTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		events, err := cs.getTodaysEvents()
+	addTool(s, todayTool, func(ctx context.Context, args toolArgs) (*mcp.CallToolResult, error) {
+		cs, err := provider.calendarFor(ctx)
 		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("Error getting calendar events: %v", err)), nil
+			return nil, err
 		}
+		filter, err := filterFromArgs(cs.config, args)
+		if err != nil {
+			return nil, err
+		}
+		formatter, err := formatterFromArgs(cs.config, args)
+		if err != nil {
+			return nil, err
+		}
+		events, asOf, err := cs.getTodaysEvents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting calendar events: %w", err)
+		}
+		events = filter.apply(events)
 
-		agenda := formatEventsForDisplay(events)
+		view := dayView(cs.today(), events, asOf)
+		view.Full = args.bool("full")
+		agenda, err := formatter.format(view)
+		if err != nil {
+			return nil, err
+		}
 		return mcp.NewToolResultText(agenda), nil
 	})
 
 	// Create the get-agenda-for-date tool with date parameter
-	dateTool := mcp.NewTool("get_agenda_for_date",
-		mcp.WithDescription("Get agenda from Google Calendar for a specific date"),
+	dateTool := mcp.NewTool("get_agenda_for_date", append([]mcp.ToolOption{
+		mcp.WithDescription("Get the user's agenda for a specific day from Google Calendar, in the configured timezone. " +
+			"Lists each event with its time, title, category, location and attendees."),
+		readOnlyAnnotations("Agenda for a date", true),
 		mcp.WithString("date",
 			mcp.Required(),
 			mcp.Description("Date in YYYY-MM-DD format (e.g., 2024-12-25)"),
-			mcp.Pattern("^\\d{4}-\\d{2}-\\d{2}$"),
+			dateFormat(),
 		),
-	)
+		formatOption(),
+		templateOption(templates),
+		fullOption(),
+	}, filterOptions()...)...)
 
 	// Add tool handler for specific date agenda
-	s.AddTool(dateTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		// Extract date parameter from request using the correct method
-		dateStr, err := request.RequireString("date")
+	addTool(s, dateTool, func(ctx context.Context, args toolArgs) (*mcp.CallToolResult, error) {
+		dateStr := args.string("date")
+		cs, err := provider.calendarFor(ctx)
+		if err != nil {
+			return nil, err
+		}
+		filter, err := filterFromArgs(cs.config, args)
+		if err != nil {
+			return nil, err
+		}
+
+		formatter, err := formatterFromArgs(cs.config, args)
 		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter 'date': %v", err)), nil
+			return nil, err
+		}
+		day, err := cs.parseDate(dateStr)
+		if err != nil {
+			return nil, invalidArgument("date", "%v", err)
 		}
 
 		// Get events for the specified date
-		events, err := cs.getEventForDay(dateStr)
+		events, asOf, err := cs.getEventForDay(ctx, dateStr)
 		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("Error getting calendar events for %s: %v", dateStr, err)), nil
+			return nil, fmt.Errorf("error getting calendar events for %s: %w", dateStr, err)
 		}
+		events = filter.apply(events)
 
-		agenda := formatEventsForDisplayForDate(events, dateStr)
+		view := dayView(day, events, asOf)
+		view.Full = args.bool("full")
+		agenda, err := formatter.format(view)
+		if err != nil {
+			return nil, err
+		}
 		return mcp.NewToolResultText(agenda), nil
 	})
 
-	if err := server.ServeStdio(s); err != nil {
-		fmt.Fprintf(os.Stderr, "MCP server error: %v\n", err)
-		os.Exit(1)
+	eventTool := mcp.NewTool("get_event",
+		mcp.WithDescription("Get every detail of one event: complete description, guests and their responses, "+
+			"attachments, reminders, the recurrence in words, conference and dial-in info, creator, organizer "+
+			"and the link to open it in Google Calendar."),
+		readOnlyAnnotations("Event details", true),
+		mcp.WithString("event_id",
+			mcp.Required(),
+			mcp.Description("Event to get: an agenda://event URI, \"calendarId/eventId\" or an event ID"),
+		),
+		formatOption(),
+	)
+
+	addTool(s, eventTool, func(ctx context.Context, args toolArgs) (*mcp.CallToolResult, error) {
+		cs, err := provider.calendarFor(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := newFormatter(args.string("format"), cs.config); err != nil {
+			return nil, err
+		}
+		detail, err := cs.getEventDetail(ctx, args.string("event_id"))
+		if err != nil {
+			return nil, fmt.Errorf("error getting event %s: %w", args.string("event_id"), err)
+		}
+		output, err := renderEventDetail(detail, args.string("format"), cs.config)
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(output), nil
+	})
+
+	seriesTool := mcp.NewTool("list_recurring_series",
+		mcp.WithDescription("Summarize the recurring meetings the user attends in the coming weeks, "+
+			"with how often they repeat and their weekly time cost, most costly first. "+
+			"Declined meetings and events without guests are left out."),
+		readOnlyAnnotations("Recurring meetings", true),
+		mcp.WithNumber("weeks",
+			mcp.Description("Number of weeks to look ahead, starting today (default: 4)"),
+			mcp.Min(1),
+			mcp.Max(12),
+		),
+		reportFormatOption(),
+	)
+
+	addTool(s, seriesTool, func(ctx context.Context, args toolArgs) (*mcp.CallToolResult, error) {
+		cs, err := provider.calendarFor(ctx)
+		if err != nil {
+			return nil, err
+		}
+		report, err := cs.recurringMeetings(ctx, args.int("weeks", 4))
+		if err != nil {
+			return nil, fmt.Errorf("error getting recurring meetings: %w", err)
+		}
+		output, err := formatRecurringReport(report, args.string("format"), cs.config)
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(output), nil
+	})
+
+	analyticsTool := mcp.NewTool("get_time_analytics",
+		mcp.WithDescription("Report where the user's time went over a period: hours per category, number of meetings, "+
+			"the share of working hours spent in meetings, and for each day the longest free block within working hours "+
+			"and the longest run of back-to-back meetings."),
+		readOnlyAnnotations("Time analytics", true),
+		mcp.WithString("from",
+			mcp.Description("First day in YYYY-MM-DD format (default: Monday of this week)"),
+			dateFormat(),
+		),
+		mcp.WithString("to",
+			mcp.Description(fmt.Sprintf("Last day in YYYY-MM-DD format (default: a week after from); at most %d days after from", maxAnalyticsDays-1)),
+			dateFormat(),
+		),
+		reportFormatOption(),
+	)
+
+	addTool(s, analyticsTool, func(ctx context.Context, args toolArgs) (*mcp.CallToolResult, error) {
+		cs, err := provider.calendarFor(ctx)
+		if err != nil {
+			return nil, err
+		}
+		start, end, err := cs.reportPeriod(args.string("from"), args.string("to"))
+		if err != nil {
+			return nil, err
+		}
+		report, err := cs.timeAnalytics(ctx, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("error getting calendar events: %w", err)
+		}
+		output, err := formatTimeAnalytics(report, args.string("format"), cs.config)
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(output), nil
+	})
+
+	focusTool := mcp.NewTool("get_focus_report",
+		mcp.WithDescription("Report how much uninterrupted time the user has for deep work over a period: "+
+			"free blocks within working hours long enough to focus, a fragmentation score per day "+
+			"(the share of free time in gaps too short to focus), meetings that split otherwise free afternoons, "+
+			"and a comparison with the period of the same length before."),
+		readOnlyAnnotations("Focus report", true),
+		mcp.WithString("from",
+			mcp.Description("First day in YYYY-MM-DD format (default: Monday of this week)"),
+			dateFormat(),
+		),
+		mcp.WithString("to",
+			mcp.Description(fmt.Sprintf("Last day in YYYY-MM-DD format (default: a week after from); at most %d days after from", maxAnalyticsDays-1)),
+			dateFormat(),
+		),
+		mcp.WithNumber("min_block",
+			mcp.Description(fmt.Sprintf("Shortest free block that counts as focus time, in minutes (default: %d)", int(defaultFocusBlock.Minutes()))),
+			mcp.Min(1),
+			mcp.Max(24*60),
+		),
+		mcp.WithString("work_start",
+			mcp.Description("Start of the working day as HH:MM (default: the configured working hours)"),
+			mcp.Pattern(clockPattern.String()),
+		),
+		mcp.WithString("work_end",
+			mcp.Description("End of the working day as HH:MM (default: the configured working hours)"),
+			mcp.Pattern(clockPattern.String()),
+		),
+		reportFormatOption(),
+	)
+
+	addTool(s, focusTool, func(ctx context.Context, args toolArgs) (*mcp.CallToolResult, error) {
+		cs, err := provider.calendarFor(ctx)
+		if err != nil {
+			return nil, err
+		}
+		minBlock := time.Duration(args.int("min_block", 0)) * time.Minute
+		opts, err := focusOptionsFrom(cs.config, minBlock, args.string("work_start"), args.string("work_end"))
+		if err != nil {
+			return nil, err
+		}
+		start, end, err := cs.reportPeriod(args.string("from"), args.string("to"))
+		if err != nil {
+			return nil, err
+		}
+		report, err := cs.focusReport(ctx, start, end, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error getting calendar events: %w", err)
+		}
+		output, err := formatFocusReport(report, args.string("format"), cs.config)
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(output), nil
+	})
+
+	changesTool := mcp.NewTool("get_agenda_changes",
+		mcp.WithDescription("Report what changed on the user's agenda for a day or week since a given time: "+
+			"events added, cancelled, moved (new time or location) and changed responses. "+
+			"Changes are found by comparing with the agenda as it was fetched earlier."),
+		readOnlyAnnotations("Agenda changes", true),
+		mcp.WithString("since",
+			mcp.Required(),
+			mcp.Description("Compare with the agenda at this time: HH:MM today, YYYY-MM-DD, \"YYYY-MM-DD HH:MM\", RFC 3339 or a duration ago such as \"3h\""),
+		),
+		mcp.WithString("date",
+			mcp.Description("Day to check in YYYY-MM-DD format, or any day of the week with range=week (default: today)"),
+			dateFormat(),
+		),
+		mcp.WithString("range",
+			mcp.Description("Check the day or the whole week (default: day)"),
+			mcp.Enum("day", "week"),
+		),
+		reportFormatOption(),
+	)
+
+	addTool(s, changesTool, func(ctx context.Context, args toolArgs) (*mcp.CallToolResult, error) {
+		cs, err := provider.calendarFor(ctx)
+		if err != nil {
+			return nil, err
+		}
+		since, err := parseSince(args.string("since"), time.Now().In(cs.config.location))
+		if err != nil {
+			return nil, invalidArgument("since", "%v", err)
+		}
+		start, end, err := cs.changesWindow(args.string("date"), strings.EqualFold(args.string("range"), "week"))
+		if err != nil {
+			return nil, invalidArgument("date", "%v", err)
+		}
+		changes, err := cs.changesSince(ctx, start, end, since)
+		if err != nil {
+			return nil, fmt.Errorf("error getting agenda changes: %w", err)
+		}
+		output, err := formatChanges(changes, args.string("format"), cs.config)
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(output), nil
+	})
+
+	return s
+}
+
+// readOnlyAnnotations describes a tool that only reads data. openWorld
+// tools talk to Google rather than only to this server.
+func readOnlyAnnotations(title string, openWorld bool) mcp.ToolOption {
+	return mcp.WithToolAnnotation(mcp.ToolAnnotation{
+		Title:           title,
+		ReadOnlyHint:    mcp.ToBoolPtr(true),
+		DestructiveHint: mcp.ToBoolPtr(false),
+		IdempotentHint:  mcp.ToBoolPtr(true),
+		OpenWorldHint:   mcp.ToBoolPtr(openWorld),
+	})
+}
+
+// filterOptions are the event filter arguments shared by the agenda tools
+func filterOptions() []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithString("category",
+			mcp.Description("Only include events in these categories, comma-separated (e.g., \"1:1,external\")"),
+		),
+		mcp.WithString("include_types",
+			mcp.Description("Only include these event types, comma-separated: "+strings.Join(eventTypes, ", ")),
+		),
+		mcp.WithString("exclude_types",
+			mcp.Description("Exclude these event types, comma-separated (e.g., \"workingLocation,birthday\")"),
+		),
+	}
+}
+
+// filterFromArgs builds the event filter from the tool arguments
+func filterFromArgs(cfg *Config, args toolArgs) (eventFilter, error) {
+	for _, name := range []string{"include_types", "exclude_types"} {
+		for _, eventType := range splitList(args.string(name)) {
+			if !isEventType(eventType) {
+				return eventFilter{}, invalidArgument(name, "unknown event type %q, expected one of %s", eventType, strings.Join(eventTypes, ", "))
+			}
+		}
+	}
+	return newEventFilter(cfg, args.string("category"), args.string("include_types"), args.string("exclude_types"))
+}
+
+// formatterFromArgs returns the formatter of the format or template
+// argument.
+func formatterFromArgs(cfg *Config, args toolArgs) (agendaFormatter, error) {
+	text, _ := args["template"].(string)
+	if strings.TrimSpace(text) == "" {
+		formatter, err := newFormatter(args.string("format"), cfg)
+		if err != nil {
+			return nil, err
+		}
+		return formatter, nil
+	}
+	if !cfg.Server.acceptsTemplates() {
+		return nil, invalidArgument("template", "templates are only accepted over the stdio transport")
+	}
+	if args.string("format") != "" {
+		return nil, invalidArgument("template", "template and format can't be used together")
+	}
+	formatter, err := newTemplateFormatter("template", text, cfg)
+	if err != nil {
+		return nil, invalidArgument("template", "%v", err)
+	}
+	return toolTemplateFormatter{formatter}, nil
+}
+
+// toolTemplateFormatter reports template failures as invalid arguments.
+type toolTemplateFormatter struct {
+	*templateFormatter
+}
+
+func (f toolTemplateFormatter) format(agenda agendaView) (string, error) {
+	output, err := f.templateFormatter.format(agenda)
+	if err != nil {
+		return "", invalidArgument("template", "%v", err)
 	}
+	return output, nil
 }
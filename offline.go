@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/api/googleapi"
+)
+
+var snapshotsBucket = []byte("snapshots")
+
+// snapshotKeyFormat names the versions of a window by when they were
+// first fetched, so that they sort chronologically.
+const snapshotKeyFormat = "20060102T150405.000000000Z"
+
+// snapshot is a version of a window: the events as fetched at FetchedAt
+// and last confirmed unchanged at CheckedAt.
+type snapshot struct {
+	FetchedAt time.Time       `json:"fetched_at"`
+	CheckedAt time.Time       `json:"checked_at"`
+	Events    []CalendarEvent `json:"events"`
+}
+
+// snapshotKey identifies a window of the current calendars.
+func (cs *CalendarService) snapshotKey(start, end time.Time) []byte {
+	return []byte(start.Format(time.RFC3339) + "/" + end.Format(time.RFC3339) + "|" + strings.Join(cs.config.calendars(), ","))
+}
+
+// saveSnapshot records the events fetched for [start, end). A new version
+// is only added to the window's history when the events changed, and
+// versions superseded more than history_days ago are dropped.
+//
+// Layout: snapshots bucket, one bucket per owner, one bucket per window
+// and one JSON snapshot per version.
+func (cs *CalendarService) saveSnapshot(start, end time.Time, events []CalendarEvent) error {
+	now := time.Now()
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	return cs.cache.update(func(tx *bolt.Tx) error {
+		snapshots, err := tx.CreateBucketIfNotExists(snapshotsBucket)
+		if err != nil {
+			return err
+		}
+		owner, err := snapshots.CreateBucketIfNotExists([]byte(cs.owner))
+		if err != nil {
+			return err
+		}
+		key := cs.snapshotKey(start, end)
+		if owner.Get(key) != nil {
+			// A single snapshot stored before versions were kept
+			if err := owner.Delete(key); err != nil {
+				return err
+			}
+		}
+		window, err := owner.CreateBucketIfNotExists(key)
+		if err != nil {
+			return err
+		}
+
+		snap := snapshot{FetchedAt: now, Events: events}
+		versionKey := []byte(now.UTC().Format(snapshotKeyFormat))
+		if lastKey, lastData := window.Cursor().Last(); lastKey != nil {
+			var last snapshot
+			if err := json.Unmarshal(lastData, &last); err == nil {
+				if lastEvents, err := json.Marshal(last.Events); err == nil && string(lastEvents) == string(data) {
+					snap, versionKey = last, lastKey
+				}
+			}
+		}
+		snap.CheckedAt = now
+		value, err := json.Marshal(snap)
+		if err != nil {
+			return err
+		}
+		if err := window.Put(versionKey, value); err != nil {
+			return err
+		}
+		return pruneSnapshots(owner, now.AddDate(0, 0, -cs.config.Cache.HistoryDays))
+	})
+}
+
+// pruneSnapshots drops the versions superseded before cutoff, and the
+// windows not fetched since then.
+func pruneSnapshots(owner *bolt.Bucket, cutoff time.Time) error {
+	cutoffKey := cutoff.UTC().Format(snapshotKeyFormat)
+	var staleWindows [][]byte
+	err := owner.ForEachBucket(func(name []byte) error {
+		window := owner.Bucket(name)
+		var keys [][]byte
+		if err := window.ForEach(func(k, _ []byte) error {
+			keys = append(keys, k)
+			return nil
+		}); err != nil || len(keys) == 0 {
+			return err
+		}
+		for i := 0; i+1 < len(keys) && string(keys[i+1]) < cutoffKey; i++ {
+			if err := window.Delete(keys[i]); err != nil {
+				return err
+			}
+		}
+		var last snapshot
+		if err := json.Unmarshal(window.Get(keys[len(keys)-1]), &last); err != nil || last.CheckedAt.Before(cutoff) {
+			staleWindows = append(staleWindows, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range staleWindows {
+		if err := owner.DeleteBucket(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshots returns the stored versions of [start, end), oldest first.
+func (cs *CalendarService) snapshots(start, end time.Time) ([]snapshot, error) {
+	var history []snapshot
+	err := cs.cache.view(func(tx *bolt.Tx) error {
+		snapshots := tx.Bucket(snapshotsBucket)
+		if snapshots == nil || snapshots.Bucket([]byte(cs.owner)) == nil {
+			return nil
+		}
+		window := snapshots.Bucket([]byte(cs.owner)).Bucket(cs.snapshotKey(start, end))
+		if window == nil {
+			return nil
+		}
+		return window.ForEach(func(_, data []byte) error {
+			var snap snapshot
+			if err := json.Unmarshal(data, &snap); err != nil {
+				return err
+			}
+			history = append(history, snap)
+			return nil
+		})
+	})
+	return history, err
+}
+
+// offlineEvents returns the most recent events known for [start, end)
+// without contacting Google: the snapshot of the window or the cached
+// calendars, whichever is newer.
+func (cs *CalendarService) offlineEvents(start, end time.Time) ([]CalendarEvent, time.Time, bool) {
+	var snap snapshot
+	history, err := cs.snapshots(start, end)
+	found := err == nil && len(history) > 0
+	if found {
+		snap = history[len(history)-1]
+	}
+
+	// The cache is only usable if it covers the window for every calendar
+	var cached []CalendarEvent
+	var cachedAt time.Time
+	covered := true
+	for _, calendarID := range cs.config.calendars() {
+		state, err := cs.cache.state(cs.owner, calendarID)
+		if err != nil || !state.covers(start, end) {
+			covered = false
+			break
+		}
+		items, err := cs.cachedItems(calendarID, start, end)
+		if err != nil {
+			covered = false
+			break
+		}
+		for _, item := range items {
+			if event, ok := cs.toCalendarEvent(calendarID, item); ok {
+				cached = append(cached, event)
+			}
+		}
+		if cachedAt.IsZero() || state.SyncedAt.Before(cachedAt) {
+			cachedAt = state.SyncedAt
+		}
+	}
+
+	switch {
+	case covered && (!found || cachedAt.After(snap.CheckedAt)):
+		sortEvents(cached)
+		return cached, cachedAt, true
+	case found:
+		return snap.Events, snap.CheckedAt, true
+	}
+	return nil, time.Time{}, false
+}
+
+// isUnreachable reports whether err means Google couldn't be reached or
+// failed, as opposed to rejecting the request.
+func isUnreachable(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// offlineNotice labels events served from a snapshot. It is empty for
+// live data.
+func offlineNotice(asOf time.Time, cfg *Config) string {
+	if asOf.IsZero() {
+		return ""
+	}
+	return "⚠️ offline — data as of " + asOf.In(cfg.location).Format("2006-01-02 "+cfg.Formatting.TimeFormat)
+}
+
+// withOfflineNotice prepends the offline notice to a formatted agenda.
+func withOfflineNotice(agenda string, asOf time.Time, cfg *Config) string {
+	if notice := offlineNotice(asOf, cfg); notice != "" {
+		return notice + "\n\n" + agenda
+	}
+	return agenda
+}
+
+// Run prefetch mode - store the coming days for offline use
+func runPrefetchMode(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("prefetch", flag.ExitOnError)
+	days := fs.Int("days", 7, "Number of days to prefetch, starting today")
+	parseFlags(fs, args)
+	if *days < 1 {
+		log.Fatalf("--days must be at least 1")
+	}
+	if cfg.cache() == nil {
+		log.Fatalf("Prefetching requires the event cache (cache.enabled: true)")
+	}
+
+	cs, err := initCalendarService(cfg)
+	if err != nil {
+		log.Fatalf("Authentication failed: %v", err)
+	}
+	ctx := context.Background()
+	for _, calendarID := range cfg.calendars() {
+		if _, err := cs.syncCalendar(ctx, calendarID, true); err != nil {
+			log.Fatalf("Failed to sync %s: %v", calendarID, err)
+		}
+	}
+
+	today := cs.today()
+	total := 0
+	for i := 0; i < *days; i++ {
+		day := today.AddDate(0, 0, i)
+		events, _, err := cs.getAgenda(ctx, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			log.Fatalf("Failed to get events for %s: %v", day.Format("2006-01-02"), err)
+		}
+		total += len(events)
+	}
+	// Weeks are fetched as a whole by the week resources
+	for week := startOfWeek(today); week.Before(today.AddDate(0, 0, *days)); week = week.AddDate(0, 0, 7) {
+		if _, _, err := cs.getAgenda(ctx, week, week.AddDate(0, 0, 7)); err != nil {
+			log.Fatalf("Failed to get events for the week of %s: %v", week.Format("2006-01-02"), err)
+		}
+	}
+	fmt.Printf("✅ Prefetched %d days (%d events) for offline use\n", *days, total)
+}
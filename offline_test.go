@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestOnlyAgendaReadsSaveSnapshots(t *testing.T) {
+	api := newSyncAPI()
+	cs := newCachedFakeService(t, api)
+	today := cs.today()
+	api.put(timedEvent("standup", today.Add(9*time.Hour)))
+
+	if _, err := cs.timeAnalytics(context.Background(), today.AddDate(0, 0, -7), today.AddDate(0, 0, 7)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.focusReport(context.Background(), today, today.AddDate(0, 0, 7), focusOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if count := snapshotWindows(t, cs); count != 0 {
+		t.Errorf("reports saved %d snapshot windows, want none", count)
+	}
+
+	if _, _, err := cs.getEventForDay(context.Background(), today.Format("2006-01-02")); err != nil {
+		t.Fatal(err)
+	}
+	history, err := cs.snapshots(today, today.AddDate(0, 0, 1))
+	if err != nil || len(history) != 1 || len(history[0].Events) != 1 {
+		t.Errorf("day agenda snapshots: %d, %v", len(history), err)
+	}
+	if count := snapshotWindows(t, cs); count != 1 {
+		t.Errorf("got %d snapshot windows, want the day's only", count)
+	}
+}
+
+// snapshotWindows counts the windows with stored snapshots.
+func snapshotWindows(t *testing.T, cs *CalendarService) int {
+	t.Helper()
+	count := 0
+	err := cs.cache.view(func(tx *bolt.Tx) error {
+		if snapshots := tx.Bucket(snapshotsBucket); snapshots != nil && snapshots.Bucket([]byte(cs.owner)) != nil {
+			return snapshots.Bucket([]byte(cs.owner)).ForEachBucket(func([]byte) error {
+				count++
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Instructions of the prompts. The calendar data is attached as embedded
+// resources after them, so the model works from the real events.
+const (
+	dailyBriefingInstructions = `Give me a briefing for %s based on the agenda attached below.
+
+- Start with one sentence summarising the shape of the day: how busy it is and when I am free.
+- List the meetings in order with their time, title and who I am meeting. Group back-to-back meetings.
+- Call out anything that needs preparation, conflicts or overlapping events, early starts and late finishes, and meetings I haven't responded to.
+- Mention where I am working from and any out-of-office or focus time blocks.
+- Only use the events in the agenda. If it is empty, say that the day is free.
+- Keep it short enough to read in a minute.`
+
+	weeklyReviewInstructions = `Review my week from %s to %s using the agenda attached below.
+
+- Summarise how the week is spent: number of meetings, time in meetings versus free time, and the busiest and lightest days.
+- Point out recurring themes, the people and teams I meet most, and any days without time to focus.
+- List the meetings that look most important or need preparation.
+- Suggest up to three concrete changes, such as meetings to decline, shorten or move, and say why.
+- Only use the events in the agenda and don't invent details.`
+
+	prepareForMeetingInstructions = `Help me prepare for the meeting attached below.
+
+- Summarise the purpose of the meeting from its title and description.
+- List the attendees with their role in the meeting where it can be inferred, and note who hasn't responded or declined.
+- Extract any agenda, documents or links from the description.
+- Suggest questions to ask and things I should have ready.
+- Use the day's agenda, also attached, to mention what comes right before and after the meeting and how much time I have to get there or prepare.
+- Say so when the description is empty instead of guessing what the meeting is about.`
+
+	planMyDayInstructions = `Help me plan %s around the meetings in the agenda attached below.
+
+- My working hours are %s to %s (%s).
+- Find the free slots between meetings within working hours and say how long each is.
+- Propose how to use them: focus work in the longest slots, shallow tasks and email in short gaps, and breaks between long runs of meetings.
+- Respect existing focus time and out-of-office blocks, and flag meetings outside working hours.
+- Present the plan as a timeline of the day.
+- Ask me what I need to get done if it would change the plan.`
+)
+
+// addPrompts registers prompts for common agenda tasks, which embed the
+// agenda resources the task needs.
+func addPrompts(s *server.MCPServer, provider calendarProvider) {
+	s.AddPrompt(
+		mcp.NewPrompt("daily_briefing",
+			mcp.WithPromptDescription("Brief me on a day's meetings and what needs attention"),
+			mcp.WithArgument("date",
+				mcp.ArgumentDescription("Day to brief on in YYYY-MM-DD format (default: today)"),
+			),
+		),
+		func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			cs, err := provider.calendarFor(ctx)
+			if err != nil {
+				return nil, err
+			}
+			day, err := promptDate(cs, request.Params.Arguments["date"])
+			if err != nil {
+				return nil, err
+			}
+			instructions := fmt.Sprintf(dailyBriefingInstructions, formatPromptDate(day))
+			return cs.agendaPrompt(ctx, "Daily briefing for "+day.Format("2006-01-02"), instructions,
+				dayURIPrefix+day.Format("2006-01-02"))
+		},
+	)
+
+	s.AddPrompt(
+		mcp.NewPrompt("weekly_review",
+			mcp.WithPromptDescription("Review how a week is spent and suggest improvements"),
+			mcp.WithArgument("week",
+				mcp.ArgumentDescription("Any day of the week to review in YYYY-MM-DD format (default: this week)"),
+			),
+		),
+		func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			cs, err := provider.calendarFor(ctx)
+			if err != nil {
+				return nil, err
+			}
+			day, err := promptDate(cs, request.Params.Arguments["week"])
+			if err != nil {
+				return nil, err
+			}
+			monday := startOfWeek(day)
+			instructions := fmt.Sprintf(weeklyReviewInstructions,
+				formatPromptDate(monday), formatPromptDate(monday.AddDate(0, 0, 6)))
+			return cs.agendaPrompt(ctx, "Weekly review of "+monday.Format("2006-01-02"), instructions,
+				weekURIPrefix+monday.Format("2006-01-02"))
+		},
+	)
+
+	s.AddPrompt(
+		mcp.NewPrompt("prepare_for_meeting",
+			mcp.WithPromptDescription("Prepare for a meeting: purpose, attendees, links and questions"),
+			mcp.WithArgument("event_id",
+				mcp.ArgumentDescription("Event to prepare for: an agenda://event URI, \"calendarId/eventId\" or an event ID"),
+				mcp.RequiredArgument(),
+			),
+		),
+		func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			cs, err := provider.calendarFor(ctx)
+			if err != nil {
+				return nil, err
+			}
+			ref := request.Params.Arguments["event_id"]
+			if strings.TrimSpace(ref) == "" {
+				return nil, fmt.Errorf("event_id is required")
+			}
+			event, err := cs.findEvent(ctx, ref)
+			if err != nil {
+				return nil, fmt.Errorf("unable to find event %q: %v", ref, err)
+			}
+			day := event.Start.In(cs.config.location).Format("2006-01-02")
+			return cs.agendaPrompt(ctx, "Preparation for "+event.Summary, prepareForMeetingInstructions,
+				eventURI(event), dayURIPrefix+day)
+		},
+	)
+
+	s.AddPrompt(
+		mcp.NewPrompt("plan_my_day",
+			mcp.WithPromptDescription("Plan focus work and breaks around a day's meetings"),
+			mcp.WithArgument("date",
+				mcp.ArgumentDescription("Day to plan in YYYY-MM-DD format (default: today)"),
+			),
+		),
+		func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			cs, err := provider.calendarFor(ctx)
+			if err != nil {
+				return nil, err
+			}
+			day, err := promptDate(cs, request.Params.Arguments["date"])
+			if err != nil {
+				return nil, err
+			}
+			hours := cs.config.WorkingHours
+			workdays := "working days: " + strings.Join(hours.Days, ", ")
+			if !cs.config.isWorkday(day.Weekday()) {
+				workdays = "this is not one of my working days"
+			}
+			instructions := fmt.Sprintf(planMyDayInstructions, formatPromptDate(day), hours.Start, hours.End, workdays)
+			return cs.agendaPrompt(ctx, "Plan for "+day.Format("2006-01-02"), instructions,
+				dayURIPrefix+day.Format("2006-01-02"))
+		},
+	)
+}
+
+// promptDate parses an optional YYYY-MM-DD prompt argument, defaulting to
+// today.
+func promptDate(cs *CalendarService, value string) (time.Time, error) {
+	if strings.TrimSpace(value) == "" {
+		value = time.Now().In(cs.config.location).Format("2006-01-02")
+	}
+	return cs.parseDate(strings.TrimSpace(value))
+}
+
+func formatPromptDate(day time.Time) string {
+	return day.Format("Monday, January 2, 2006")
+}
+
+// agendaPrompt returns the instructions followed by the markdown contents
+// of the given resources.
+func (cs *CalendarService) agendaPrompt(ctx context.Context, description, instructions string, uris ...string) (*mcp.GetPromptResult, error) {
+	messages := []mcp.PromptMessage{
+		mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(instructions)),
+	}
+	for _, uri := range uris {
+		resource, err := parseAgendaURI(cs, uri)
+		if err != nil {
+			return nil, err
+		}
+		contents, _, err := cs.readAgendaResource(ctx, resource)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %v", uri, err)
+		}
+		for _, content := range contents {
+			if text, ok := content.(mcp.TextResourceContents); ok && text.MIMEType == mimeMarkdown {
+				messages = append(messages, mcp.NewPromptMessage(mcp.RoleUser, mcp.NewEmbeddedResource(text)))
+			}
+		}
+	}
+	return mcp.NewGetPromptResult(description, messages), nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+var ordinals = map[int]string{1: "first", 2: "second", 3: "third", 4: "fourth", 5: "fifth", -1: "last", -2: "second to last"}
+
+// describeRecurrence turns the RRULE of an event's recurrence into words,
+// e.g. "every other Tuesday until Dec 1". start is the first occurrence.
+// It returns "" for rules it can't describe.
+func describeRecurrence(recurrence []string, start time.Time, loc *time.Location) string {
+	for _, line := range recurrence {
+		if rule, ok := strings.CutPrefix(line, "RRULE:"); ok {
+			return describeRRule(rule, start, loc)
+		}
+	}
+	return ""
+}
+
+func describeRRule(rule string, start time.Time, loc *time.Location) string {
+	parts := make(map[string]string)
+	for _, part := range strings.Split(rule, ";") {
+		if name, value, found := strings.Cut(part, "="); found {
+			parts[strings.ToUpper(name)] = value
+		}
+	}
+	interval := 1
+	if value, ok := parts["INTERVAL"]; ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return ""
+		}
+		interval = n
+	}
+	start = start.In(loc)
+
+	var text string
+	switch parts["FREQ"] {
+	case "DAILY":
+		text = "every " + every(interval, "day", "days")
+		if days := parts["BYDAY"]; days != "" {
+			text = "every " + describeWeekdays(days, interval)
+		}
+	case "WEEKLY":
+		days := parts["BYDAY"]
+		if days == "" {
+			days = strings.ToUpper(start.Weekday().String()[:2])
+		}
+		text = "every " + describeWeekdays(days, interval)
+	case "MONTHLY":
+		text = "every " + every(interval, "month", "months")
+		switch {
+		case parts["BYMONTHDAY"] != "":
+			days := describeMonthDays(parts["BYMONTHDAY"])
+			if days == "" {
+				return ""
+			}
+			text += " on the " + days
+		case parts["BYDAY"] != "":
+			day := describeOrdinalWeekday(parts["BYDAY"], parts["BYSETPOS"])
+			if day == "" {
+				return ""
+			}
+			text += " on the " + day
+		default:
+			text += " on the " + ordinalNumber(start.Day())
+		}
+	case "YEARLY":
+		text = "every " + every(interval, "year", "years") + " on " + start.Format("January 2")
+	default:
+		return ""
+	}
+
+	if count := parts["COUNT"]; count != "" {
+		text += ", " + count + " times"
+	}
+	if until := parts["UNTIL"]; until != "" {
+		if t, ok := parseRRuleTime(until, loc); ok {
+			layout := "Jan 2"
+			if t.Year() != start.Year() {
+				layout = "Jan 2, 2006"
+			}
+			text += " until " + t.Format(layout)
+		}
+	}
+	return text
+}
+
+// every names the period of a rule: "week", "other week" or "3 weeks".
+func every(interval int, singular, plural string) string {
+	switch interval {
+	case 1:
+		return singular
+	case 2:
+		return "other " + singular
+	}
+	return fmt.Sprintf("%d %s", interval, plural)
+}
+
+// describeWeekdays describes a BYDAY list of a weekly rule.
+func describeWeekdays(byDay string, interval int) string {
+	var days []time.Weekday
+	for _, code := range strings.Split(byDay, ",") {
+		day, ok := rruleWeekdays[strings.ToUpper(code)]
+		if !ok {
+			return every(interval, "week", "weeks")
+		}
+		days = append(days, day)
+	}
+	if isWorkweek(days) {
+		if interval == 1 {
+			return "weekday"
+		}
+		return every(interval, "week", "weeks") + " on weekdays"
+	}
+	var names []string
+	for _, day := range days {
+		names = append(names, day.String())
+	}
+	list := joinWords(names)
+	switch interval {
+	case 1:
+		return list
+	case 2:
+		return "other " + list
+	}
+	return fmt.Sprintf("%d weeks on %s", interval, list)
+}
+
+func isWorkweek(days []time.Weekday) bool {
+	if len(days) != 5 {
+		return false
+	}
+	for _, day := range days {
+		if day == time.Saturday || day == time.Sunday {
+			return false
+		}
+	}
+	return true
+}
+
+// describeOrdinalWeekday describes a monthly BYDAY such as "2TU" or "-1FR".
+func describeOrdinalWeekday(byDay, bySetPos string) string {
+	if strings.Contains(byDay, ",") {
+		return ""
+	}
+	code := byDay[max(len(byDay)-2, 0):]
+	day, ok := rruleWeekdays[strings.ToUpper(code)]
+	if !ok {
+		return ""
+	}
+	position := byDay[:len(byDay)-len(code)]
+	if position == "" {
+		position = bySetPos
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(position, "+"))
+	if err != nil || ordinals[n] == "" {
+		return ""
+	}
+	return ordinals[n] + " " + day.String()
+}
+
+// describeMonthDays describes a BYMONTHDAY list such as "1,15" or "-1",
+// counting negative days from the end of the month. It returns "" for
+// days out of range.
+func describeMonthDays(byMonthDay string) string {
+	var days []string
+	for _, value := range strings.Split(byMonthDay, ",") {
+		n, err := strconv.Atoi(strings.TrimPrefix(value, "+"))
+		switch {
+		case err != nil || n == 0 || n < -31 || n > 31:
+			return ""
+		case ordinals[n] != "" && n < 0:
+			days = append(days, ordinals[n]+" day")
+		case n < 0:
+			days = append(days, ordinalNumber(-n)+" to last day")
+		default:
+			days = append(days, ordinalNumber(n))
+		}
+	}
+	return joinWords(days)
+}
+
+// ordinalNumber returns 1st, 2nd, 3rd, 4th...
+func ordinalNumber(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// joinWords joins words as "a, b and c".
+func joinWords(words []string) string {
+	if len(words) <= 1 {
+		return strings.Join(words, "")
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " and " + words[len(words)-1]
+}
+
+// parseRRuleTime parses an UNTIL value, a UTC time or a date.
+func parseRRuleTime(value string, loc *time.Location) (time.Time, bool) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t.In(loc), true
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("20060102", value, loc); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDescribeRRule(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	// A Tuesday
+	start := time.Date(2024, time.December, 10, 10, 0, 0, 0, loc)
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"FREQ=DAILY", "every day"},
+		{"FREQ=DAILY;INTERVAL=3", "every 3 days"},
+		{"FREQ=WEEKLY", "every Tuesday"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", "every other Monday and Wednesday"},
+		{"FREQ=WEEKLY;INTERVAL=3;BYDAY=TU,TH,FR", "every 3 weeks on Tuesday, Thursday and Friday"},
+		{"FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR", "every weekday"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TU,WE,TH,FR", "every other week on weekdays"},
+		{"FREQ=MONTHLY", "every month on the 10th"},
+		{"FREQ=MONTHLY;BYDAY=2TU", "every month on the second Tuesday"},
+		{"FREQ=MONTHLY;BYDAY=-1FR", "every month on the last Friday"},
+		{"FREQ=MONTHLY;BYDAY=TU;BYSETPOS=3", "every month on the third Tuesday"},
+		{"FREQ=MONTHLY;BYDAY=FR;BYSETPOS=-2", "every month on the second to last Friday"},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,15", "every month on the 1st and 15th"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", "every month on the last day"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-2", "every month on the second to last day"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-3", "every month on the 3rd to last day"},
+		{"FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=22", "every other month on the 22nd"},
+		{"FREQ=YEARLY", "every year on December 10"},
+		{"FREQ=WEEKLY;COUNT=10", "every Tuesday, 10 times"},
+		{"FREQ=WEEKLY;UNTIL=20241224", "every Tuesday until Dec 24"},
+		{"FREQ=WEEKLY;UNTIL=20250114", "every Tuesday until Jan 14, 2025"},
+		// The last occurrence is on Dec 31 in New York, Jan 1 in UTC
+		{"FREQ=DAILY;UNTIL=20250101T035959Z", "every day until Dec 31"},
+		{"FREQ=DAILY;UNTIL=20250101T150000Z", "every day until Jan 1, 2025"},
+		{"FREQ=HOURLY", ""},
+		{"FREQ=WEEKLY;INTERVAL=0", ""},
+		{"FREQ=WEEKLY;INTERVAL=x", ""},
+		{"FREQ=MONTHLY;BYDAY=1MO,3MO", ""},
+		{"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", ""},
+		{"FREQ=MONTHLY;BYDAY=9TU", ""},
+		{"FREQ=MONTHLY;BYMONTHDAY=0", ""},
+		{"FREQ=MONTHLY;BYMONTHDAY=32", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := describeRRule(tt.rule, start, loc); got != tt.want {
+			t.Errorf("describeRRule(%q) = %q, want %q", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestDescribeRecurrence(t *testing.T) {
+	start := time.Date(2024, time.December, 10, 10, 0, 0, 0, time.UTC)
+	recurrence := []string{"EXDATE;TZID=UTC:20241217T100000", "RRULE:FREQ=WEEKLY;BYDAY=TU"}
+	if got := describeRecurrence(recurrence, start, time.UTC); got != "every Tuesday" {
+		t.Errorf("describeRecurrence = %q, want %q", got, "every Tuesday")
+	}
+	if got := describeRecurrence([]string{"RDATE:20241225"}, start, time.UTC); got != "" {
+		t.Errorf("describeRecurrence without a rule = %q", got)
+	}
+}
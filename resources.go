@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// MIME types of the agenda resources. Every read returns both.
+const (
+	mimeMarkdown = "text/markdown"
+	mimeJSON     = "application/json"
+)
+
+// Resource URIs and templates.
+const (
+	todayURI         = "agenda://today"
+	dayURIPrefix     = "agenda://day/"
+	weekURIPrefix    = "agenda://week/"
+	eventURIPrefix   = "agenda://event/"
+	dayURITemplate   = dayURIPrefix + "{date}"
+	weekURITemplate  = weekURIPrefix + "{date}"
+	eventURITemplate = eventURIPrefix + "{calendarId}/{eventId}"
+)
+
+const resourceDescription = " Returned as markdown and as JSON."
+
+// eventURI returns the resource URI of event. The IDs are escaped since
+// calendar IDs usually contain '@' and sometimes '#'.
+func eventURI(event CalendarEvent) string {
+	return eventURIPrefix + escapeURIComponent(event.CalendarID) + "/" + escapeURIComponent(event.ID)
+}
+
+func escapeURIComponent(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// agendaJSON is the JSON form of the day and week resources.
+type agendaJSON struct {
+	URI      string `json:"uri"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Timezone string `json:"timezone"`
+	// OfflineAsOf is set when Google was unreachable and the events are
+	// the last ones fetched at that time.
+	OfflineAsOf *time.Time      `json:"offline_as_of,omitempty"`
+	Events      []eventResource `json:"events"`
+}
+
+// eventResource is an event with its resource URI.
+type eventResource struct {
+	URI string `json:"uri"`
+	CalendarEvent
+}
+
+func toEventResources(events []CalendarEvent) []eventResource {
+	out := make([]eventResource, 0, len(events))
+	for _, event := range events {
+		out = append(out, eventResource{URI: eventURI(event), CalendarEvent: event})
+	}
+	return out
+}
+
+// addResources registers the agenda resources, fetched through the same
+// calendar service as the tools.
+func addResources(s *server.MCPServer, provider calendarProvider) {
+	read := func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		cs, err := provider.calendarFor(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resource, err := parseAgendaURI(cs, request.Params.URI)
+		if err != nil {
+			return nil, err
+		}
+		contents, _, err := cs.readAgendaResource(ctx, resource)
+		return contents, err
+	}
+
+	s.AddResource(
+		mcp.NewResource(todayURI, "Today's agenda",
+			mcp.WithResourceDescription("Today's events from Google Calendar."+resourceDescription),
+			mcp.WithMIMEType(mimeMarkdown),
+		),
+		read,
+	)
+	s.AddResourceTemplate(
+		mcp.NewResourceTemplate(dayURITemplate, "Agenda for a day",
+			mcp.WithTemplateDescription("Events of a day given as YYYY-MM-DD."+resourceDescription),
+			mcp.WithTemplateMIMEType(mimeMarkdown),
+		),
+		read,
+	)
+	s.AddResourceTemplate(
+		mcp.NewResourceTemplate(weekURITemplate, "Agenda for a week",
+			mcp.WithTemplateDescription("Events from Monday to Sunday of the week containing a YYYY-MM-DD date."+resourceDescription),
+			mcp.WithTemplateMIMEType(mimeMarkdown),
+		),
+		read,
+	)
+	s.AddResourceTemplate(
+		mcp.NewResourceTemplate(eventURITemplate, "Calendar event",
+			mcp.WithTemplateDescription("A single event with its full description and guest list."+resourceDescription),
+			mcp.WithTemplateMIMEType(mimeMarkdown),
+		),
+		read,
+	)
+}
+
+// agendaResource is what an agenda URI refers to: either the events in
+// [start, end) or a single event.
+type agendaResource struct {
+	uri        string
+	start, end time.Time
+	calendarID string
+	eventID    string
+}
+
+func (r agendaResource) isEvent() bool {
+	return r.eventID != ""
+}
+
+// parseAgendaURI resolves uri. agenda://today is resolved against the
+// current date, so the same URI covers a new window every day.
+func parseAgendaURI(cs *CalendarService, uri string) (agendaResource, error) {
+	resource := agendaResource{uri: uri}
+	switch {
+	case uri == todayURI:
+		start, _ := cs.parseDate(time.Now().In(cs.config.location).Format("2006-01-02"))
+		resource.start, resource.end = start, start.AddDate(0, 0, 1)
+	case strings.HasPrefix(uri, dayURIPrefix):
+		start, err := cs.parseDate(strings.TrimPrefix(uri, dayURIPrefix))
+		if err != nil {
+			return agendaResource{}, err
+		}
+		resource.start, resource.end = start, start.AddDate(0, 0, 1)
+	case strings.HasPrefix(uri, weekURIPrefix):
+		date, err := cs.parseDate(strings.TrimPrefix(uri, weekURIPrefix))
+		if err != nil {
+			return agendaResource{}, err
+		}
+		resource.start = startOfWeek(date)
+		resource.end = resource.start.AddDate(0, 0, 7)
+	case strings.HasPrefix(uri, eventURIPrefix):
+		calendarID, eventID, err := parseEventURI(uri)
+		if err != nil {
+			return agendaResource{}, err
+		}
+		resource.calendarID, resource.eventID = calendarID, eventID
+	default:
+		return agendaResource{}, fmt.Errorf("unknown resource %q", uri)
+	}
+	return resource, nil
+}
+
+// readAgendaResource fetches a resource and returns it as markdown and
+// JSON contents, along with the events it contains.
+func (cs *CalendarService) readAgendaResource(ctx context.Context, r agendaResource) ([]mcp.ResourceContents, []CalendarEvent, error) {
+	if r.isEvent() {
+		item, event, err := cs.getEventItem(ctx, r.calendarID, r.eventID)
+		if err != nil {
+			return nil, nil, err
+		}
+		detail := cs.eventDetail(ctx, item, event)
+		detail.URI = r.uri
+		data, err := json.MarshalIndent(detail, "", "  ")
+		if err != nil {
+			return nil, nil, err
+		}
+		return resourceContents(r.uri, formatEventMarkdown(detail, cs.config), string(data)), []CalendarEvent{detail.CalendarEvent}, nil
+	}
+
+	events, asOf, err := cs.getAgenda(ctx, r.start, r.end)
+	if err != nil {
+		return nil, nil, err
+	}
+	agenda := agendaView{URI: r.uri, Start: r.start, End: r.end, Events: events, AsOf: asOf}
+	markdown, err := markdownFormatter{cfg: cs.config}.format(agenda)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := jsonFormatter{cfg: cs.config}.format(agenda)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resourceContents(r.uri, markdown, data), events, nil
+}
+
+// parseEventURI extracts the calendar and event IDs of an event URI.
+func parseEventURI(uri string) (calendarID, eventID string, err error) {
+	escapedCalendar, escapedEvent, found := strings.Cut(strings.TrimPrefix(uri, eventURIPrefix), "/")
+	if !found {
+		return "", "", fmt.Errorf("invalid event URI %q", uri)
+	}
+	if calendarID, err = url.PathUnescape(escapedCalendar); err != nil {
+		return "", "", fmt.Errorf("invalid event URI %q: %v", uri, err)
+	}
+	if eventID, err = url.PathUnescape(escapedEvent); err != nil {
+		return "", "", fmt.Errorf("invalid event URI %q: %v", uri, err)
+	}
+	if calendarID == "" || eventID == "" {
+		return "", "", fmt.Errorf("invalid event URI %q", uri)
+	}
+	return calendarID, eventID, nil
+}
+
+// startOfWeek returns the Monday of the week containing day.
+func startOfWeek(day time.Time) time.Time {
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+func resourceContents(uri, markdown, data string) []mcp.ResourceContents {
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{URI: uri, MIMEType: mimeMarkdown, Text: markdown},
+		mcp.TextResourceContents{URI: uri, MIMEType: mimeJSON, Text: data},
+	}
+}
+
+// formatAgendaMarkdown renders the agenda as markdown, with a section per
+// day when it spans several days.
+func formatAgendaMarkdown(agenda agendaView, cfg *Config) string {
+	events, start, end := agenda.Events, agenda.Start, agenda.End
+	var output strings.Builder
+	days := int(end.Sub(start).Hours()/24 + 0.5)
+	if days <= 1 {
+		output.WriteString(fmt.Sprintf("# Agenda for %s\n\n", start.Format("Monday, January 2, 2006")))
+		writeDayMarkdown(&output, start, events, cfg, agenda.Full)
+		return output.String()
+	}
+
+	output.WriteString(fmt.Sprintf("# Agenda from %s to %s\n", start.Format("Monday, January 2"), end.AddDate(0, 0, -1).Format("Monday, January 2, 2006")))
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		output.WriteString(fmt.Sprintf("\n## %s\n\n", day.Format("Monday, January 2")))
+		writeDayMarkdown(&output, day, eventsOnDay(events, day), cfg, agenda.Full)
+	}
+	return output.String()
+}
+
+// eventsOnDay returns the events taking place on the day starting at day.
+func eventsOnDay(events []CalendarEvent, day time.Time) []CalendarEvent {
+	next := day.AddDate(0, 0, 1)
+	var dayEvents []CalendarEvent
+	for _, event := range events {
+		if event.Start.Before(next) && (event.End.After(day) || event.Start.Equal(day)) {
+			dayEvents = append(dayEvents, event)
+		}
+	}
+	return dayEvents
+}
+
+func writeDayMarkdown(output *strings.Builder, day time.Time, events []CalendarEvent, cfg *Config, full bool) {
+	var locations []string
+	var remaining []CalendarEvent
+	for _, event := range events {
+		if event.EventType != "workingLocation" {
+			remaining = append(remaining, event)
+		} else if !containsFold(locations, event.WorkingLocation) {
+			locations = append(locations, event.WorkingLocation)
+		}
+	}
+	if len(locations) > 0 {
+		output.WriteString(fmt.Sprintf("Working from: %s\n\n", strings.Join(locations, ", ")))
+	}
+	if len(remaining) == 0 {
+		output.WriteString("No events scheduled.\n")
+		return
+	}
+
+	for _, event := range remaining {
+		when := "All day"
+		if !event.IsAllDay {
+			when = strings.Replace(timeRange(event, cfg), " - ", "–", 1)
+		}
+		if span := dayOfEvent(event, day, cfg.location); span != "" {
+			when += " (" + span + ")"
+		}
+		output.WriteString(fmt.Sprintf("- **%s** %s — %s %s%s\n", when, event.Summary, event.CategoryEmoji, event.Category, eventTypeTag(event)))
+		if status := eventTypeStatus(event); status != "" {
+			output.WriteString(fmt.Sprintf("  - %s\n", status))
+		}
+		if event.Location != "" {
+			output.WriteString(fmt.Sprintf("  - 📍 %s\n", event.Location))
+		}
+		if event.Description != "" && full {
+			output.WriteString(fmt.Sprintf("  - 📝 %s\n", strings.ReplaceAll(event.Description, "\n", "\n    ")))
+		} else if event.Description != "" {
+			output.WriteString(fmt.Sprintf("  - 📝 %s\n", truncateText(oneLine(event.Description), cfg.Formatting.DescriptionLength)))
+		}
+		if link := joinLink(event); link != "" {
+			output.WriteString(fmt.Sprintf("  - 🎥 <%s>\n", link))
+		}
+		for _, link := range otherLinks(event) {
+			output.WriteString(fmt.Sprintf("  - 🔗 <%s>\n", link))
+		}
+		if repeats := recurrenceLine(event); full && repeats != "" {
+			output.WriteString(fmt.Sprintf("  - 🔁 %s\n", repeats))
+		}
+		if full && len(event.Attendees) > 0 {
+			output.WriteString(fmt.Sprintf("  - 👥 %s\n", strings.Join(guestList(event), ", ")))
+		}
+		output.WriteString(fmt.Sprintf("  - `%s`\n", eventURI(event)))
+	}
+}
+
+// guestList describes the attendees of an event with their responses.
+func guestList(event CalendarEvent) []string {
+	var guests []string
+	for _, attendee := range event.Attendees {
+		name := attendee.Email
+		if attendee.Name != "" {
+			name = fmt.Sprintf("%s <%s>", attendee.Name, attendee.Email)
+		}
+		if attendee.Optional {
+			name += " (optional)"
+		}
+		if attendee.ResponseStatus != "" {
+			name += " — " + attendee.ResponseStatus
+		}
+		guests = append(guests, name)
+	}
+	return guests
+}
+
+// formatEventMarkdown renders a single event with all its details.
+func formatEventMarkdown(detail eventDetail, cfg *Config) string {
+	event := detail.CalendarEvent
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("# %s\n\n", event.Summary))
+
+	output.WriteString(fmt.Sprintf("- **When:** %s\n", eventWhen(event, cfg)))
+	if repeats := recurrenceLine(event); repeats != "" {
+		output.WriteString(fmt.Sprintf("- **Repeats:** %s\n", repeats))
+	}
+	output.WriteString(fmt.Sprintf("- **Category:** %s %s%s\n", event.CategoryEmoji, event.Category, eventTypeTag(event)))
+	if status := eventTypeStatus(event); status != "" {
+		output.WriteString(fmt.Sprintf("- **Status:** %s\n", status))
+	}
+	if event.WorkingLocation != "" {
+		output.WriteString(fmt.Sprintf("- **Working from:** %s\n", event.WorkingLocation))
+	}
+	if event.Location != "" {
+		output.WriteString(fmt.Sprintf("- **Where:** %s\n", event.Location))
+	}
+	if organizer := organizerName(detail); organizer != "" {
+		output.WriteString(fmt.Sprintf("- **Organizer:** %s\n", organizer))
+	}
+	if detail.Creator != "" && detail.Creator != event.Organizer {
+		output.WriteString(fmt.Sprintf("- **Created by:** %s\n", detail.Creator))
+	}
+	if len(event.Attendees) > 0 {
+		output.WriteString("- **Attendees:**\n")
+		for _, guest := range guestList(event) {
+			output.WriteString(fmt.Sprintf("  - %s\n", guest))
+		}
+	}
+	if link := joinLink(event); link != "" {
+		output.WriteString(fmt.Sprintf("- **Join:** <%s>\n", link))
+	}
+	for _, entry := range dialIns(detail.Conference) {
+		output.WriteString(fmt.Sprintf("- **Dial-in:** %s\n", entry))
+	}
+	if len(detail.Attachments) > 0 {
+		output.WriteString("- **Attachments:**\n")
+		for _, attachment := range detail.Attachments {
+			output.WriteString(fmt.Sprintf("  - [%s](%s)\n", attachment.Title, attachment.URL))
+		}
+	}
+	if reminders := reminderList(detail); reminders != "" {
+		output.WriteString(fmt.Sprintf("- **Reminders:** %s\n", reminders))
+	}
+	if links := otherLinks(event); len(links) > 0 {
+		output.WriteString("- **Links:**\n")
+		for _, link := range links {
+			output.WriteString(fmt.Sprintf("  - <%s>\n", link))
+		}
+	}
+	if detail.HTMLLink != "" {
+		output.WriteString(fmt.Sprintf("- **Open in Google Calendar:** <%s>\n", detail.HTMLLink))
+	}
+	if event.Description != "" {
+		output.WriteString("\n" + event.Description + "\n")
+	}
+	return output.String()
+}
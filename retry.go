@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Delays between retries of a failed Calendar API call. The delay doubles
+// on every attempt up to maxRetryDelay, with full jitter so that
+// concurrent calls don't retry in lockstep.
+const (
+	baseRetryDelay = 500 * time.Millisecond
+	maxRetryDelay  = 30 * time.Second
+)
+
+// retryTransport retries Calendar API requests that failed transiently:
+// network errors, 5xx responses and rate limiting. Every attempt first
+// takes a token from the shared limiter.
+type retryTransport struct {
+	base       http.RoundTripper
+	limiter    *rateLimiter
+	maxRetries int
+}
+
+func newRetryTransport(base http.RoundTripper, cfg *Config) *retryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &retryTransport{base: base, limiter: cfg.limiter, maxRetries: cfg.Google.MaxRetries}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if err := t.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		resp, err := t.base.RoundTrip(req)
+
+		// Only reads are retried, as a failed write may have been applied
+		idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+		retry := err != nil && ctx.Err() == nil || err == nil && isRetryableResponse(resp)
+		if !retry || !idempotent || attempt >= t.maxRetries {
+			return resp, err
+		}
+
+		delay := backoff(attempt)
+		if err == nil {
+			if after, ok := retryAfter(resp); ok {
+				delay = after
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay || delay > maxRetryDelay {
+			// The retry couldn't finish in time: report this failure
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// isRetryableResponse reports whether a response is a transient failure.
+// Google reports quota errors as 403 as well as 429, distinguished from
+// permission errors by their reason.
+func isRetryableResponse(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusForbidden:
+		return isRateLimitReason(resp)
+	}
+	return false
+}
+
+// isRateLimitReason reads the error reason of a response, leaving the
+// body readable for the caller.
+func isRateLimitReason(resp *http.Response) bool {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	var body struct {
+		Error struct {
+			Errors []struct {
+				Reason string `json:"reason"`
+			} `json:"errors"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &body) != nil {
+		return false
+	}
+	for _, item := range body.Error.Errors {
+		if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header, given in seconds or as a date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+func backoff(attempt int) time.Duration {
+	limit := maxRetryDelay
+	// Larger shifts reach the cap anyway, or overflow
+	if attempt < 16 {
+		limit = min(baseRetryDelay<<attempt, maxRetryDelay)
+	}
+	return time.Duration(rand.Int63n(int64(limit)) + 1)
+}
+
+// errRateLimited is returned when the limiter has no token for a call
+// before its deadline.
+var errRateLimited = errors.New("too many Calendar API requests: no request slot before the deadline")
+
+// rateLimiter is a token bucket shared by every Calendar API call of the
+// process, which keeps concurrent MCP calls within Google's quota. A nil
+// limiter doesn't limit.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter allows rate requests per second on average and bursts
+// of up to burst requests. A zero rate disables limiting.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	b := max(float64(burst), 1)
+	return &rateLimiter{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+// wait takes a token, waiting for one if the bucket is empty.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// Taking the token up front reserves it even while waiting
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		l.release()
+		return errRateLimited
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.release()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// release returns a token reserved by a call that gave up waiting.
+func (l *rateLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = min(l.burst, l.tokens+1)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyAPI answers with the responses in order, then with the last one,
+// counting the requests it gets.
+type flakyAPI struct {
+	responses []func(w http.ResponseWriter)
+	requests  atomic.Int32
+}
+
+func (api *flakyAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := int(api.requests.Add(1)) - 1
+	api.responses[min(n, len(api.responses)-1)](w)
+}
+
+func status(code int, body string, header ...string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for i := 0; i+1 < len(header); i += 2 {
+			w.Header().Set(header[i], header[i+1])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		io.WriteString(w, body)
+	}
+}
+
+const (
+	okBody          = `{"items":[]}`
+	rateLimitBody   = `{"error":{"code":403,"message":"Rate Limit Exceeded","errors":[{"reason":"rateLimitExceeded"}]}}`
+	userLimitBody   = `{"error":{"code":403,"message":"User Rate Limit Exceeded","errors":[{"reason":"userRateLimitExceeded"}]}}`
+	forbiddenBody   = `{"error":{"code":403,"message":"Forbidden","errors":[{"reason":"forbidden"}]}}`
+	unavailableBody = `{"error":{"code":503,"message":"Backend Error"}}`
+)
+
+// get sends a GET through a retry transport to api.
+func get(t *testing.T, transport *retryTransport, url string) (*http.Response, error) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	return transport.RoundTrip(req)
+}
+
+func newTestRetryTransport(maxRetries int) *retryTransport {
+	return &retryTransport{base: http.DefaultTransport, maxRetries: maxRetries}
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	api := &flakyAPI{responses: []func(http.ResponseWriter){
+		status(http.StatusTooManyRequests, `{"error":{"code":429}}`, "Retry-After", "1"),
+		status(http.StatusOK, okBody),
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	start := time.Now()
+	resp, err := get(t, newTestRetryTransport(4), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || api.requests.Load() != 2 {
+		t.Errorf("got %d after %d requests, want 200 after 2", resp.StatusCode, api.requests.Load())
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, before the 1s Retry-After", elapsed)
+	}
+}
+
+func TestRetryForbidden(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		requests int32
+		status   int
+	}{
+		{"rate limit", rateLimitBody, 2, http.StatusOK},
+		{"user rate limit", userLimitBody, 2, http.StatusOK},
+		{"permission", forbiddenBody, 1, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &flakyAPI{responses: []func(http.ResponseWriter){
+				status(http.StatusForbidden, tt.body, "Retry-After", "0"),
+				status(http.StatusOK, okBody),
+			}}
+			server := httptest.NewServer(api)
+			defer server.Close()
+
+			resp, err := get(t, newTestRetryTransport(4), server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.status || api.requests.Load() != tt.requests {
+				t.Errorf("got %d after %d requests, want %d after %d", resp.StatusCode, api.requests.Load(), tt.status, tt.requests)
+			}
+			// The reason was read, but the caller still gets the body
+			if body, _ := io.ReadAll(resp.Body); tt.status == http.StatusForbidden && string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestRetryGivesUpAfterMaxRetries(t *testing.T) {
+	api := &flakyAPI{responses: []func(http.ResponseWriter){status(http.StatusServiceUnavailable, unavailableBody)}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	resp, err := get(t, newTestRetryTransport(2), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || api.requests.Load() != 3 {
+		t.Errorf("got %d after %d requests, want 503 after 3", resp.StatusCode, api.requests.Load())
+	}
+}
+
+func TestRetryStopsAtDeadline(t *testing.T) {
+	// Google asks for a wait the call's deadline doesn't leave
+	api := &flakyAPI{responses: []func(http.ResponseWriter){
+		status(http.StatusServiceUnavailable, unavailableBody, "Retry-After", "20"),
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	start := time.Now()
+	resp, err := newTestRetryTransport(4).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed > time.Second || api.requests.Load() != 1 {
+		t.Errorf("gave up after %v and %d requests, want at once after 1", elapsed, api.requests.Load())
+	}
+}
+
+func TestBackoffIsCapped(t *testing.T) {
+	for attempt := 0; attempt < 100; attempt++ {
+		limit := maxRetryDelay
+		if attempt < 6 {
+			limit = baseRetryDelay << attempt
+		}
+		for i := 0; i < 20; i++ {
+			if delay := backoff(attempt); delay <= 0 || delay > limit {
+				t.Fatalf("backoff(%d) = %v, want in (0, %v]", attempt, delay, limit)
+			}
+		}
+	}
+}
+
+func TestRateLimiterIsShared(t *testing.T) {
+	server := httptest.NewServer(&flakyAPI{responses: []func(http.ResponseWriter){status(http.StatusOK, okBody)}})
+	defer server.Close()
+
+	// Two services of the same configuration, like two users' calendars
+	cfg := defaultConfig()
+	cfg.limiter = newRateLimiter(20, 1)
+	first := newRetryTransport(nil, cfg)
+	second := newRetryTransport(nil, cfg)
+	if first.limiter != second.limiter {
+		t.Fatal("transports of one configuration have their own limiters")
+	}
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		transport := first
+		if i%2 == 1 {
+			transport = second
+		}
+		resp, err := get(t, transport, server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// The burst covers the first request, the others wait 1/20s each
+	if elapsed := time.Since(start); elapsed < 240*time.Millisecond {
+		t.Errorf("6 requests at 20/s took %v, want at least 250ms", elapsed)
+	}
+}
+
+func TestRateLimiterGivesUpAtDeadline(t *testing.T) {
+	limiter := newRateLimiter(1, 1)
+	if err := limiter.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := limiter.wait(ctx); err != errRateLimited {
+		t.Errorf("wait without a token before the deadline = %v, want errRateLimited", err)
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// rpcLayer sits in front of the MCP server and answers the JSON-RPC
+// methods the MCP library doesn't implement. Everything else is passed
+// through unchanged.
+type rpcLayer struct {
+	s    *server.MCPServer
+	subs *subscriptionManager
+
+	mu       sync.Mutex
+	sessions map[string]server.ClientSession
+	inflight map[inflightKey]context.CancelFunc
+}
+
+// Methods answered by the layer.
+const (
+	methodResourcesSubscribe    = "resources/subscribe"
+	methodResourcesUnsubscribe  = "resources/unsubscribe"
+	methodNotificationCancelled = "notifications/cancelled"
+)
+
+// maxConcurrentRequests bounds the requests of the stdio session handled
+// at the same time.
+const maxConcurrentRequests = 16
+
+// inflightKey identifies a request being handled, so the client can
+// cancel it.
+type inflightKey struct {
+	sessionID string
+	id        string
+}
+
+func newRPCLayer(subs *subscriptionManager) *rpcLayer {
+	return &rpcLayer{
+		subs:     subs,
+		sessions: make(map[string]server.ClientSession),
+		inflight: make(map[inflightKey]context.CancelFunc),
+	}
+}
+
+// addHooks keeps track of the connected sessions.
+func (l *rpcLayer) addHooks(hooks *server.Hooks) {
+	hooks.AddOnRegisterSession(func(ctx context.Context, session server.ClientSession) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.sessions[session.SessionID()] = session
+	})
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.sessions, session.SessionID())
+	})
+}
+
+func (l *rpcLayer) session(sessionID string) (server.ClientSession, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	session, ok := l.sessions[sessionID]
+	return session, ok
+}
+
+// track registers a request until done is called, so that
+// notifications/cancelled can cancel its context.
+func (l *rpcLayer) track(ctx context.Context, sessionID string, id json.RawMessage) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	key := inflightKey{sessionID, compactID(id)}
+	l.mu.Lock()
+	l.inflight[key] = cancel
+	l.mu.Unlock()
+	return ctx, func() {
+		l.mu.Lock()
+		delete(l.inflight, key)
+		l.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancel cancels a request of the session. Unknown requests, which may
+// have completed already, are ignored.
+func (l *rpcLayer) cancel(sessionID string, id json.RawMessage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cancel, ok := l.inflight[inflightKey{sessionID, compactID(id)}]; ok {
+		cancel()
+	}
+}
+
+func compactID(id json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, id); err != nil {
+		return string(id)
+	}
+	return buf.String()
+}
+
+// rpcMessage holds the fields of a JSON-RPC message the layer looks at.
+type rpcMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC response written by the layer itself.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func errorResponse(id json.RawMessage, code int, message string) *rpcResponse {
+	return &rpcResponse{JSONRPC: mcp.JSONRPC_VERSION, ID: id, Error: &rpcError{Code: code, Message: message}}
+}
+
+// intercept answers message if the layer handles its method. Handled
+// notifications have a nil response.
+func (l *rpcLayer) intercept(ctx context.Context, sessionID string, message json.RawMessage) (*rpcResponse, bool) {
+	var msg rpcMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return nil, false
+	}
+	if msg.Method == methodNotificationCancelled {
+		var params struct {
+			RequestID json.RawMessage `json:"requestId"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err == nil && len(params.RequestID) > 0 {
+			l.cancel(sessionID, params.RequestID)
+		}
+		return nil, true
+	}
+	if len(msg.ID) == 0 {
+		return nil, false
+	}
+
+	switch msg.Method {
+	case methodResourcesSubscribe, methodResourcesUnsubscribe:
+		if l.subs == nil {
+			return errorResponse(msg.ID, mcp.METHOD_NOT_FOUND, "resource subscriptions are disabled"), true
+		}
+		var params mcp.SubscribeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil || params.URI == "" {
+			return errorResponse(msg.ID, mcp.INVALID_PARAMS, "a resource uri is required"), true
+		}
+		if msg.Method == methodResourcesUnsubscribe {
+			l.subs.unsubscribe(sessionID, params.URI)
+		} else if err := l.subs.subscribe(ctx, sessionID, params.URI); err != nil {
+			return errorResponse(msg.ID, mcp.INVALID_PARAMS, err.Error()), true
+		}
+		return &rpcResponse{JSONRPC: mcp.JSONRPC_VERSION, ID: msg.ID, Result: struct{}{}}, true
+	}
+	return nil, false
+}
+
+// handle processes one message from a session and returns the response,
+// or nil for notifications.
+func (l *rpcLayer) handle(ctx context.Context, sessionID string, message json.RawMessage) any {
+	if response, ok := l.intercept(ctx, sessionID, message); ok {
+		if response == nil {
+			return nil
+		}
+		return response
+	}
+	if response := l.s.HandleMessage(ctx, message); response != nil {
+		return response
+	}
+	return nil
+}
+
+// wrapHTTP intercepts messages posted to the streamable HTTP endpoint,
+// answering them in the response body. Other requests are handled by
+// next within the POST, so they are tracked for cancellation meanwhile.
+func (l *rpcLayer) wrapHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		message, ok := readMessage(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sessionID := r.Header.Get("Mcp-Session-Id")
+		if response, handled := l.intercept(r.Context(), sessionID, message); handled {
+			if response == nil {
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		var msg rpcMessage
+		if json.Unmarshal(message, &msg) == nil && len(msg.ID) > 0 && sessionID != "" {
+			ctx, untrack := l.track(r.Context(), sessionID, msg.ID)
+			defer untrack()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// wrapSSE handles messages posted to the SSE message endpoint. As the SSE
+// transport requires, they are acknowledged with 202 and answered on the
+// event stream. Requests are handled here rather than by the SSE server,
+// which detaches them from any context that could be cancelled.
+func (l *rpcLayer) wrapSSE(sseServer *server.SSEServer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		message, ok := readMessage(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Unknown sessions and notifications are left to the SSE server
+		sessionID := r.URL.Query().Get("sessionId")
+		session, connected := l.session(sessionID)
+		var msg rpcMessage
+		if !connected || json.Unmarshal(message, &msg) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if msg.Method == methodNotificationCancelled {
+			l.intercept(r.Context(), sessionID, message)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		if len(msg.ID) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		ctx, untrack := l.track(l.s.WithContext(context.WithoutCancel(r.Context()), session), sessionID, msg.ID)
+		go func() {
+			defer untrack()
+			response := l.handle(ctx, sessionID, message)
+			if response == nil || ctx.Err() != nil {
+				// Cancelled requests aren't answered
+				return
+			}
+			if err := sseServer.SendEventToSession(sessionID, response); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to answer session %s: %v\n", sessionID, err)
+			}
+		}()
+	})
+}
+
+// readMessage reads a POSTed JSON-RPC message and restores the body so
+// the next handler can read it again.
+func readMessage(r *http.Request) (json.RawMessage, bool) {
+	if r.Method != http.MethodPost || r.Body == nil {
+		return nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4<<20))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil || !json.Valid(body) {
+		return nil, false
+	}
+	return body, true
+}
+
+// stdioSession is the single client session of the stdio transport.
+type stdioSession struct {
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+}
+
+func (s *stdioSession) SessionID() string { return "stdio" }
+
+func (s *stdioSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func (s *stdioSession) Initialize() { s.initialized.Store(true) }
+
+func (s *stdioSession) Initialized() bool { return s.initialized.Load() }
+
+// serveStdio serves newline-delimited JSON-RPC on stdin and stdout until
+// stdin is closed or ctx is done.
+func (l *rpcLayer) serveStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	session := &stdioSession{notifications: make(chan mcp.JSONRPCNotification, 100)}
+	if err := l.s.RegisterSession(ctx, session); err != nil {
+		return err
+	}
+	defer l.s.UnregisterSession(ctx, session.SessionID())
+	ctx = l.s.WithContext(ctx, session)
+
+	var mu sync.Mutex
+	encoder := json.NewEncoder(out)
+	write := func(v any) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := encoder.Encode(v); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to write response: %v\n", err)
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case notification := <-session.notifications:
+				write(notification)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	slots := make(chan struct{}, maxConcurrentRequests)
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				select {
+				case lines <- line:
+				case <-done:
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case line := <-lines:
+			var msg rpcMessage
+			if json.Unmarshal(line, &msg) != nil || len(msg.ID) == 0 {
+				// Notifications are handled in order
+				if response := l.handle(ctx, session.SessionID(), line); response != nil {
+					write(response)
+				}
+				continue
+			}
+			// Requests are handled concurrently so a slow call doesn't
+			// hold up the others, or the notification cancelling it
+			requestCtx, untrack := l.track(ctx, session.SessionID(), msg.ID)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer untrack()
+				select {
+				case slots <- struct{}{}:
+					defer func() { <-slots }()
+				case <-requestCtx.Done():
+					return
+				}
+				response := l.handle(requestCtx, session.SessionID(), line)
+				if response != nil && requestCtx.Err() == nil {
+					write(response)
+				}
+			}()
+		}
+	}
+}
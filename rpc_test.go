@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	slowToolCall    = `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"get_todays_agenda","arguments":{}}}`
+	cancelToolCall  = `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":1,"reason":"test"}}`
+	initializeCall  = `{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`
+	cancelWaitLabel = "the Google API call to be aborted"
+)
+
+// newTestRPCLayer returns an RPC layer in front of an MCP server for cs.
+func newTestRPCLayer(cs *CalendarService) *rpcLayer {
+	hooks := &server.Hooks{}
+	rpc := newRPCLayer(nil)
+	rpc.addHooks(hooks)
+	rpc.s = newMCPServer(staticProvider{cs}, true, server.WithHooks(hooks))
+	return rpc
+}
+
+// lockedBuffer is an output written by several goroutines.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestStdioCancelledRequest(t *testing.T) {
+	api := newBlockingAPI()
+	rpc := newTestRPCLayer(newFakeService(t, api))
+	in, input := io.Pipe()
+	var out lockedBuffer
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		if err := rpc.serveStdio(context.Background(), in, &out); err != nil {
+			t.Errorf("serveStdio: %v", err)
+		}
+	}()
+
+	io.WriteString(input, slowToolCall+"\n")
+	waitFor(t, api.started, "the tool to call Google")
+	io.WriteString(input, cancelToolCall+"\n")
+	waitFor(t, api.aborted, cancelWaitLabel)
+
+	// serveStdio waits for its requests, so returning proves the
+	// cancelled one did
+	input.Close()
+	waitFor(t, served, "serveStdio to return")
+
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		var msg struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &msg) == nil && string(msg.ID) == "1" {
+			t.Errorf("cancelled request was answered: %s", scanner.Text())
+		}
+	}
+}
+
+func TestHTTPCancelledRequest(t *testing.T) {
+	api := newBlockingAPI()
+	rpc := newTestRPCLayer(newFakeService(t, api))
+	endpoint := httptest.NewServer(rpc.wrapHTTP(server.NewStreamableHTTPServer(rpc.s)))
+	defer endpoint.Close()
+
+	post := func(sessionID, body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, endpoint.URL+"/mcp", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if sessionID != "" {
+			req.Header.Set("Mcp-Session-Id", sessionID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("POST %s: %v", body, err)
+			return nil
+		}
+		return resp
+	}
+
+	resp := post("", initializeCall)
+	if resp == nil {
+		t.FailNow()
+	}
+	resp.Body.Close()
+	sessionID := resp.Header.Get("Mcp-Session-Id")
+	if sessionID == "" {
+		t.Fatal("no session ID in the initialize response")
+	}
+
+	answered := make(chan struct{})
+	var body []byte
+	go func() {
+		defer close(answered)
+		if resp := post(sessionID, slowToolCall); resp != nil {
+			body, _ = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+	}()
+
+	waitFor(t, api.started, "the tool to call Google")
+	resp = post(sessionID, cancelToolCall)
+	if resp == nil {
+		t.FailNow()
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("cancellation: status %d, want %d", resp.StatusCode, http.StatusAccepted)
+	}
+	waitFor(t, api.aborted, cancelWaitLabel)
+	waitFor(t, answered, "the cancelled POST to return")
+	if len(bytes.TrimSpace(body)) > 0 {
+		t.Errorf("cancelled request was answered: %s", body)
+	}
+}
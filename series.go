@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// Limits on the series looked up. Rules rarely change, and events are
+// listed as single instances, so every series would otherwise cost a
+// request per fetch. Series that can't be read are remembered too, for a
+// shorter while, and the oldest lookups go when there are too many.
+const (
+	seriesTTL        = time.Hour
+	missingSeriesTTL = 10 * time.Minute
+	maxSeries        = 1000
+)
+
+// recurringSeries is the master event of a series: its rule and what its
+// instances look like unless changed.
+type recurringSeries struct {
+	Recurrence []string
+	Text       string
+	Summary    string
+	Location   string
+	Duration   time.Duration
+	fetchedAt  time.Time
+	// missing is set when the series couldn't be read
+	missing bool
+}
+
+// fresh reports whether a looked up series can still be used.
+func (s recurringSeries) fresh() bool {
+	if s.missing {
+		return time.Since(s.fetchedAt) < missingSeriesTTL
+	}
+	return time.Since(s.fetchedAt) < seriesTTL
+}
+
+// recurringSeries returns the series seriesID of a calendar, or false
+// when it can't be read.
+func (cs *CalendarService) recurringSeries(ctx context.Context, calendarID, seriesID string) (recurringSeries, bool) {
+	key := calendarID + "/" + seriesID
+	cs.seriesMu.Lock()
+	series, ok := cs.series[key]
+	cs.seriesMu.Unlock()
+	if ok && series.fresh() {
+		return series, !series.missing
+	}
+
+	item, err := cs.fetchEvent(ctx, calendarID, seriesID)
+	if err != nil && ctx.Err() != nil {
+		// The caller gave up, which says nothing about the series
+		return recurringSeries{}, false
+	}
+	series = recurringSeries{fetchedAt: time.Now(), missing: err != nil}
+	if err == nil {
+		start, end, _ := cs.eventTimes(item)
+		series.Recurrence = item.Recurrence
+		series.Text = describeRecurrence(item.Recurrence, start, cs.config.location)
+		series.Summary = item.Summary
+		series.Location = item.Location
+		series.Duration = end.Sub(start)
+	}
+	cs.rememberSeries(key, series)
+	return series, !series.missing
+}
+
+// rememberSeries stores a looked up series, making room if needed.
+func (cs *CalendarService) rememberSeries(key string, series recurringSeries) {
+	cs.seriesMu.Lock()
+	defer cs.seriesMu.Unlock()
+	if cs.series == nil {
+		cs.series = make(map[string]recurringSeries)
+	}
+	if _, exists := cs.series[key]; !exists && len(cs.series) >= maxSeries {
+		oldest := ""
+		for k, s := range cs.series {
+			if !s.fresh() {
+				delete(cs.series, k)
+			} else if oldest == "" || s.fetchedAt.Before(cs.series[oldest].fetchedAt) {
+				oldest = k
+			}
+		}
+		if len(cs.series) >= maxSeries {
+			delete(cs.series, oldest)
+		}
+	}
+	cs.series[key] = series
+}
+
+// describeSeries sets the recurrence of an event from its series. An
+// instance is an exception when it was moved, resized, renamed or
+// relocated from what the series says.
+func (cs *CalendarService) describeSeries(ctx context.Context, event *CalendarEvent, item *calendar.Event) {
+	if cs.maskedBusy(item) {
+		return
+	}
+	if len(item.Recurrence) > 0 {
+		event.RecurrenceText = describeRecurrence(item.Recurrence, event.Start, cs.config.location)
+		return
+	}
+	if item.RecurringEventId == "" {
+		return
+	}
+	series, ok := cs.recurringSeries(ctx, event.CalendarID, item.RecurringEventId)
+	if !ok {
+		return
+	}
+	event.RecurrenceText = series.Text
+
+	start, end, _ := cs.eventTimes(item)
+	original := start
+	if item.OriginalStartTime != nil {
+		original, _, _ = cs.eventTimes(&calendar.Event{Start: item.OriginalStartTime, End: item.OriginalStartTime})
+	}
+	event.Exception = !start.Equal(original) || end.Sub(start) != series.Duration ||
+		item.Summary != series.Summary || item.Location != series.Location
+}
+
+// recurrenceLine describes the recurrence of an event for display.
+func recurrenceLine(event CalendarEvent) string {
+	text := event.RecurrenceText
+	if text == "" && event.RecurringEventID != "" {
+		text = "recurring"
+	}
+	if text != "" && event.Exception {
+		text += " (this occurrence was changed)"
+	}
+	return text
+}
+
+// seriesCost is a recurring meeting with the time it takes.
+type seriesCost struct {
+	Summary        string
+	RecurrenceText string
+	Category       string
+	CategoryEmoji  string
+	Organizer      string
+	Attendees      int
+	Occurrences    int
+	Total          time.Duration
+	// Weekly is the average time a week over the period
+	Weekly time.Duration
+	Next   time.Time
+}
+
+// recurringReport lists the recurring meetings of [Start, End).
+type recurringReport struct {
+	Start, End time.Time
+	Weeks      int
+	AsOf       time.Time
+	Series     []seriesCost
+}
+
+// recurringMeetings summarises the recurring meetings the user attends in
+// the coming weeks: timed events with guests the user hasn't declined.
+func (cs *CalendarService) recurringMeetings(ctx context.Context, weeks int) (*recurringReport, error) {
+	start := cs.today()
+	end := start.AddDate(0, 0, 7*weeks)
+	events, asOf, err := cs.getEvents(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &recurringReport{Start: start, End: end, Weeks: weeks, AsOf: asOf}
+	bySeries := make(map[string]*seriesCost)
+	var order []string
+	for _, event := range events {
+		if event.RecurringEventID == "" || event.IsAllDay || event.EventType == "workingLocation" ||
+			event.attendeeCount() <= 1 || event.declined() {
+			continue
+		}
+		key := event.CalendarID + "/" + event.RecurringEventID
+		series, ok := bySeries[key]
+		if !ok {
+			series = &seriesCost{
+				Summary:        event.Summary,
+				RecurrenceText: event.RecurrenceText,
+				Category:       event.Category,
+				CategoryEmoji:  event.CategoryEmoji,
+				Organizer:      event.Organizer,
+				Next:           event.Start,
+			}
+			bySeries[key] = series
+			order = append(order, key)
+		}
+		series.Occurrences++
+		series.Total += event.End.Sub(event.Start)
+		series.Attendees = max(series.Attendees, event.attendeeCount())
+	}
+	for _, key := range order {
+		series := bySeries[key]
+		series.Weekly = series.Total / time.Duration(weeks)
+		report.Series = append(report.Series, *series)
+	}
+	sort.SliceStable(report.Series, func(i, j int) bool {
+		return report.Series[i].Weekly > report.Series[j].Weekly
+	})
+	return report, nil
+}
+
+// formatRecurringReport renders the recurring meetings, most costly first,
+// as text, markdown or JSON.
+func formatRecurringReport(report *recurringReport, format string, cfg *Config) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", formatText:
+		return withOfflineNotice(recurringReportText(report, cfg), report.AsOf, cfg), nil
+	case formatMarkdown:
+		return withOfflineNotice(recurringReportMarkdown(report, cfg), report.AsOf, cfg), nil
+	case formatJSON:
+		out, err := json.MarshalIndent(recurringReportJSON(report), "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+	return "", fmt.Errorf("unknown format %q: use one of %s", format, strings.Join(reportFormats, ", "))
+}
+
+// weeklyTotal is the weekly time of all the series.
+func (r *recurringReport) weeklyTotal() time.Duration {
+	var weekly time.Duration
+	for _, series := range r.Series {
+		weekly += series.Weekly
+	}
+	return weekly
+}
+
+// guests describes who attends a series.
+func (s seriesCost) guests() string {
+	guests := fmt.Sprintf("%d guests", s.Attendees)
+	if s.Organizer != "" {
+		guests += ", organized by " + s.Organizer
+	}
+	return guests
+}
+
+func recurringReportText(report *recurringReport, cfg *Config) string {
+	var output strings.Builder
+	last := report.End.AddDate(0, 0, -1)
+	output.WriteString(fmt.Sprintf("🔁 Recurring meetings from %s to %s\n", report.Start.Format("Monday, January 2"), last.Format("Monday, January 2, 2006")))
+	output.WriteString(strings.Repeat("=", 50) + "\n\n")
+	if len(report.Series) == 0 {
+		output.WriteString("🎉 No recurring meetings in this period!\n")
+		return output.String()
+	}
+
+	for i, series := range report.Series {
+		output.WriteString(fmt.Sprintf("%d. %s %s %s\n", i+1, series.Summary, series.CategoryEmoji, series.Category))
+		if series.RecurrenceText != "" {
+			output.WriteString(fmt.Sprintf("   🔁 %s\n", series.RecurrenceText))
+		}
+		output.WriteString(fmt.Sprintf("   ⏱️  %s a week (%d × %s)\n", formatDuration(series.Weekly),
+			series.Occurrences, formatDuration(series.Total/time.Duration(series.Occurrences))))
+		output.WriteString(fmt.Sprintf("   📅 Next: %s\n", series.Next.In(cfg.location).Format("Mon Jan 2, "+cfg.Formatting.TimeFormat)))
+		output.WriteString(fmt.Sprintf("   👥 %s\n\n", series.guests()))
+	}
+	output.WriteString(fmt.Sprintf("⏱️  %s a week in %d recurring meetings\n", formatDuration(report.weeklyTotal()), len(report.Series)))
+	return output.String()
+}
+
+func recurringReportMarkdown(report *recurringReport, cfg *Config) string {
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("# Recurring meetings for %s\n\n", periodTitle(report.Start, report.End)))
+	if len(report.Series) == 0 {
+		output.WriteString("No recurring meetings in this period.\n")
+		return output.String()
+	}
+	output.WriteString(fmt.Sprintf("%s a week in %d recurring meetings.\n\n", formatDuration(report.weeklyTotal()), len(report.Series)))
+	for _, series := range report.Series {
+		output.WriteString(fmt.Sprintf("## %s\n\n", series.Summary))
+		if series.RecurrenceText != "" {
+			output.WriteString(fmt.Sprintf("- **Repeats:** %s\n", series.RecurrenceText))
+		}
+		output.WriteString(fmt.Sprintf("- **Time:** %s a week (%d × %s)\n", formatDuration(series.Weekly),
+			series.Occurrences, formatDuration(series.Total/time.Duration(series.Occurrences))))
+		output.WriteString(fmt.Sprintf("- **Next:** %s\n", series.Next.In(cfg.location).Format("Mon Jan 2, "+cfg.Formatting.TimeFormat)))
+		output.WriteString(fmt.Sprintf("- **Guests:** %s\n\n", series.guests()))
+	}
+	return output.String()
+}
+
+// recurringReportJSONData is the JSON form of the recurring meetings.
+// Times are in hours.
+type recurringReportJSONData struct {
+	From        string           `json:"from"`
+	To          string           `json:"to"`
+	Weeks       int              `json:"weeks"`
+	OfflineAsOf *time.Time       `json:"offline_as_of,omitempty"`
+	WeeklyHours float64          `json:"weekly_hours"`
+	Series      []seriesCostJSON `json:"series"`
+}
+
+type seriesCostJSON struct {
+	Summary       string    `json:"summary"`
+	Recurrence    string    `json:"recurrence,omitempty"`
+	Category      string    `json:"category"`
+	CategoryEmoji string    `json:"category_emoji,omitempty"`
+	Organizer     string    `json:"organizer,omitempty"`
+	Attendees     int       `json:"attendees"`
+	Occurrences   int       `json:"occurrences"`
+	Hours         float64   `json:"hours"`
+	WeeklyHours   float64   `json:"weekly_hours"`
+	Next          time.Time `json:"next"`
+}
+
+func recurringReportJSON(report *recurringReport) recurringReportJSONData {
+	data := recurringReportJSONData{
+		From:        report.Start.Format("2006-01-02"),
+		To:          report.End.AddDate(0, 0, -1).Format("2006-01-02"),
+		Weeks:       report.Weeks,
+		WeeklyHours: hours(report.weeklyTotal()),
+		Series:      []seriesCostJSON{},
+	}
+	if !report.AsOf.IsZero() {
+		data.OfflineAsOf = &report.AsOf
+	}
+	for _, series := range report.Series {
+		data.Series = append(data.Series, seriesCostJSON{
+			Summary:       series.Summary,
+			Recurrence:    series.RecurrenceText,
+			Category:      series.Category,
+			CategoryEmoji: series.CategoryEmoji,
+			Organizer:     series.Organizer,
+			Attendees:     series.Attendees,
+			Occurrences:   series.Occurrences,
+			Hours:         hours(series.Total),
+			WeeklyHours:   hours(series.Weekly),
+			Next:          series.Next,
+		})
+	}
+	return data
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// seriesAPI lists instances of a readable series and of one that can't
+// be read, counting the lookups of series.
+type seriesAPI struct {
+	gets atomic.Int32
+}
+
+func (api *seriesAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/events/weekly"):
+		api.gets.Add(1)
+		w.Write([]byte(`{"id":"weekly","summary":"Weekly","recurrence":["RRULE:FREQ=WEEKLY;BYDAY=MO"],
+			"start":{"dateTime":"2024-12-02T09:00:00Z"},"end":{"dateTime":"2024-12-02T09:30:00Z"}}`))
+	case strings.Contains(r.URL.Path, "/events/"):
+		api.gets.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":404,"message":"Not Found"}}`))
+	default:
+		w.Write([]byte(`{"items":[
+			{"id":"weekly_20241223T090000Z","recurringEventId":"weekly","summary":"Weekly",
+			 "start":{"dateTime":"2024-12-23T09:00:00Z"},"end":{"dateTime":"2024-12-23T09:30:00Z"}},
+			{"id":"hidden_20241223T100000Z","recurringEventId":"hidden","summary":"Shared instance",
+			 "start":{"dateTime":"2024-12-23T10:00:00Z"},"end":{"dateTime":"2024-12-23T11:00:00Z"}}]}`))
+	}
+}
+
+func TestSeriesLookupsAreCached(t *testing.T) {
+	api := &seriesAPI{}
+	cs := newFakeService(t, api)
+	start := time.Date(2024, 12, 23, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		events, err := cs.fetchEvents(context.Background(), start, start.AddDate(0, 0, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 || events[0].RecurrenceText == "" || events[1].RecurrenceText != "" {
+			t.Fatalf("events: %+v", events)
+		}
+	}
+	// One lookup each, whether the series could be read or not
+	if gets := api.gets.Load(); gets != 2 {
+		t.Errorf("looked up series %d times, want 2", gets)
+	}
+}
+
+func TestSeriesLookupsAreBounded(t *testing.T) {
+	cs := newFakeService(t, &seriesAPI{})
+	for i := 0; i < maxSeries+10; i++ {
+		cs.rememberSeries(fmt.Sprintf("primary/series%d", i), recurringSeries{fetchedAt: time.Now()})
+	}
+	cs.rememberSeries("primary/new", recurringSeries{fetchedAt: time.Now()})
+	if len(cs.series) > maxSeries {
+		t.Errorf("%d series kept, want at most %d", len(cs.series), maxSeries)
+	}
+	if _, ok := cs.series["primary/new"]; !ok {
+		t.Error("latest series not kept")
+	}
+}
+
+func TestCancelledSeriesLookupIsNotCached(t *testing.T) {
+	api := &seriesAPI{}
+	cs := newFakeService(t, api)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, ok := cs.recurringSeries(ctx, "primary", "weekly"); ok {
+		t.Fatal("series read with a cancelled context")
+	}
+	if series, ok := cs.recurringSeries(context.Background(), "primary", "weekly"); !ok || series.Summary != "Weekly" {
+		t.Errorf("series after a cancelled lookup: %+v, %v", series, ok)
+	}
+}
+
+func TestRecurringReportFormats(t *testing.T) {
+	cfg := testConfig("09:00", "18:00")
+	report := &recurringReport{
+		Start: clockAt(2, "00:00"),
+		End:   clockAt(30, "00:00"),
+		Weeks: 4,
+		Series: []seriesCost{{
+			Summary: "Standup", RecurrenceText: "every weekday", Category: "Meetings", Attendees: 5,
+			Occurrences: 20, Total: 5 * time.Hour, Weekly: 75 * time.Minute, Next: clockAt(2, "09:00"),
+		}},
+	}
+	text, err := formatRecurringReport(report, "", cfg)
+	if err != nil || !strings.Contains(text, "1h 15m a week (20 × 15m)") {
+		t.Errorf("series as text = %q, %v", text, err)
+	}
+	markdown, err := formatRecurringReport(report, formatMarkdown, cfg)
+	if err != nil || !strings.HasPrefix(markdown, "# ") || !strings.Contains(markdown, "## Standup") {
+		t.Errorf("series as markdown = %q, %v", markdown, err)
+	}
+	if _, err := formatRecurringReport(report, "csv", cfg); err == nil {
+		t.Error("series accepted an unsupported format")
+	}
+
+	out, err := formatRecurringReport(report, formatJSON, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data recurringReportJSONData
+	if err := json.Unmarshal([]byte(out), &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.From != "2024-12-02" || data.WeeklyHours != 1.25 || len(data.Series) != 1 || data.Series[0].Occurrences != 20 {
+		t.Errorf("series as JSON = %+v", data)
+	}
+}
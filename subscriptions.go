@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Limits on subscriptions. Subscriptions of a session that went away are
+// kept for a while, since streamable HTTP clients reconnect with the same
+// session ID.
+const (
+	minPollInterval            = 10 * time.Second
+	maxSubscriptionsPerSession = 50
+	maxSubscriptions           = 1000
+	subscriptionTTL            = 10 * time.Minute
+)
+
+type subscriptionKey struct {
+	sessionID string
+	uri       string
+}
+
+// subscription is a client's interest in one resource. It remembers what
+// the client last saw so only real changes are notified.
+type subscription struct {
+	ctx          context.Context
+	digest       [sha256.Size]byte
+	known        map[string]bool
+	window       time.Time
+	stale        bool
+	disconnected time.Time
+}
+
+// subscriptionManager implements resources/subscribe. It polls Google at
+// a fixed interval and sends notifications/resources/updated when the
+// contents of a subscribed resource changed.
+type subscriptionManager struct {
+	s        *server.MCPServer
+	provider calendarProvider
+	interval time.Duration
+
+	mu       sync.Mutex
+	subs     map[subscriptionKey]*subscription
+	watchers map[*CalendarService]*calendarWatcher
+	sessions map[string]bool
+}
+
+// newSubscriptionManager returns a manager for provider's calendars. Its
+// server is set once the MCP server, which needs the manager's hooks, is
+// created.
+func newSubscriptionManager(provider calendarProvider, interval time.Duration) *subscriptionManager {
+	return &subscriptionManager{
+		provider: provider,
+		interval: interval,
+		subs:     make(map[subscriptionKey]*subscription),
+		watchers: make(map[*CalendarService]*calendarWatcher),
+		sessions: make(map[string]bool),
+	}
+}
+
+// addHooks tracks session lifetimes so abandoned subscriptions expire.
+func (sm *subscriptionManager) addHooks(hooks *server.Hooks) {
+	hooks.AddOnRegisterSession(func(ctx context.Context, session server.ClientSession) {
+		sm.setDisconnected(session.SessionID(), time.Time{})
+	})
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		sm.setDisconnected(session.SessionID(), time.Now())
+	})
+}
+
+func (sm *subscriptionManager) setDisconnected(sessionID string, at time.Time) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if at.IsZero() {
+		sm.sessions[sessionID] = true
+	} else {
+		delete(sm.sessions, sessionID)
+	}
+	for key, sub := range sm.subs {
+		if key.sessionID == sessionID {
+			sub.disconnected = at
+		}
+	}
+}
+
+// subscribe starts watching uri for the session. The resource is read
+// once to check access and to record what the client currently sees.
+func (sm *subscriptionManager) subscribe(ctx context.Context, sessionID, uri string) error {
+	if sessionID == "" {
+		return errors.New("subscriptions require a session")
+	}
+	cs, err := sm.provider.calendarFor(ctx)
+	if err != nil {
+		return err
+	}
+	resource, err := parseAgendaURI(cs, uri)
+	if err != nil {
+		return err
+	}
+
+	sub := &subscription{ctx: context.WithoutCancel(ctx), window: resource.start}
+	if !sm.connected(sessionID) {
+		// Streamable HTTP clients may subscribe before opening their
+		// notification stream
+		sub.disconnected = time.Now()
+	}
+	digest, known, err := sm.read(ctx, cs, resource)
+	if err != nil {
+		return err
+	}
+	sub.digest, sub.known = digest, known
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	count := 0
+	for key := range sm.subs {
+		if key.sessionID == sessionID {
+			count++
+		}
+	}
+	key := subscriptionKey{sessionID, uri}
+	if _, exists := sm.subs[key]; !exists {
+		if count >= maxSubscriptionsPerSession {
+			return fmt.Errorf("too many subscriptions (at most %d per session)", maxSubscriptionsPerSession)
+		}
+		if len(sm.subs) >= maxSubscriptions {
+			return errors.New("too many subscriptions on this server")
+		}
+	}
+	sm.subs[key] = sub
+	return nil
+}
+
+// connected reports whether a session is currently connected.
+func (sm *subscriptionManager) connected(sessionID string) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.sessions[sessionID]
+}
+
+func (sm *subscriptionManager) unsubscribe(sessionID, uri string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	delete(sm.subs, subscriptionKey{sessionID, uri})
+}
+
+// read reads the resource and returns the digest of its contents and the
+// IDs of its events. It calls Google, so it must not run under sm.mu.
+func (sm *subscriptionManager) read(ctx context.Context, cs *CalendarService, resource agendaResource) (digest [sha256.Size]byte, known map[string]bool, err error) {
+	contents, events, err := cs.readAgendaResource(ctx, resource)
+	if errors.Is(err, errEventNotFound) {
+		// A deleted event is a change too
+		contents, events = nil, nil
+	} else if err != nil {
+		return digest, nil, err
+	}
+
+	hash := sha256.New()
+	for _, content := range contents {
+		if text, ok := content.(mcp.TextResourceContents); ok && text.MIMEType == mimeJSON {
+			hash.Write([]byte(text.Text))
+		}
+	}
+	hash.Sum(digest[:0])
+
+	known = make(map[string]bool, len(events))
+	for _, event := range events {
+		known[event.ID] = true
+	}
+	return digest, known, nil
+}
+
+// run polls until ctx is done.
+func (sm *subscriptionManager) run(ctx context.Context) {
+	ticker := time.NewTicker(sm.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sm.poll(ctx)
+		}
+	}
+}
+
+// poll syncs the calendars of every subscriber and notifies the
+// subscriptions whose resource changed.
+func (sm *subscriptionManager) poll(ctx context.Context) {
+	sm.mu.Lock()
+	subs := make(map[subscriptionKey]*subscription, len(sm.subs))
+	for key, sub := range sm.subs {
+		if !sub.disconnected.IsZero() && time.Since(sub.disconnected) > subscriptionTTL {
+			delete(sm.subs, key)
+			continue
+		}
+		subs[key] = sub
+	}
+	sm.mu.Unlock()
+
+	// Group subscriptions by the calendar service of their user
+	byService := make(map[*CalendarService][]subscriptionKey)
+	for key, sub := range subs {
+		cs, err := sm.provider.calendarFor(sub.ctx)
+		if err != nil {
+			continue
+		}
+		byService[cs] = append(byService[cs], key)
+	}
+
+	sm.mu.Lock()
+	for cs := range sm.watchers {
+		if _, used := byService[cs]; !used {
+			delete(sm.watchers, cs)
+		}
+	}
+	sm.mu.Unlock()
+
+	for cs, keys := range byService {
+		if ctx.Err() != nil {
+			return
+		}
+		sm.mu.Lock()
+		watcher, ok := sm.watchers[cs]
+		if !ok {
+			watcher = newCalendarWatcher(cs)
+			sm.watchers[cs] = watcher
+		}
+		sm.mu.Unlock()
+
+		changed, full, err := watcher.changes(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Subscription poll failed: %v\n", err)
+			continue
+		}
+
+		for _, key := range keys {
+			sub := subs[key]
+			resource, err := parseAgendaURI(cs, key.uri)
+			if err != nil {
+				continue
+			}
+
+			sm.mu.Lock()
+			check := full || sub.stale || !resource.start.Equal(sub.window)
+			known := sub.known
+			sm.mu.Unlock()
+			for _, item := range changed {
+				if check {
+					break
+				}
+				check = watcher.affects(resource, known, item)
+			}
+			if !check {
+				continue
+			}
+
+			digest, known, err := sm.read(ctx, cs, resource)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to refresh %s: %v\n", key.uri, err)
+				continue
+			}
+			sm.mu.Lock()
+			notify := digest != sub.digest || sub.stale
+			sub.digest, sub.known, sub.window = digest, known, resource.start
+			sm.mu.Unlock()
+			if !notify {
+				continue
+			}
+
+			err = sm.s.SendNotificationToSpecificClient(key.sessionID, mcp.MethodNotificationResourceUpdated, map[string]any{"uri": key.uri})
+			sm.mu.Lock()
+			// Retry on the next poll if the client couldn't be reached
+			sub.stale = err != nil
+			sm.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// templateData is what agenda templates are executed with. The fields
+// are documented in the README, so keep them in sync.
+type templateData struct {
+	// Day is the first day of the agenda and End the day after the last
+	Day, End time.Time
+	Timezone string
+	// Offline is set when Google was unreachable, with the time the
+	// events were fetched as AsOf
+	Offline    bool
+	AsOf       time.Time
+	Events     []templateEvent
+	Categories []templateCategory
+	Stats      templateStats
+}
+
+// templateEvent is an event with the values templates need most.
+type templateEvent struct {
+	CalendarEvent
+	URI      string
+	Duration time.Duration
+	JoinLink string
+}
+
+// templateCategory is a category with the events of the agenda in it.
+type templateCategory struct {
+	Name  string
+	Emoji string
+	Count int
+	Time  time.Duration
+}
+
+// templateStats summarises the agenda. Working locations are left out.
+type templateStats struct {
+	Events   int
+	Meetings int
+	AllDay   int
+	// BusyTime is the time covered by timed events, counting overlaps once
+	BusyTime   time.Duration
+	FirstStart time.Time
+	LastEnd    time.Time
+}
+
+// templateFormatter renders the agenda with a user-supplied text/template.
+type templateFormatter struct {
+	cfg  *Config
+	tmpl *template.Template
+}
+
+// newTemplateFormatter parses a template. Errors include the line of the
+// problem.
+func newTemplateFormatter(name, text string, cfg *Config) (*templateFormatter, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs(cfg)).Parse(text)
+	if err == nil {
+		err = checkLoops(tmpl)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+	return &templateFormatter{cfg: cfg, tmpl: tmpl}, nil
+}
+
+// checkLoops rejects loops over numbers, such as {{range 1000000000}}, so
+// that templates only loop over the lists of the agenda.
+func checkLoops(tmpl *template.Template) error {
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil {
+			continue
+		}
+		if err := checkLoopNode(t.Tree, t.Tree.Root, make(map[string]bool), false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkLoopNode checks the loops under node. numbers holds the variables
+// set from numbers, and numberDot is set when dot may be one.
+func checkLoopNode(tree *parse.Tree, node parse.Node, numbers map[string]bool, numberDot bool) error {
+	var pipe *parse.PipeNode
+	var lists []*parse.ListNode
+	listDot := numberDot
+	switch n := node.(type) {
+	case *parse.ListNode:
+		lists = append(lists, n)
+	case *parse.ActionNode:
+		pipe = n.Pipe
+	case *parse.IfNode:
+		pipe, lists = n.Pipe, []*parse.ListNode{n.List, n.ElseList}
+	case *parse.WithNode:
+		pipe, lists = n.Pipe, []*parse.ListNode{n.List, n.ElseList}
+		listDot = hasNumber(n.Pipe, numbers, numberDot)
+	case *parse.RangeNode:
+		pipe, lists = n.Pipe, []*parse.ListNode{n.List, n.ElseList}
+		if hasNumber(n.Pipe, numbers, numberDot) {
+			location, _ := tree.ErrorContext(n)
+			return fmt.Errorf("%s: range over a number; only the lists of the agenda can be ranged over", location)
+		}
+		listDot = false
+	case *parse.TemplateNode:
+		if n.Pipe != nil && hasNumber(n.Pipe, numbers, numberDot) {
+			location, _ := tree.ErrorContext(n)
+			return fmt.Errorf("%s: template called with a number", location)
+		}
+	}
+	if pipe != nil && hasNumber(pipe, numbers, numberDot) {
+		for _, variable := range pipe.Decl {
+			numbers[variable.Ident[0]] = true
+		}
+	}
+	for i, list := range lists {
+		if list == nil {
+			continue
+		}
+		dot := listDot
+		if i > 0 {
+			// Else branches keep the outer dot
+			dot = numberDot
+		}
+		for _, child := range list.Nodes {
+			if err := checkLoopNode(tree, child, numbers, dot); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasNumber reports whether a pipeline uses a number literal, a variable
+// set from one, or dot when it may be one.
+func hasNumber(pipe *parse.PipeNode, numbers map[string]bool, numberDot bool) bool {
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			switch a := arg.(type) {
+			case *parse.NumberNode:
+				return true
+			case *parse.DotNode:
+				if numberDot {
+					return true
+				}
+			case *parse.VariableNode:
+				if numbers[a.Ident[0]] {
+					return true
+				}
+			case *parse.PipeNode:
+				if hasNumber(a, numbers, numberDot) {
+					return true
+				}
+			case *parse.ChainNode:
+				if p, ok := a.Node.(*parse.PipeNode); ok && hasNumber(p, numbers, numberDot) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// loadTemplateFormatter parses the template file at path.
+func loadTemplateFormatter(path string, cfg *Config) (*templateFormatter, error) {
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read template: %v", err)
+	}
+	return newTemplateFormatter(path, string(data), cfg)
+}
+
+// Limits on executing templates. A running template can't be
+// interrupted: one past its deadline fails on its next write, and one
+// that writes nothing keeps its slot until it ends, so at most
+// maxRunningTemplates run at once. Its loops are bounded by the agenda,
+// and only the local user may send one over MCP.
+const (
+	maxTemplateOutput   = 1 << 20
+	maxRunningTemplates = 4
+)
+
+var templateTimeout = 5 * time.Second
+
+var runningTemplates = make(chan struct{}, maxRunningTemplates)
+
+var (
+	errTemplateOutput  = fmt.Errorf("output exceeds %d bytes", maxTemplateOutput)
+	errTemplateTimeout = errors.New("took too long")
+)
+
+// limitedWriter collects template output up to a size and a deadline.
+type limitedWriter struct {
+	buf      bytes.Buffer
+	deadline time.Time
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.buf.Len()+len(p) > maxTemplateOutput {
+		return 0, errTemplateOutput
+	}
+	if time.Now().After(w.deadline) {
+		return 0, errTemplateTimeout
+	}
+	return w.buf.Write(p)
+}
+
+func (f *templateFormatter) format(agenda agendaView) (string, error) {
+	select {
+	case runningTemplates <- struct{}{}:
+	default:
+		return "", errors.New("template failed: too many templates running, try again later")
+	}
+	data := newTemplateData(agenda, f.cfg)
+	output := &limitedWriter{deadline: time.Now().Add(templateTimeout)}
+	done := make(chan error, 1)
+	go func() {
+		defer func() { <-runningTemplates }()
+		done <- f.tmpl.Execute(output, data)
+	}()
+
+	timer := time.NewTimer(templateTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			return "", fmt.Errorf("template failed: %v", err)
+		}
+		return output.buf.String(), nil
+	case <-timer.C:
+		return "", fmt.Errorf("template failed: %v (limit %s)", errTemplateTimeout, templateTimeout)
+	}
+}
+
+func newTemplateData(agenda agendaView, cfg *Config) templateData {
+	data := templateData{
+		Day:      agenda.Start,
+		End:      agenda.End,
+		Timezone: cfg.location.String(),
+		Offline:  !agenda.AsOf.IsZero(),
+		AsOf:     agenda.AsOf,
+	}
+
+	categories := make(map[string]*templateCategory)
+	var busy []CalendarEvent
+	for _, event := range agenda.Events {
+		duration := event.End.Sub(event.Start)
+		data.Events = append(data.Events, templateEvent{
+			CalendarEvent: event,
+			URI:           eventURI(event),
+			Duration:      duration,
+			JoinLink:      joinLink(event),
+		})
+		if event.EventType == "workingLocation" {
+			continue
+		}
+
+		category, ok := categories[event.Category]
+		if !ok {
+			category = &templateCategory{Name: event.Category, Emoji: event.CategoryEmoji}
+			categories[event.Category] = category
+		}
+		category.Count++
+		if !event.IsAllDay {
+			category.Time += duration
+		}
+
+		data.Stats.Events++
+		if event.IsAllDay {
+			data.Stats.AllDay++
+			continue
+		}
+		if event.attendeeCount() > 1 {
+			data.Stats.Meetings++
+		}
+		if data.Stats.FirstStart.IsZero() || event.Start.Before(data.Stats.FirstStart) {
+			data.Stats.FirstStart = event.Start
+		}
+		if event.End.After(data.Stats.LastEnd) {
+			data.Stats.LastEnd = event.End
+		}
+		busy = append(busy, event)
+	}
+	data.Stats.BusyTime = busyTime(busy)
+
+	for _, category := range categories {
+		data.Categories = append(data.Categories, *category)
+	}
+	sort.Slice(data.Categories, func(i, j int) bool {
+		if data.Categories[i].Count != data.Categories[j].Count {
+			return data.Categories[i].Count > data.Categories[j].Count
+		}
+		return data.Categories[i].Name < data.Categories[j].Name
+	})
+	return data
+}
+
+// busyTime returns the time covered by events, counting overlaps once.
+func busyTime(events []CalendarEvent) time.Duration {
+	sorted := append([]CalendarEvent(nil), events...)
+	sortEvents(sorted)
+	var total time.Duration
+	var end time.Time
+	for _, event := range sorted {
+		start := event.Start
+		if start.Before(end) {
+			start = end
+		}
+		if event.End.After(start) {
+			total += event.End.Sub(start)
+			end = event.End
+		}
+	}
+	return total
+}
+
+// templateFuncs are the helper functions available to templates.
+func templateFuncs(cfg *Config) template.FuncMap {
+	return template.FuncMap{
+		"duration": func(value any) (string, error) {
+			switch v := value.(type) {
+			case time.Duration:
+				return formatDuration(v), nil
+			case templateEvent:
+				return formatDuration(v.Duration), nil
+			}
+			return "", fmt.Errorf("duration takes a duration or an event, got %T", value)
+		},
+		"relative": func(t time.Time) string {
+			return relativeTime(t, time.Now())
+		},
+		"time": func(t time.Time) string {
+			return t.In(cfg.location).Format(cfg.Formatting.TimeFormat)
+		},
+		"date": func(layout string, t time.Time) string {
+			return t.In(cfg.location).Format(layout)
+		},
+		"truncate": func(limit int, text string) string {
+			return truncateText(text, limit)
+		},
+		"joinLink": func(event templateEvent) string {
+			return event.JoinLink
+		},
+		"join":  strings.Join,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}
+}
+
+// formatDuration renders a duration as hours and minutes, e.g. "1h 30m".
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("%dh", hours)
+	}
+	return fmt.Sprintf("%dh %dm", hours, minutes)
+}
+
+// relativeTime describes t relative to now, e.g. "in 2h 15m" or "3d ago".
+func relativeTime(t, now time.Time) string {
+	d := t.Sub(now).Round(time.Minute)
+	if d == 0 {
+		return "now"
+	}
+	past := d < 0
+	if past {
+		d = -d
+	}
+	text := formatDuration(d)
+	if d >= 48*time.Hour {
+		text = fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+	if past {
+		return text + " ago"
+	}
+	return "in " + text
+}
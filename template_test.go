@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nestedLoops loops over the events depth times, with body innermost and
+// after outermost.
+func nestedLoops(depth int, body, after string) string {
+	return "{{range .Events}}" + strings.Repeat("{{range $.Events}}", depth-1) + body +
+		strings.Repeat("{{end}}", depth-1) + after + "{{end}}"
+}
+
+func TestTemplateLimits(t *testing.T) {
+	agenda, cfg := goldenAgenda(t)
+	defer func(timeout time.Duration) { templateTimeout = timeout }(templateTimeout)
+
+	// The golden agenda has 4 events, so loops run 4^depth times
+	tests := []struct {
+		name, text string
+		timeout    time.Duration
+		err        error
+	}{
+		{"huge output", nestedLoops(10, "xx", ""), 10 * time.Second, errTemplateOutput},
+		{"slow output", nestedLoops(11, "", "."), 20 * time.Millisecond, errTemplateTimeout},
+		{"silent loop", nestedLoops(11, "", ""), 20 * time.Millisecond, errTemplateTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templateTimeout = tt.timeout
+			formatter, err := newTemplateFormatter("limits", tt.text, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			_, err = formatter.format(agenda)
+			if err == nil || !strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+			if elapsed := time.Since(start); elapsed > tt.timeout+time.Second {
+				t.Errorf("returned after %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestTemplateLoopsOverNumbers(t *testing.T) {
+	_, cfg := goldenAgenda(t)
+	tests := []struct {
+		text string
+		ok   bool
+	}{
+		{`{{range 9223372036854775807}}{{end}}`, false},
+		{`{{range (9223372036854775807)}}{{end}}`, false},
+		{`{{$n := 1000000}}{{range $n}}{{end}}`, false},
+		{`{{$n := 0}}{{$n = 1000000}}{{range $n}}{{end}}`, false},
+		{`{{with 1000000}}{{range .}}{{end}}{{end}}`, false},
+		{`{{if .Events}}{{range 5}}{{end}}{{end}}`, false},
+		{`{{define "loop"}}{{range .}}{{end}}{{end}}{{template "loop" 1000000}}`, false},
+		{`{{define "loop"}}{{range 1000000}}{{end}}{{end}}`, false},
+		{`{{range .Events}}{{.Summary}}{{range .Attendees}}{{.Email}}{{end}}{{end}}`, true},
+		{`{{range $i, $event := .Events}}{{$i}} {{$event.Summary}}{{end}}`, true},
+		{`{{with .Events}}{{range .}}{{.Summary}}{{end}}{{end}}`, true},
+		{`{{with 5}}{{.}}{{else}}{{range .Events}}{{end}}{{end}}`, true},
+		{`{{truncate 10 "text"}}{{range .Categories}}{{.Name}}{{end}}`, true},
+	}
+	for _, tt := range tests {
+		_, err := newTemplateFormatter("loops", tt.text, cfg)
+		if (err == nil) != tt.ok {
+			t.Errorf("newTemplateFormatter(%q) = %v, want ok %v", tt.text, err, tt.ok)
+		}
+	}
+}
+
+func TestTemplatesOnlyOverStdio(t *testing.T) {
+	_, cfg := goldenAgenda(t)
+	args := toolArgs{"template": "{{len .Events}}"}
+	if _, err := formatterFromArgs(cfg, args); err != nil {
+		t.Fatalf("template over stdio: %v", err)
+	}
+	cfg.Server.Transport = transportHTTP
+	_, err := formatterFromArgs(cfg, args)
+	var te *toolError
+	if !errors.As(err, &te) || te.Argument != "template" {
+		t.Errorf("template over HTTP: %v, want an invalid template argument", err)
+	}
+}
+
+func TestTemplateSlotsAreLimited(t *testing.T) {
+	agenda, cfg := goldenAgenda(t)
+	for i := 0; i < maxRunningTemplates; i++ {
+		runningTemplates <- struct{}{}
+	}
+	defer func() {
+		for i := 0; i < maxRunningTemplates; i++ {
+			<-runningTemplates
+		}
+	}()
+	formatter, err := newTemplateFormatter("busy", `{{len .Events}}`, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := formatter.format(agenda); err == nil {
+		t.Error("template ran with every slot taken")
+	}
+}
+
+func TestTemplateOutput(t *testing.T) {
+	agenda, cfg := goldenAgenda(t)
+	formatter, err := newTemplateFormatter("short", `{{range .Events}}{{time .Start}} {{.Summary}}{{"\n"}}{{end}}{{duration .Stats.BusyTime}} busy`, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := formatter.format(agenda)
+	want := "09:00 Standup\n10:00 Deep work\n22:00 Release night\n00:00 Holiday\n6h 15m busy"
+	if err != nil || got != want {
+		t.Errorf("got %q, %v, want %q", got, err, want)
+	}
+}
@@ -0,0 +1,711 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"golang.org/x/oauth2"
+)
+
+// MultiTenantConfig lets one HTTP server act for several users. Each
+// authenticated caller connects their own Google account and tool calls
+// only ever use the caller's token.
+type MultiTenantConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	UsersDir  string `yaml:"users_dir,omitempty"`
+	PublicURL string `yaml:"public_url,omitempty"`
+}
+
+// Onboarding endpoints, relative to public_url. The callback URL must be
+// an authorized redirect URI of the Google OAuth client.
+const (
+	onboardingStartPath    = "/oauth/google/start"
+	onboardingCallbackPath = "/oauth/google/callback"
+)
+
+// ticketTTL bounds how long an onboarding link, and the confirmation
+// code it ends with, stay valid.
+const ticketTTL = 15 * time.Minute
+
+// onboardingCookie ties the Google consent to the browser that opened the
+// onboarding link.
+const onboardingCookie = "agenda_onboarding"
+
+// maxCodeAttempts is how many wrong confirmation codes discard a grant.
+const maxCodeAttempts = 5
+
+func (mt MultiTenantConfig) validate(auth AuthServerConfig) []ruleProblem {
+	if !mt.Enabled {
+		return nil
+	}
+	var problems []ruleProblem
+	if u, err := url.Parse(mt.PublicURL); err != nil || u.Scheme == "" || u.Host == "" {
+		problems = append(problems, ruleProblem{"public_url", "multi_tenant.public_url must be the absolute URL clients reach the server at"})
+	}
+	if !auth.enabled() {
+		problems = append(problems, ruleProblem{"enabled", "multi_tenant requires server.auth tokens or oauth to identify users"})
+	}
+	return problems
+}
+
+// usersDir returns the directory holding the per-user tokens.
+func (mt MultiTenantConfig) usersDir() string {
+	if mt.UsersDir != "" {
+		return expandHome(mt.UsersDir)
+	}
+	return filepath.Join(filepath.Dir(defaultConfigPath()), "users")
+}
+
+// userStore keeps one token file per user, named after the base64url
+// encoding of the user's subject so any subject maps to a safe file name.
+type userStore struct {
+	dir string
+}
+
+// storedUser is a user with a Google token on disk.
+type storedUser struct {
+	Subject   string
+	Connected time.Time
+	Encrypted bool
+}
+
+func (us *userStore) path(subject string) string {
+	return filepath.Join(us.dir, base64.RawURLEncoding.EncodeToString([]byte(subject))+".json")
+}
+
+// tokenStore returns the token store of subject.
+func (us *userStore) tokenStore(subject string) (*tokenStore, error) {
+	return newTokenStore(us.path(subject))
+}
+
+// save stores the Google token of subject.
+func (us *userStore) save(subject string, token *oauth2.Token) error {
+	if err := os.MkdirAll(us.dir, 0700); err != nil {
+		return fmt.Errorf("unable to create users directory: %v", err)
+	}
+	store, err := us.tokenStore(subject)
+	if err != nil {
+		return err
+	}
+	return store.Save(token)
+}
+
+// list returns the users with a token, sorted by subject.
+func (us *userStore) list() ([]storedUser, error) {
+	entries, err := os.ReadDir(us.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var users []storedUser
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		subject, err := base64.RawURLEncoding.DecodeString(name)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		user := storedUser{Subject: string(subject), Connected: info.ModTime()}
+		if data, err := os.ReadFile(filepath.Join(us.dir, entry.Name())); err == nil {
+			_, user.Encrypted = parseEncryptedToken(data)
+		}
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Subject < users[j].Subject })
+	return users, nil
+}
+
+// remove deletes the token of subject.
+func (us *userStore) remove(subject string) error {
+	err := os.Remove(us.path(subject))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("no user %q in %s", subject, us.dir)
+	}
+	return err
+}
+
+// tenantProvider resolves the calendar of the authenticated caller. The
+// service is chosen from the caller's identity alone; nothing in a tool
+// call can select another user's token.
+type tenantProvider struct {
+	cfg       *Config
+	oauth     *oauth2.Config
+	users     *userStore
+	publicURL string
+	ticketKey []byte
+
+	mu       sync.Mutex
+	services map[string]*CalendarService
+	// generations counts the token changes of each user, so that a
+	// service built from a replaced token isn't cached
+	generations map[string]int
+	sessions    map[string]string
+	// Google grants waiting for their user's confirmation code
+	pending map[string]*pendingGrant
+}
+
+// pendingGrant is a Google token obtained through an onboarding link. It
+// is only stored once the MCP user enters the code shown in the browser,
+// so a link sent to someone else doesn't give its sender their calendar.
+type pendingGrant struct {
+	token    *oauth2.Token
+	code     string
+	expires  time.Time
+	attempts int
+}
+
+// errUnauthenticated is returned for requests without an authenticated
+// user.
+var errUnauthenticated = errors.New("unauthenticated: this server requires an authenticated user")
+
+// notConnectedError is returned for callers who haven't connected a Google
+// account yet.
+type notConnectedError struct {
+	link string
+}
+
+func (e *notConnectedError) Error() string {
+	return fmt.Sprintf("no Google Calendar is connected for this user. Open %s to connect it, "+
+		"then call connect_google_calendar with the code shown at the end", e.link)
+}
+
+func newTenantProvider(cfg *Config) (*tenantProvider, error) {
+	config, err := oauthConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	publicURL := strings.TrimSuffix(cfg.Server.MultiTenant.PublicURL, "/")
+	config.RedirectURL = publicURL + onboardingCallbackPath
+
+	users := &userStore{dir: cfg.Server.MultiTenant.usersDir()}
+	key, err := users.ticketKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tenantProvider{
+		cfg:         cfg,
+		oauth:       config,
+		users:       users,
+		publicURL:   publicURL,
+		ticketKey:   key,
+		services:    make(map[string]*CalendarService),
+		generations: make(map[string]int),
+		sessions:    make(map[string]string),
+		pending:     make(map[string]*pendingGrant),
+	}, nil
+}
+
+// ticketKey returns the key signing onboarding links, created on first
+// use. It is kept next to the user tokens so links survive a restart.
+func (us *userStore) ticketKey() ([]byte, error) {
+	path := filepath.Join(us.dir, "ticket.key")
+	key, err := os.ReadFile(path)
+	if err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("unable to read onboarding key: %v", err)
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(us.dir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create users directory: %v", err)
+	}
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		return nil, fmt.Errorf("unable to save onboarding key: %v", err)
+	}
+	return key, nil
+}
+
+func (tp *tenantProvider) calendarFor(ctx context.Context) (*CalendarService, error) {
+	p := principalFromContext(ctx)
+	if p == nil || p.Subject == "" {
+		return nil, errUnauthenticated
+	}
+
+	store, err := tp.users.tokenStore(p.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	// A removed user loses access immediately, even with a cached service
+	if _, err := os.Stat(store.path); errors.Is(err, fs.ErrNotExist) {
+		tp.forget(p.Subject)
+		return nil, &notConnectedError{link: tp.onboardingLink(p.Subject)}
+	}
+	tp.mu.Lock()
+	cs, ok := tp.services[p.Subject]
+	generation := tp.generations[p.Subject]
+	tp.mu.Unlock()
+	if ok {
+		return cs, nil
+	}
+
+	tok, err := store.Load()
+	if err != nil {
+		var decryptErr *tokenDecryptError
+		if errors.As(err, &decryptErr) {
+			fmt.Fprintf(os.Stderr, "Token of user %q: %v\n", p.Subject, err)
+			return nil, errors.New("the stored Google token can't be decrypted; ask the server administrator")
+		}
+		return nil, fmt.Errorf("unable to load Google token: %v", err)
+	}
+
+	source := &savingTokenSource{
+		base:  tp.oauth.TokenSource(context.Background(), tok),
+		store: store,
+		last:  tok,
+	}
+	// Built without the lock, as it calls Google: a slow user must not
+	// hold up the others
+	cs, err = newCalendarService(oauth2.NewClient(context.Background(), source), tp.cfg, "user:"+p.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if existing, ok := tp.services[p.Subject]; ok {
+		return existing, nil
+	}
+	if tp.generations[p.Subject] == generation {
+		tp.services[p.Subject] = cs
+	}
+	return cs, nil
+}
+
+// forget drops the cached service of subject, whose token changed.
+func (tp *tenantProvider) forget(subject string) {
+	tp.mu.Lock()
+	delete(tp.services, subject)
+	tp.generations[subject]++
+	tp.mu.Unlock()
+}
+
+// savingTokenSource persists refreshed tokens so a rotated refresh token
+// isn't lost when the server restarts.
+type savingTokenSource struct {
+	base  oauth2.TokenSource
+	store *tokenStore
+
+	mu   sync.Mutex
+	last *oauth2.Token
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last == nil || tok.AccessToken != s.last.AccessToken {
+		if err := s.store.Save(tok); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to save refreshed token: %v\n", err)
+		}
+		s.last = tok
+	}
+	return tok, nil
+}
+
+// onboardingTicket is the signed payload of an onboarding link. It binds
+// the Google account being connected to the MCP user who asked for it.
+// Passed to Google as the OAuth state, it also holds the hash of the
+// browser's onboarding cookie.
+type onboardingTicket struct {
+	Subject string `json:"sub"`
+	Expires int64  `json:"exp"`
+	Browser string `json:"brw,omitempty"`
+}
+
+func (tp *tenantProvider) signTicket(t onboardingTicket) string {
+	payload, _ := json.Marshal(t)
+	mac := hmac.New(sha256.New, tp.ticketKey)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyTicket returns a valid, unexpired ticket.
+func (tp *tenantProvider) verifyTicket(ticket string) (onboardingTicket, error) {
+	encoded, signature, found := strings.Cut(ticket, ".")
+	if !found {
+		return onboardingTicket{}, errors.New("malformed link")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return onboardingTicket{}, errors.New("malformed link")
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return onboardingTicket{}, errors.New("malformed link")
+	}
+	mac := hmac.New(sha256.New, tp.ticketKey)
+	mac.Write(payload)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return onboardingTicket{}, errors.New("invalid link")
+	}
+
+	var t onboardingTicket
+	if err := json.Unmarshal(payload, &t); err != nil || t.Subject == "" {
+		return onboardingTicket{}, errors.New("invalid link")
+	}
+	if time.Now().After(time.Unix(t.Expires, 0)) {
+		return onboardingTicket{}, errors.New("this link has expired, ask your MCP client for a new one")
+	}
+	return t, nil
+}
+
+// onboardingLink returns the link subject opens to connect their Google account.
+func (tp *tenantProvider) onboardingLink(subject string) string {
+	ticket := tp.signTicket(onboardingTicket{Subject: subject, Expires: time.Now().Add(ticketTTL).Unix()})
+	return tp.publicURL + onboardingStartPath + "?ticket=" + url.QueryEscape(ticket)
+}
+
+// browserHash is the value of the onboarding cookie kept in the OAuth state.
+func browserHash(cookie string) string {
+	sum := sha256.Sum256([]byte(cookie))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// onboardingCookiePath scopes the onboarding cookie to its endpoints.
+func (tp *tenantProvider) onboardingCookiePath() string {
+	u, err := url.Parse(tp.publicURL)
+	if err != nil {
+		return "/"
+	}
+	return strings.TrimSuffix(u.Path, "/") + strings.TrimSuffix(onboardingStartPath, "/start")
+}
+
+// randomString returns n random bytes, base64url encoded.
+func randomString(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// confirmationAlphabet leaves out letters and digits that look alike.
+const confirmationAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newConfirmationCode returns a code like "K7QF-M2XW".
+func newConfirmationCode() (string, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, 9)
+	for i, b := range raw {
+		if i == 4 {
+			code = append(code, '-')
+		}
+		code = append(code, confirmationAlphabet[int(b)%len(confirmationAlphabet)])
+	}
+	return string(code), nil
+}
+
+// normalizeCode makes codes comparable whatever their case and spacing.
+func normalizeCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
+
+// holdGrant keeps the token of subject until its code is confirmed, and
+// returns the code.
+func (tp *tenantProvider) holdGrant(subject string, token *oauth2.Token) (string, error) {
+	code, err := newConfirmationCode()
+	if err != nil {
+		return "", err
+	}
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	for other, grant := range tp.pending {
+		if time.Now().After(grant.expires) {
+			delete(tp.pending, other)
+		}
+	}
+	tp.pending[subject] = &pendingGrant{token: token, code: code, expires: time.Now().Add(ticketTTL)}
+	return code, nil
+}
+
+// confirmGrant stores the pending token of subject if code is the one its
+// browser was shown.
+func (tp *tenantProvider) confirmGrant(subject, code string) error {
+	tp.mu.Lock()
+	grant, ok := tp.pending[subject]
+	if ok && time.Now().After(grant.expires) {
+		delete(tp.pending, subject)
+		ok = false
+	}
+	if !ok {
+		tp.mu.Unlock()
+		return errors.New("no Google account is waiting to be connected; open a new link first")
+	}
+	if subtle.ConstantTimeCompare([]byte(normalizeCode(code)), []byte(normalizeCode(grant.code))) != 1 {
+		grant.attempts++
+		if grant.attempts >= maxCodeAttempts {
+			delete(tp.pending, subject)
+		}
+		tp.mu.Unlock()
+		return errors.New("wrong confirmation code")
+	}
+	delete(tp.pending, subject)
+	tp.mu.Unlock()
+
+	if err := tp.users.save(subject, grant.token); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to save token of user %q: %v\n", subject, err)
+		return errors.New("unable to save the token")
+	}
+	// Drop the cached service so the new token is used from now on
+	tp.forget(subject)
+	fmt.Fprintf(os.Stderr, "👤 User %q connected a Google account\n", subject)
+	return nil
+}
+
+var onboardingPage = template.Must(template.New("onboarding").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Google Calendar agenda</title></head>
+<body style="font-family: sans-serif; max-width: 40em; margin: 4em auto">
+{{if .Error}}<h1>❌ {{.Error}}</h1>
+{{else if .Code}}<h1>🔑 One more step</h1>
+<p>To finish connecting this Google account for the MCP user <b>{{.Subject}}</b>, give this code to your MCP client:</p>
+<p style="font-size: 2em; font-family: monospace">{{.Code}}</p>
+<p>It expires in 15 minutes. Don't give it to anyone else: whoever enters it can read this calendar.</p>
+{{else}}<h1>📅 Connect Google Calendar</h1>
+<p>This gives the MCP user <b>{{.Subject}}</b> read-only access to your Google Calendar.</p>
+<p>Only continue if you asked for this link yourself.</p>
+<p><a href="{{.AuthURL}}">Continue with Google</a></p>
+{{end}}</body></html>
+`))
+
+type onboardingView struct {
+	Subject string
+	AuthURL string
+	Code    string
+	Error   string
+}
+
+func (tp *tenantProvider) renderOnboarding(w http.ResponseWriter, status int, view onboardingView) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(status)
+	onboardingPage.Execute(w, view)
+}
+
+// register adds the onboarding endpoints to mux. They are authenticated by
+// the signed ticket rather than a bearer token, since they are opened in a
+// browser.
+func (tp *tenantProvider) register(mux *http.ServeMux) {
+	mux.HandleFunc(onboardingStartPath, func(w http.ResponseWriter, r *http.Request) {
+		ticket, err := tp.verifyTicket(r.URL.Query().Get("ticket"))
+		if err != nil {
+			tp.renderOnboarding(w, http.StatusBadRequest, onboardingView{Error: err.Error()})
+			return
+		}
+		browser, err := randomString(32)
+		if err != nil {
+			tp.renderOnboarding(w, http.StatusInternalServerError, onboardingView{Error: "Unable to start the connection"})
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     onboardingCookie,
+			Value:    browser,
+			Path:     tp.onboardingCookiePath(),
+			MaxAge:   int(ticketTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   strings.HasPrefix(tp.publicURL, "https://"),
+			SameSite: http.SameSiteLaxMode,
+		})
+		ticket.Browser = browserHash(browser)
+		// Force the consent screen so Google always returns a refresh token
+		authURL := tp.oauth.AuthCodeURL(tp.signTicket(ticket), oauth2.AccessTypeOffline, oauth2.SetAuthURLParam("prompt", "consent"))
+		tp.renderOnboarding(w, http.StatusOK, onboardingView{Subject: ticket.Subject, AuthURL: authURL})
+	})
+
+	mux.HandleFunc(onboardingCallbackPath, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		ticket, err := tp.verifyTicket(query.Get("state"))
+		if err != nil {
+			tp.renderOnboarding(w, http.StatusBadRequest, onboardingView{Error: err.Error()})
+			return
+		}
+		// Only the browser that opened the link may complete it
+		cookie, err := r.Cookie(onboardingCookie)
+		if err != nil || ticket.Browser == "" ||
+			subtle.ConstantTimeCompare([]byte(browserHash(cookie.Value)), []byte(ticket.Browser)) != 1 {
+			tp.renderOnboarding(w, http.StatusBadRequest, onboardingView{Error: "This browser didn't open the link; open it again from your MCP client"})
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: onboardingCookie, Path: tp.onboardingCookiePath(), MaxAge: -1})
+		subject := ticket.Subject
+		if reason := query.Get("error"); reason != "" {
+			tp.renderOnboarding(w, http.StatusBadRequest, onboardingView{Error: "Authorization was not granted: " + reason})
+			return
+		}
+
+		tok, err := tp.oauth.Exchange(r.Context(), query.Get("code"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Token exchange for user %q failed: %v\n", subject, err)
+			tp.renderOnboarding(w, http.StatusBadGateway, onboardingView{Error: "Unable to get a token from Google"})
+			return
+		}
+		code, err := tp.holdGrant(subject, tok)
+		if err != nil {
+			tp.renderOnboarding(w, http.StatusInternalServerError, onboardingView{Error: "Unable to create a confirmation code"})
+			return
+		}
+		tp.renderOnboarding(w, http.StatusOK, onboardingView{Subject: subject, Code: code})
+	})
+}
+
+// addHooks records which user opened each session so that requests from
+// another user can't be posted into it.
+func (tp *tenantProvider) addHooks(hooks *server.Hooks) {
+	hooks.AddOnRegisterSession(func(ctx context.Context, session server.ClientSession) {
+		if p := principalFromContext(ctx); p != nil {
+			tp.mu.Lock()
+			tp.sessions[session.SessionID()] = p.Subject
+			tp.mu.Unlock()
+		}
+	})
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		tp.mu.Lock()
+		delete(tp.sessions, session.SessionID())
+		tp.mu.Unlock()
+	})
+}
+
+// wrap rejects requests for a session opened by another user. It runs
+// after authentication, so the caller is in the request context.
+func (tp *tenantProvider) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.URL.Query().Get("sessionId")
+		if sessionID == "" {
+			sessionID = r.Header.Get("Mcp-Session-Id")
+		}
+		if sessionID != "" {
+			tp.mu.Lock()
+			owner, known := tp.sessions[sessionID]
+			tp.mu.Unlock()
+			p := principalFromContext(r.Context())
+			if known && (p == nil || p.Subject != owner) {
+				http.Error(w, "Session belongs to another user", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// addTools registers the tool users call to get their onboarding link and
+// confirm the connection.
+func (tp *tenantProvider) addTools(s *server.MCPServer) {
+	connectTool := mcp.NewTool("connect_google_calendar",
+		mcp.WithDescription("Connect (or reconnect) the user's Google Calendar to this server. "+
+			"Call it without a code when another tool fails with an unauthorized error, and ask the user to open the link. "+
+			"The page ends with a confirmation code: call the tool again with that code to finish."),
+		mcp.WithToolAnnotation(mcp.ToolAnnotation{
+			Title:           "Connect Google Calendar",
+			ReadOnlyHint:    mcp.ToBoolPtr(false),
+			DestructiveHint: mcp.ToBoolPtr(false),
+			// Every call signs a new link
+			IdempotentHint: mcp.ToBoolPtr(false),
+			OpenWorldHint:  mcp.ToBoolPtr(false),
+		}),
+		mcp.WithString("code",
+			mcp.Description("Confirmation code shown in the browser after connecting the Google account"),
+		),
+	)
+	addTool(s, connectTool, func(ctx context.Context, args toolArgs) (*mcp.CallToolResult, error) {
+		p := principalFromContext(ctx)
+		if p == nil || p.Subject == "" {
+			return nil, errUnauthenticated
+		}
+		if code := args.string("code"); code != "" {
+			if err := tp.confirmGrant(p.Subject, code); err != nil {
+				return nil, invalidArgument("code", "%v", err)
+			}
+			return mcp.NewToolResultText("✅ Google Calendar connected. The agenda tools now use this account."), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Open this link in a browser within %d minutes to connect your Google Calendar, "+
+			"then give me the confirmation code shown at the end:\n%s",
+			int(ticketTTL.Minutes()), tp.onboardingLink(p.Subject))), nil
+	})
+}
+
+// runUsersMode handles the "users" subcommands.
+func runUsersMode(cfg *Config, args []string) {
+	users := &userStore{dir: cfg.Server.MultiTenant.usersDir()}
+
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		list, err := users.list()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list users: %v\n", err)
+			os.Exit(1)
+		}
+		if len(list) == 0 {
+			fmt.Printf("No users have connected a Google account (%s)\n", users.dir)
+			return
+		}
+		fmt.Printf("👥 Users in %s\n", users.dir)
+		for _, user := range list {
+			storage := "plaintext"
+			if user.Encrypted {
+				storage = "encrypted"
+			}
+			fmt.Printf("  %-30s connected %s (%s)\n", user.Subject, user.Connected.Format("2006-01-02 15:04"), storage)
+		}
+	case len(args) == 2 && args[0] == "remove":
+		if err := users.remove(args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove user: %v\n", err)
+			os.Exit(1)
+		}
+		if cache := cfg.cache(); cache != nil {
+			if err := cache.clear("user:" + args[1]); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to clear the user's cached events: %v\n", err)
+			}
+		}
+		fmt.Printf("🗑️  Removed the Google token of %q\n", args[1])
+	default:
+		fmt.Println("Usage: agenda-mcp users list|remove <user>")
+		fmt.Println("  Manages the per-user Google tokens of a multi-tenant server.")
+		os.Exit(1)
+	}
+}
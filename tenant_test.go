@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// newTestTenantProvider returns a provider whose Google token endpoint is
+// a fake handing out the same token for any code.
+func newTestTenantProvider(t *testing.T) (*tenantProvider, *http.ServeMux) {
+	t.Helper()
+	google := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"victim-access","refresh_token":"victim-refresh","token_type":"Bearer","expires_in":3600}`))
+	}))
+	t.Cleanup(google.Close)
+
+	cfg := defaultConfig()
+	cfg.Google.ClientID = "client"
+	cfg.Google.ProjectID = "project"
+	cfg.Google.ClientSecret = "secret"
+	cfg.Server.MultiTenant = MultiTenantConfig{Enabled: true, UsersDir: t.TempDir(), PublicURL: "https://agenda.example.com"}
+	tp, err := newTenantProvider(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp.oauth.Endpoint.TokenURL = google.URL
+	mux := http.NewServeMux()
+	tp.register(mux)
+	return tp, mux
+}
+
+var (
+	authURLPattern = regexp.MustCompile(`href="([^"]+)"`)
+	codePattern    = regexp.MustCompile(`[A-Z2-9]{4}-[A-Z2-9]{4}`)
+)
+
+// openLink opens an onboarding link like a browser would and returns the
+// OAuth state sent to Google and the cookies set.
+func openLink(t *testing.T, mux *http.ServeMux, link string) (string, []*http.Cookie) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, link, nil))
+	match := authURLPattern.FindStringSubmatch(rec.Body.String())
+	if rec.Code != http.StatusOK || match == nil {
+		t.Fatalf("opening the link: status %d: %s", rec.Code, rec.Body)
+	}
+	authURL, err := url.Parse(html.UnescapeString(match[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authURL.Query().Get("state"), rec.Result().Cookies()
+}
+
+// googleCallback sends the browser back from Google's consent screen.
+func googleCallback(mux *http.ServeMux, state string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, onboardingCallbackPath+"?code=granted&state="+url.QueryEscape(state), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOnboardingRequiresConfirmationCode(t *testing.T) {
+	tp, mux := newTestTenantProvider(t)
+	state, cookies := openLink(t, mux, tp.onboardingLink("alice"))
+
+	rec := googleCallback(mux, state, cookies)
+	code := codePattern.FindString(rec.Body.String())
+	if rec.Code != http.StatusOK || code == "" {
+		t.Fatalf("callback: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := os.Stat(tp.users.path("alice")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("token stored before the code was confirmed: %v", err)
+	}
+
+	if err := tp.confirmGrant("mallory", code); err == nil {
+		t.Error("another user confirmed alice's grant")
+	}
+	if err := tp.confirmGrant("alice", "AAAA-AAAA"); err == nil {
+		t.Error("wrong code accepted")
+	}
+	if err := tp.confirmGrant("alice", strings.ToLower(code)); err != nil {
+		t.Fatalf("confirming the code: %v", err)
+	}
+	if _, err := os.Stat(tp.users.path("alice")); err != nil {
+		t.Errorf("token not stored after confirmation: %v", err)
+	}
+	if err := tp.confirmGrant("alice", code); err == nil {
+		t.Error("code accepted twice")
+	}
+}
+
+func TestOnboardingCallbackRequiresBrowserCookie(t *testing.T) {
+	tp, mux := newTestTenantProvider(t)
+	state, cookies := openLink(t, mux, tp.onboardingLink("alice"))
+
+	if rec := googleCallback(mux, state, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("callback without cookie: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	other := []*http.Cookie{{Name: onboardingCookie, Value: "another-browser"}}
+	if rec := googleCallback(mux, state, other); rec.Code != http.StatusBadRequest {
+		t.Errorf("callback from another browser: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	// The ticket of the link itself isn't bound to a browser
+	link, _ := url.Parse(tp.onboardingLink("alice"))
+	if rec := googleCallback(mux, link.Query().Get("ticket"), cookies); rec.Code != http.StatusBadRequest {
+		t.Errorf("callback with the link's ticket: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := googleCallback(mux, state, cookies); rec.Code != http.StatusOK {
+		t.Errorf("callback from the browser that opened the link: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestConfirmationCodeAttemptsAreLimited(t *testing.T) {
+	tp, _ := newTestTenantProvider(t)
+	code, err := tp.holdGrant("alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxCodeAttempts; i++ {
+		tp.confirmGrant("alice", "AAAA-AAAA")
+	}
+	if err := tp.confirmGrant("alice", code); err == nil {
+		t.Error("grant still pending after too many wrong codes")
+	}
+}
+
+func TestTicketKeySurvivesRestart(t *testing.T) {
+	tp, _ := newTestTenantProvider(t)
+	link := tp.onboardingLink("alice")
+
+	restarted, err := newTenantProvider(tp.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(link)
+	ticket, err := restarted.verifyTicket(u.Query().Get("ticket"))
+	if err != nil || ticket.Subject != "alice" {
+		t.Errorf("link from before the restart: %+v, %v", ticket, err)
+	}
+}
+
+func TestUsersAreKeyedByNamespacedSubject(t *testing.T) {
+	tp, _ := newTestTenantProvider(t)
+	oauthAlice := "oauth:https://auth.example.com#alice"
+	if err := tp.users.save(oauthAlice, &oauth2.Token{AccessToken: "alice-access", RefreshToken: "alice-refresh"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := withPrincipal(context.Background(), &principal{Subject: "static:alice"})
+	var notConnected *notConnectedError
+	if _, err := tp.calendarFor(ctx); !errors.As(err, &notConnected) {
+		t.Errorf("static token named alice: %v, want the OAuth user's calendar kept from it", err)
+	}
+}
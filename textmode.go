@@ -1,130 +1,275 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"strings"
 	"time"
 )
 
 // Run test mode - show agenda for specified date or today
-func runTextMode(dateStr string) {
-	fmt.Println("🔐 Running authentication flow...")
-	cs, err := initCalendarService()
+func runTextMode(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("text", flag.ExitOnError)
+	category := fs.String("category", "", "Only show events in these categories (comma-separated)")
+	includeTypes := fs.String("include-types", "", "Only show these event types (comma-separated)")
+	excludeTypes := fs.String("exclude-types", "", "Hide these event types (comma-separated)")
+	format := fs.String("format", formatText, "Output format: "+strings.Join(outputFormats, ", "))
+	templatePath := fs.String("template", "", "Go text/template file rendering the agenda instead of --format")
+	full := fs.Bool("full", false, "Show complete descriptions and guest lists")
+	positional := parseFlags(fs, args)
+
+	// Check if a date parameter was provided
+	var dateStr string
+	if len(positional) >= 1 {
+		dateStr = positional[0]
+	}
+	filter, err := newEventFilter(cfg, *category, *includeTypes, *excludeTypes)
+	if err != nil {
+		log.Fatalf("Invalid filter: %v", err)
+	}
+	var formatter agendaFormatter
+	if *templatePath != "" {
+		if *format != formatText {
+			log.Fatalf("--template and --format can't be used together")
+		}
+		if formatter, err = loadTemplateFormatter(*templatePath, cfg); err != nil {
+			log.Fatalf("%v", err)
+		}
+	} else if formatter, err = newFormatter(*format, cfg); err != nil {
+		log.Fatalf("Invalid --format: %v", err)
+	}
+
+	// Progress messages only go with the text format, so that other
+	// formats and templates can be piped or redirected
+	progress := io.Writer(os.Stdout)
+	if !strings.EqualFold(*format, formatText) || *templatePath != "" {
+		progress = os.Stderr
+	}
+
+	fmt.Fprintln(progress, "🔐 Running authentication flow...")
+	cs, err := initCalendarService(cfg)
 	if err != nil {
 		log.Fatalf("Authentication failed: %v", err)
 	}
-	fmt.Println("✅ Authentication successful! Token saved.")
+	fmt.Fprintln(progress, "✅ Authentication successful! Token saved.")
 
+	var day time.Time
 	var events []CalendarEvent
+	var asOf time.Time
 
 	if dateStr == "" {
 		// No date specified, use today
-		fmt.Println("📅 Fetching today's agenda...")
-		events, err = cs.getTodaysEvents()
+		fmt.Fprintln(progress, "📅 Fetching today's agenda...")
+		events, asOf, err = cs.getTodaysEvents(context.Background())
 		if err != nil {
 			log.Fatalf("Failed to get today's events: %v", err)
 		}
-		fmt.Print(formatEventsForDisplay(events))
+		day = cs.today()
 	} else {
 		// Date specified, use the provided date
-		fmt.Printf("📅 Fetching agenda for %s...\n", dateStr)
-		events, err = cs.getEventForDay(dateStr)
+		fmt.Fprintf(progress, "📅 Fetching agenda for %s...\n", dateStr)
+		events, asOf, err = cs.getEventForDay(context.Background(), dateStr)
 		if err != nil {
 			log.Fatalf("Failed to get events for %s: %v", dateStr, err)
 		}
-		fmt.Print(formatEventsForDisplayForDate(events, dateStr))
+		day, _ = cs.parseDate(dateStr)
+	}
+
+	// CSV and iCalendar have no place for the offline notice
+	switch strings.ToLower(*format) {
+	case formatCSV, formatICS:
+		if notice := offlineNotice(asOf, cfg); notice != "" {
+			fmt.Fprintln(os.Stderr, notice)
+		}
 	}
+	view := dayView(day, filter.apply(events), asOf)
+	view.Full = *full
+	output, err := formatter.format(view)
+	if err != nil {
+		log.Fatalf("Failed to render the agenda: %v", err)
+	}
+	if !strings.HasSuffix(output, "\n") {
+		output += "\n"
+	}
+	fmt.Print(output)
 }
 
-// Format events for display
-func formatEventsForDisplay(events []CalendarEvent) string {
-	now := time.Now()
-	var output strings.Builder
+// parseFlags parses fs from args, allowing flags before, after or between
+// positional arguments, and returns the positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			os.Exit(2)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
 
-	output.WriteString(fmt.Sprintf("📅 Daily Agenda for %s\n", now.Format("Monday, January 2, 2006")))
-	output.WriteString(strings.Repeat("=", 50) + "\n\n")
+// writeWorkingLocation writes the day's working location as a header and
+// returns the remaining events, which no longer include the location markers.
+func writeWorkingLocation(output *strings.Builder, events []CalendarEvent, plain bool) []CalendarEvent {
+	var locations []string
+	var remaining []CalendarEvent
+	for _, event := range events {
+		if event.EventType != "workingLocation" {
+			remaining = append(remaining, event)
+			continue
+		}
+		if !containsFold(locations, event.WorkingLocation) {
+			locations = append(locations, event.WorkingLocation)
+		}
+	}
 
-	if len(events) == 0 {
-		output.WriteString("🎉 No events scheduled for today!")
-		return output.String()
+	if len(locations) > 0 && plain {
+		output.WriteString(fmt.Sprintf("Working from: %s\n\n", strings.Join(locations, ", ")))
+	} else if len(locations) > 0 {
+		output.WriteString(fmt.Sprintf("📍 Working from: %s\n\n", strings.Join(locations, ", ")))
 	}
+	return remaining
+}
 
+// writeEventList writes the numbered list of the events of day. Plain
+// lists have no emoji, and full lists have complete descriptions and
+// guest lists.
+func writeEventList(output *strings.Builder, day time.Time, events []CalendarEvent, cfg *Config, plain, full bool) {
+	label := func(emoji, name string) string {
+		if plain {
+			return name + ": "
+		}
+		return emoji + " "
+	}
 	for i, event := range events {
 		output.WriteString(fmt.Sprintf("%d. ", i+1))
 
+		category := fmt.Sprintf("%s %s%s", event.CategoryEmoji, event.Category, eventTypeTag(event))
+		if plain {
+			category = fmt.Sprintf("(%s)", event.Category)
+			if label := eventTypeLabel(event); label != "" {
+				category += fmt.Sprintf(" [%s]", label)
+			}
+		}
+		span := dayOfEvent(event, day, cfg.location)
 		if event.IsAllDay {
-			output.WriteString(fmt.Sprintf("🗓️  %s (All day) %s %s\n", event.Summary, event.ColorEmoji, event.ColorName))
+			allDay := "All day"
+			if span != "" {
+				allDay += ", " + span
+			}
+			if !plain {
+				output.WriteString("🗓️  ")
+			}
+			output.WriteString(fmt.Sprintf("%s (%s) %s\n", event.Summary, allDay, category))
 		} else {
-			output.WriteString(fmt.Sprintf("🕐 %s", event.StartTime))
-			if event.EndTime != "" && event.EndTime != event.StartTime {
-				output.WriteString(fmt.Sprintf(" - %s", event.EndTime))
+			if !plain {
+				output.WriteString("🕐 ")
+			}
+			output.WriteString(timeRange(event, cfg))
+			if span != "" {
+				output.WriteString(fmt.Sprintf(" (%s)", span))
 			}
-			output.WriteString(fmt.Sprintf(" | %s %s %s\n", event.Summary, event.ColorEmoji, event.ColorName))
+			output.WriteString(fmt.Sprintf(" | %s %s\n", event.Summary, category))
+		}
+
+		if status := eventTypeStatus(event); status != "" && plain {
+			output.WriteString(fmt.Sprintf("   %s\n", strings.TrimPrefix(status, "🚫 ")))
+		} else if status != "" {
+			output.WriteString(fmt.Sprintf("   %s\n", status))
 		}
 
 		if event.Location != "" {
-			output.WriteString(fmt.Sprintf("   📍 %s\n", event.Location))
+			output.WriteString(fmt.Sprintf("   %s%s\n", label("📍", "Location"), event.Location))
 		}
 
-		if event.Description != "" {
-			desc := event.Description
-			if len(desc) > 100 {
-				desc = desc[:100] + "..."
-			}
-			output.WriteString(fmt.Sprintf("   📝 %s\n", desc))
+		if event.Description != "" && full {
+			desc := strings.ReplaceAll(event.Description, "\n", "\n      ")
+			output.WriteString(fmt.Sprintf("   %s%s\n", label("📝", "Description"), desc))
+		} else if event.Description != "" {
+			desc := truncateText(oneLine(event.Description), cfg.Formatting.DescriptionLength)
+			output.WriteString(fmt.Sprintf("   %s%s\n", label("📝", "Description"), desc))
+		}
+
+		if link := joinLink(event); link != "" {
+			output.WriteString(fmt.Sprintf("   %s%s\n", label("🎥", "Join"), link))
+		}
+		if links := otherLinks(event); len(links) > 0 {
+			output.WriteString(fmt.Sprintf("   %s%s\n", label("🔗", "Links"), strings.Join(links, " ")))
+		}
+
+		if repeats := recurrenceLine(event); full && repeats != "" {
+			output.WriteString(fmt.Sprintf("   %s%s\n", label("🔁", "Repeats"), repeats))
+		}
+		if full && event.Organizer != "" {
+			output.WriteString(fmt.Sprintf("   %s%s\n", label("👤", "Organizer"), event.Organizer))
+		}
+		if full && len(event.Attendees) > 0 {
+			output.WriteString(fmt.Sprintf("   %s%s\n", label("👥", "Guests"), strings.Join(guestList(event), ", ")))
 		}
 
 		output.WriteString("\n")
 	}
+}
 
-	return output.String()
+// eventTypeTag returns a short tag marking special event types.
+func eventTypeTag(event CalendarEvent) string {
+	label := eventTypeLabel(event)
+	if label == "" {
+		return ""
+	}
+	return fmt.Sprintf(" [%s %s]", eventTypeEmoji[event.EventType], label)
 }
 
-// Format events for display for a specific date
-func formatEventsForDisplayForDate(events []CalendarEvent, dateStr string) string {
-	targetDate, err := time.Parse("2006-01-02", dateStr)
-	var output strings.Builder
+var eventTypeEmoji = map[string]string{
+	"outOfOffice": "🏝️",
+	"focusTime":   "🎧",
+	"birthday":    "🎂",
+	"fromGmail":   "✉️",
+}
 
-	if err != nil {
-		output.WriteString(fmt.Sprintf("📅 Daily Agenda for %s\n", dateStr))
-	} else {
-		output.WriteString(fmt.Sprintf("📅 Daily Agenda for %s\n", targetDate.Format("Monday, January 2, 2006")))
+// eventTypeLabel names the special event types.
+func eventTypeLabel(event CalendarEvent) string {
+	switch event.EventType {
+	case "outOfOffice":
+		return "Out of office"
+	case "focusTime":
+		return "Focus time"
+	case "birthday":
+		return "Birthday"
+	case "fromGmail":
+		return "From Gmail"
+	default:
+		return ""
 	}
-	output.WriteString(strings.Repeat("=", 50) + "\n\n")
+}
 
-	if len(events) == 0 {
-		output.WriteString("🎉 No events scheduled for this day!")
-		return output.String()
+// eventTypeStatus describes the auto-decline and Do Not Disturb settings
+// of out-of-office and focus time events.
+func eventTypeStatus(event CalendarEvent) string {
+	var parts []string
+	switch event.AutoDeclineMode {
+	case "declineAllConflictingInvitations":
+		parts = append(parts, "auto-declining all conflicting invitations")
+	case "declineOnlyNewConflictingInvitations":
+		parts = append(parts, "auto-declining new conflicting invitations")
 	}
-
-	for i, event := range events {
-		output.WriteString(fmt.Sprintf("%d. ", i+1))
-
-		if event.IsAllDay {
-			output.WriteString(fmt.Sprintf("🗓️  %s (All day) %s %s\n", event.Summary, event.ColorEmoji, event.ColorName))
-		} else {
-			output.WriteString(fmt.Sprintf("🕐 %s", event.StartTime))
-			if event.EndTime != "" && event.EndTime != event.StartTime {
-				output.WriteString(fmt.Sprintf(" - %s", event.EndTime))
-			}
-			output.WriteString(fmt.Sprintf(" | %s %s %s\n", event.Summary, event.ColorEmoji, event.ColorName))
-		}
-
-		if event.Location != "" {
-			output.WriteString(fmt.Sprintf("   📍 %s\n", event.Location))
-		}
-
-		if event.Description != "" {
-			desc := event.Description
-			if len(desc) > 100 {
-				desc = desc[:100] + "..."
-			}
-			output.WriteString(fmt.Sprintf("   📝 %s\n", desc))
-		}
-
-		output.WriteString("\n")
+	if event.ChatStatus == "doNotDisturb" {
+		parts = append(parts, "Do Not Disturb in Chat")
+	}
+	if len(parts) == 0 {
+		return ""
 	}
 
-	return output.String()
+	status := "🚫 " + strings.Join(parts, ", ")
+	if event.DeclineMessage != "" {
+		status += fmt.Sprintf(" (%q)", event.DeclineMessage)
+	}
+	return status
 }
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/oauth2"
+)
+
+// Environment variables selecting the secret used to encrypt the token file.
+// When neither is set, tokens are stored as plaintext JSON.
+const (
+	tokenPassphraseEnv = "token_passphrase"
+	tokenKeyFileEnv    = "token_key_file"
+)
+
+// scrypt parameters for newly encrypted tokens. They are stored alongside
+// the ciphertext so they can be raised later without breaking old files.
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+// tokenAAD binds the ciphertext to its purpose so an encrypted token file
+// can't be confused with any other blob encrypted under the same secret.
+var tokenAAD = []byte("agenda-mcp oauth token v1")
+
+// encryptedToken is the on-disk format of an encrypted token file.
+type encryptedToken struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// tokenStore reads and writes the OAuth token, encrypting it with AES-GCM
+// when a secret is configured.
+type tokenStore struct {
+	path   string
+	secret []byte
+}
+
+// tokenDecryptError is returned when an encrypted token file exists but
+// can't be opened. It must not trigger a new authorization flow, which
+// would silently overwrite the user's token.
+type tokenDecryptError struct {
+	path string
+	err  error
+}
+
+func (e *tokenDecryptError) Error() string {
+	return fmt.Sprintf("unable to decrypt token file %s: %v. "+
+		"Check that %s or %s matches the secret used when the token was encrypted, "+
+		"or delete the file and run 'agenda-mcp text' to authorize again",
+		e.path, e.err, tokenPassphraseEnv, tokenKeyFileEnv)
+}
+
+func (e *tokenDecryptError) Unwrap() error {
+	return e.err
+}
+
+// newTokenStore returns a store for the token at path, using the secret
+// from the environment if one is configured.
+func newTokenStore(path string) (*tokenStore, error) {
+	secret, err := tokenSecretFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return &tokenStore{path: path, secret: secret}, nil
+}
+
+// tokenSecretFromEnv returns the configured token secret, or nil when
+// tokens should be stored in plaintext.
+func tokenSecretFromEnv() ([]byte, error) {
+	if passphrase := os.Getenv(tokenPassphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	if keyFile := os.Getenv(tokenKeyFileEnv); keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read token key file: %v", err)
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			return nil, fmt.Errorf("token key file %s is empty", keyFile)
+		}
+		return data, nil
+	}
+	return nil, nil
+}
+
+// encrypted reports whether tokens are encrypted when saved.
+func (ts *tokenStore) encrypted() bool {
+	return ts.secret != nil
+}
+
+// Load reads the token, decrypting it if the file is encrypted. Plaintext
+// files are still accepted when a secret is configured so that existing
+// installations keep working until they are migrated.
+func (ts *tokenStore) Load() (*oauth2.Token, error) {
+	data, err := os.ReadFile(ts.path)
+	if err != nil {
+		return nil, err
+	}
+
+	env, ok := parseEncryptedToken(data)
+	if !ok {
+		if ts.encrypted() {
+			fmt.Fprintf(os.Stderr, "⚠️  Token file %s is not encrypted, run 'agenda-mcp token encrypt' to encrypt it\n", ts.path)
+		}
+		tok := &oauth2.Token{}
+		err = json.Unmarshal(data, tok)
+		return tok, err
+	}
+
+	if !ts.encrypted() {
+		return nil, &tokenDecryptError{path: ts.path, err: errors.New("the file is encrypted but no secret is configured")}
+	}
+
+	plaintext, err := env.open(ts.secret)
+	if err != nil {
+		return nil, &tokenDecryptError{path: ts.path, err: err}
+	}
+
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal(plaintext, tok); err != nil {
+		return nil, &tokenDecryptError{path: ts.path, err: err}
+	}
+	return tok, nil
+}
+
+// Save writes the token, encrypted if a secret is configured.
+func (ts *tokenStore) Save(token *oauth2.Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	if ts.encrypted() {
+		env, err := sealToken(data, ts.secret)
+		if err != nil {
+			return err
+		}
+		data, err = json.Marshal(env)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeFileAtomic(ts.path, data, 0600)
+}
+
+// parseEncryptedToken reports whether data is an encrypted token file.
+func parseEncryptedToken(data []byte) (*encryptedToken, bool) {
+	env := &encryptedToken{}
+	if err := json.Unmarshal(data, env); err != nil {
+		return nil, false
+	}
+	if env.KDF == "" || len(env.Ciphertext) == 0 {
+		return nil, false
+	}
+	return env, true
+}
+
+func sealToken(plaintext, secret []byte) (*encryptedToken, error) {
+	env := &encryptedToken{
+		Version: 1,
+		KDF:     "scrypt",
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+		Salt:    make([]byte, saltLen),
+	}
+	if _, err := rand.Read(env.Salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := env.cipher(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	env.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return nil, err
+	}
+	env.Ciphertext = gcm.Seal(nil, env.Nonce, plaintext, tokenAAD)
+	return env, nil
+}
+
+func (env *encryptedToken) open(secret []byte) ([]byte, error) {
+	if env.Version != 1 || env.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported token file format (version %d, kdf %q)", env.Version, env.KDF)
+	}
+
+	gcm, err := env.cipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("invalid nonce")
+	}
+
+	plaintext, err := gcm.Open(nil, env.Nonce, env.Ciphertext, tokenAAD)
+	if err != nil {
+		return nil, errors.New("wrong passphrase or key file, or the file is corrupted")
+	}
+	return plaintext, nil
+}
+
+func (env *encryptedToken) cipher(secret []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(secret, env.Salt, env.N, env.R, env.P, scryptKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path
+// so a crash never leaves a truncated token behind.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// encryptTokenFile migrates an existing plaintext token file to the
+// encrypted format using the configured secret.
+func encryptTokenFile(path string) error {
+	store, err := newTokenStore(path)
+	if err != nil {
+		return err
+	}
+	if !store.encrypted() {
+		return fmt.Errorf("set %s or %s to choose the secret used to encrypt the token", tokenPassphraseEnv, tokenKeyFileEnv)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read token file: %v", err)
+	}
+	if _, ok := parseEncryptedToken(data); ok {
+		return fmt.Errorf("token file %s is already encrypted", path)
+	}
+
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal(data, tok); err != nil {
+		return fmt.Errorf("unable to parse token file %s: %v", path, err)
+	}
+	return store.Save(tok)
+}
+
+// runTokenMode handles the "token" subcommands.
+func runTokenMode(args []string) {
+	if len(args) == 0 || args[0] != "encrypt" {
+		fmt.Println("Usage: agenda-mcp token encrypt [path]")
+		fmt.Println("  Encrypts an existing plaintext token file (default: token.json)")
+		fmt.Printf("  using the secret from %s or %s.\n", tokenPassphraseEnv, tokenKeyFileEnv)
+		os.Exit(1)
+	}
+
+	path := "token.json"
+	if len(args) >= 2 {
+		path = args[1]
+	}
+	if err := encryptTokenFile(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encrypt token: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("🔒 Token file %s is now encrypted\n", path)
+}
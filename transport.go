@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Transports supported by the MCP server.
+const (
+	transportStdio = "stdio"
+	transportHTTP  = "http"
+	transportSSE   = "sse"
+)
+
+// shutdownTimeout bounds how long in-flight requests get to finish.
+const shutdownTimeout = 10 * time.Second
+
+// ServerConfig controls how the MCP server is exposed.
+type ServerConfig struct {
+	Transport   string            `yaml:"transport"`
+	Listen      string            `yaml:"listen"`
+	BasePath    string            `yaml:"base_path"`
+	Auth        AuthServerConfig  `yaml:"auth"`
+	MultiTenant MultiTenantConfig `yaml:"multi_tenant"`
+	// How often subscribed resources are checked for changes; 0 disables
+	// subscriptions
+	PollInterval time.Duration `yaml:"poll_interval"`
+}
+
+func (sc ServerConfig) validate() error {
+	switch sc.Transport {
+	case transportStdio, transportHTTP, transportSSE:
+	default:
+		return fmt.Errorf("transport must be one of stdio, http, sse, got %q", sc.Transport)
+	}
+	if sc.Transport != transportStdio && sc.Listen == "" {
+		return fmt.Errorf("a listen address is required for the %s transport", sc.Transport)
+	}
+	return nil
+}
+
+// acceptsTemplates reports whether MCP clients may send agenda templates.
+// A template can't be interrupted, so only the local user of the stdio
+// transport may run one.
+func (sc ServerConfig) acceptsTemplates() bool {
+	return sc.Transport == transportStdio
+}
+
+// normalizeBasePath returns path with a leading slash and no trailing slash.
+func normalizeBasePath(path string) string {
+	path = "/" + strings.Trim(path, "/")
+	if path == "/" {
+		return ""
+	}
+	return path
+}
+
+// httpExtension adds endpoints and request checks to the HTTP transports.
+// Its wrap runs after authentication.
+type httpExtension interface {
+	register(mux *http.ServeMux)
+	wrap(next http.Handler) http.Handler
+}
+
+// serveMCP serves the MCP server on the configured transport until it is
+// stopped, running the subscription poller alongside. ext may be nil.
+func serveMCP(rpc *rpcLayer, sc ServerConfig, ext httpExtension) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if rpc.subs != nil {
+		pollCtx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rpc.subs.run(pollCtx)
+		}()
+		// Stop the poller before returning
+		defer wg.Wait()
+		defer cancel()
+	}
+
+	switch sc.Transport {
+	case transportHTTP, transportSSE:
+		return serveMCPOverHTTP(ctx, rpc, sc, ext)
+	default:
+		return rpc.serveStdio(ctx, os.Stdin, os.Stdout)
+	}
+}
+
+// serveMCPOverHTTP serves the streamable HTTP or SSE transport along with a
+// health check, and shuts down gracefully when ctx is done.
+func serveMCPOverHTTP(ctx context.Context, rpc *rpcLayer, sc ServerConfig, ext httpExtension) error {
+	mux := http.NewServeMux()
+	httpServer := &http.Server{
+		Addr:              sc.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	})
+
+	auth := newHTTPAuth(sc.Auth)
+	auth.register(mux)
+	protect := auth.wrap
+	if ext != nil {
+		ext.register(mux)
+		protect = func(next http.Handler) http.Handler {
+			return auth.wrap(ext.wrap(next))
+		}
+	}
+	if !sc.Auth.enabled() && !isLoopbackAddr(sc.Listen) {
+		fmt.Fprintf(os.Stderr, "⚠️  No server.auth configured: anyone who can reach %s can read your calendar\n", sc.Listen)
+	}
+
+	var shutdown func(context.Context) error
+	var endpoint string
+	if sc.Transport == transportSSE {
+		sseServer := server.NewSSEServer(rpc.s,
+			server.WithStaticBasePath(sc.BasePath),
+			server.WithUseFullURLForMessageEndpoint(false),
+			server.WithKeepAlive(true),
+			server.WithHTTPServer(httpServer),
+		)
+		mux.Handle(sseServer.CompleteSsePath(), protect(sseServer.SSEHandler()))
+		mux.Handle(sseServer.CompleteMessagePath(), protect(rpc.wrapSSE(sseServer, sseServer.MessageHandler())))
+		shutdown = sseServer.Shutdown
+		endpoint = sseServer.CompleteSsePath()
+	} else {
+		endpoint = sc.BasePath
+		if endpoint == "" {
+			endpoint = "/"
+		}
+		httpTransport := server.NewStreamableHTTPServer(rpc.s,
+			server.WithEndpointPath(endpoint),
+			server.WithStreamableHTTPServer(httpServer),
+		)
+		mux.Handle(endpoint, protect(rpc.wrapHTTP(httpTransport)))
+		shutdown = httpTransport.Shutdown
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		fmt.Fprintf(os.Stderr, "🌐 Serving MCP over %s on %s%s\n", sc.Transport, sc.Listen, endpoint)
+		if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Fprintf(os.Stderr, "🛑 Shutting down MCP server...\n")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %v", err)
+	}
+	return <-errCh
+}
+
+// isLoopbackAddr reports whether a listen address only accepts local connections.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+// Error codes of failed tool calls.
+const (
+	codeInvalidArgument = "invalid_argument"
+	codeNotFound        = "not_found"
+	codeUnauthorized    = "unauthorized"
+	codeRateLimited     = "rate_limited"
+	codeUnavailable     = "unavailable"
+	codeDeadline        = "deadline_exceeded"
+	codeCancelled       = "cancelled"
+)
+
+// toolError is a tool failure reported to the client as JSON, so it can
+// tell a bad argument from a missing event or an expired login.
+type toolError struct {
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Argument string `json:"argument,omitempty"`
+}
+
+func (e *toolError) Error() string {
+	return e.Message
+}
+
+func invalidArgument(name, format string, args ...any) *toolError {
+	return &toolError{Code: codeInvalidArgument, Message: fmt.Sprintf(format, args...), Argument: name}
+}
+
+// toToolError classifies err by its cause.
+func toToolError(err error) *toolError {
+	var te *toolError
+	if errors.As(err, &te) {
+		return te
+	}
+	code := codeUnavailable
+	var apiErr *googleapi.Error
+	var retrieveErr *oauth2.RetrieveError
+	var notConnected *notConnectedError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codeDeadline
+	case errors.Is(err, context.Canceled):
+		code = codeCancelled
+	case errors.Is(err, errRateLimited):
+		code = codeRateLimited
+	case errors.Is(err, errEventNotFound), errors.Is(err, errNoSnapshot):
+		code = codeNotFound
+	case errors.Is(err, errUnauthenticated), errors.As(err, &notConnected), errors.As(err, &retrieveErr):
+		code = codeUnauthorized
+	case errors.As(err, &apiErr):
+		code = apiErrorCode(apiErr)
+	}
+	return &toolError{Code: code, Message: err.Error()}
+}
+
+func apiErrorCode(err *googleapi.Error) string {
+	for _, item := range err.Errors {
+		if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+			return codeRateLimited
+		}
+	}
+	switch err.Code {
+	case http.StatusTooManyRequests:
+		return codeRateLimited
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return codeUnauthorized
+	case http.StatusNotFound, http.StatusGone:
+		return codeNotFound
+	}
+	return codeUnavailable
+}
+
+// toolErrorResult is the result of a failed tool call.
+func toolErrorResult(err error) *mcp.CallToolResult {
+	data, _ := json.Marshal(map[string]*toolError{"error": toToolError(err)})
+	return mcp.NewToolResultError(string(data))
+}
+
+// toolArgs are the arguments of a tool call that passed validation.
+type toolArgs map[string]any
+
+func (a toolArgs) string(name string) string {
+	value, _ := a[name].(string)
+	return strings.TrimSpace(value)
+}
+
+func (a toolArgs) bool(name string) bool {
+	value, _ := a[name].(bool)
+	return value
+}
+
+// int returns a number argument, or fallback when it wasn't given.
+func (a toolArgs) int(name string, fallback int) int {
+	value, ok := a[name].(float64)
+	if !ok {
+		return fallback
+	}
+	return int(value)
+}
+
+// toolHandler handles a validated tool call. Returned errors are
+// reported to the client with toolErrorResult.
+type toolHandler func(ctx context.Context, args toolArgs) (*mcp.CallToolResult, error)
+
+// addTool registers a tool whose arguments are checked against its input
+// schema before the handler runs.
+func addTool(s *server.MCPServer, tool mcp.Tool, handler toolHandler) {
+	s.AddTool(tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args, err := validateArgs(tool.InputSchema, request.Params.Arguments)
+		if err != nil {
+			return toolErrorResult(err), nil
+		}
+		result, err := handler(ctx, args)
+		if err != nil {
+			return toolErrorResult(err), nil
+		}
+		return result, nil
+	})
+}
+
+// dateFormat marks a string property as a YYYY-MM-DD calendar date.
+func dateFormat() mcp.PropertyOption {
+	return func(schema map[string]any) {
+		schema["format"] = "date"
+		schema["pattern"] = `^\d{4}-\d{2}-\d{2}$`
+	}
+}
+
+// validateArgs checks arguments against schema: unknown and missing
+// arguments, types, patterns, enums, date formats and number ranges.
+func validateArgs(schema mcp.ToolInputSchema, arguments any) (toolArgs, error) {
+	args := toolArgs{}
+	if arguments != nil {
+		var ok bool
+		if args, ok = arguments.(map[string]any); !ok {
+			return nil, invalidArgument("", "arguments must be an object")
+		}
+	}
+
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property, ok := schema.Properties[name].(map[string]any)
+		if !ok {
+			return nil, invalidArgument(name, "unknown argument %q", name)
+		}
+		if err := validateArg(name, property, args[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range schema.Required {
+		if isEmptyArg(args[name]) {
+			return nil, invalidArgument(name, "%s is required", name)
+		}
+	}
+	return args, nil
+}
+
+func isEmptyArg(value any) bool {
+	text, isString := value.(string)
+	return value == nil || isString && strings.TrimSpace(text) == ""
+}
+
+func validateArg(name string, property map[string]any, value any) error {
+	if value == nil {
+		return nil
+	}
+	switch property["type"] {
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return invalidArgument(name, "%s must be a string", name)
+		}
+		if pattern, ok := property["pattern"].(string); ok && text != "" && !regexp.MustCompile(pattern).MatchString(text) {
+			if property["format"] == "date" {
+				return invalidArgument(name, "%s must be a date in YYYY-MM-DD format, got %q", name, text)
+			}
+			return invalidArgument(name, "%s does not match %s", name, pattern)
+		}
+		if property["format"] == "date" && text != "" {
+			if _, err := time.Parse("2006-01-02", text); err != nil {
+				return invalidArgument(name, "%s is not a valid date: %q", name, text)
+			}
+		}
+		if enum, ok := property["enum"].([]string); ok && !containsFold(enum, text) {
+			return invalidArgument(name, "%s must be one of %s, got %q", name, strings.Join(enum, ", "), text)
+		}
+	case "number":
+		number, ok := value.(float64)
+		if !ok {
+			return invalidArgument(name, "%s must be a number", name)
+		}
+		if minimum, ok := property["minimum"].(float64); ok && number < minimum {
+			return invalidArgument(name, "%s must be at least %v, got %v", name, minimum, number)
+		}
+		if maximum, ok := property["maximum"].(float64); ok && number > maximum {
+			return invalidArgument(name, "%s must be at most %v, got %v", name, maximum, number)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return invalidArgument(name, "%s must be true or false", name)
+		}
+	}
+	return nil
+}
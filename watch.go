@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// calendarWatcher detects changes to one user's calendars with Google's
+// incremental sync: each poll only returns the events changed since the
+// previous sync token.
+type calendarWatcher struct {
+	cs     *CalendarService
+	tokens map[string]string
+}
+
+func newCalendarWatcher(cs *CalendarService) *calendarWatcher {
+	return &calendarWatcher{cs: cs, tokens: make(map[string]string)}
+}
+
+// changes returns the events changed since the last call. full reports
+// that the changes are unknown, because this is the first sync of a
+// calendar or its sync token expired, so anything may have changed.
+//
+// The event cache has sync tokens of its own and would serve events up to
+// max_age old, so a calendar with changes is synced again right away for
+// the reads that follow.
+func (w *calendarWatcher) changes(ctx context.Context) (changed []*calendar.Event, full bool, err error) {
+	for _, calendarID := range w.cs.config.calendars() {
+		token, synced := w.tokens[calendarID]
+		if !synced {
+			full = true
+			if w.tokens[calendarID], err = w.fullSync(ctx, calendarID); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+
+		items, next, err := w.incrementalSync(ctx, calendarID, token)
+		var apiErr *googleapi.Error
+		expired := errors.As(err, &apiErr) && apiErr.Code == http.StatusGone
+		if expired {
+			// The sync token expired: start over
+			full = true
+			if w.tokens[calendarID], err = w.fullSync(ctx, calendarID); err != nil {
+				return nil, false, err
+			}
+		} else if err != nil {
+			return nil, false, err
+		} else {
+			w.tokens[calendarID] = next
+		}
+		if (len(items) > 0 || expired) && w.cs.cache != nil {
+			if _, err := w.cs.syncCalendar(ctx, calendarID, true); err != nil {
+				return nil, false, err
+			}
+		}
+		changed = append(changed, items...)
+	}
+	return changed, full, nil
+}
+
+// fullSync lists every event of a calendar to get a sync token. Only the
+// token is kept, so the items themselves aren't requested.
+func (w *calendarWatcher) fullSync(ctx context.Context, calendarID string) (string, error) {
+	pageToken := ""
+	for {
+		call := w.cs.service.Events.List(calendarID).MaxResults(2500).
+			Fields("nextPageToken", "nextSyncToken")
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+		callCtx, cancel := w.cs.callContext(ctx)
+		events, err := call.Context(callCtx).Do()
+		cancel()
+		if err != nil {
+			return "", fmt.Errorf("unable to sync %s: %v", calendarID, err)
+		}
+		if events.NextPageToken == "" {
+			return events.NextSyncToken, nil
+		}
+		pageToken = events.NextPageToken
+	}
+}
+
+func (w *calendarWatcher) incrementalSync(ctx context.Context, calendarID, syncToken string) ([]*calendar.Event, string, error) {
+	var items []*calendar.Event
+	pageToken := ""
+	for {
+		call := w.cs.service.Events.List(calendarID).SyncToken(syncToken).MaxResults(2500).
+			Fields("nextPageToken", "nextSyncToken",
+				"items(id,status,start,end,recurrence,recurringEventId,originalStartTime)")
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+		callCtx, cancel := w.cs.callContext(ctx)
+		events, err := call.Context(callCtx).Do()
+		cancel()
+		if err != nil {
+			return nil, "", err
+		}
+		items = append(items, events.Items...)
+		if events.NextPageToken == "" {
+			return items, events.NextSyncToken, nil
+		}
+		pageToken = events.NextPageToken
+	}
+}
+
+// affects reports whether a changed event may change resource r, whose
+// last read contained the events in known.
+func (w *calendarWatcher) affects(r agendaResource, known map[string]bool, item *calendar.Event) bool {
+	if r.isEvent() {
+		return item.Id == r.eventID || isInstanceOf(r.eventID, item.Id)
+	}
+	if known[item.Id] || len(item.Recurrence) > 0 {
+		// Recurring series can gain or lose instances anywhere
+		return true
+	}
+	for id := range known {
+		if isInstanceOf(id, item.Id) {
+			return true
+		}
+	}
+	start, end, ok := w.cs.eventTimes(item)
+	return ok && start.Before(r.end) && end.After(r.start)
+}
+
+// isInstanceOf reports whether eventID is an instance of the recurring
+// series seriesID. Instance IDs are the series ID followed by the
+// original start time.
+func isInstanceOf(eventID, seriesID string) bool {
+	return strings.HasPrefix(eventID, seriesID+"_")
+}
+
+// eventTimes returns the start and end of an API event.
+func (cs *CalendarService) eventTimes(item *calendar.Event) (start, end time.Time, ok bool) {
+	if item.Start == nil || item.End == nil {
+		return time.Time{}, time.Time{}, false
+	}
+	var startErr, endErr error
+	if item.Start.DateTime != "" {
+		start, startErr = time.Parse(time.RFC3339, item.Start.DateTime)
+	} else {
+		start, startErr = time.ParseInLocation("2006-01-02", item.Start.Date, cs.config.location)
+	}
+	if item.End.DateTime != "" {
+		end, endErr = time.Parse(time.RFC3339, item.End.DateTime)
+	} else {
+		end, endErr = time.ParseInLocation("2006-01-02", item.End.Date, cs.config.location)
+	}
+	return start, end, startErr == nil && endErr == nil
+}